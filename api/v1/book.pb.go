@@ -24,6 +24,7 @@ const (
 type RandomBooksRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Count         int32                  `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	Ndc           string                 `protobuf:"bytes,2,opt,name=ndc,proto3" json:"ndc,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -65,6 +66,13 @@ func (x *RandomBooksRequest) GetCount() int32 {
 	return 0
 }
 
+func (x *RandomBooksRequest) GetNdc() string {
+	if x != nil {
+		return x.Ndc
+	}
+	return ""
+}
+
 type Book struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
@@ -77,6 +85,7 @@ type Book struct {
 	Description   string                 `protobuf:"bytes,8,opt,name=description,proto3" json:"description,omitempty"`
 	BookUrl       string                 `protobuf:"bytes,9,opt,name=book_url,json=bookUrl,proto3" json:"book_url,omitempty"`
 	ImageUrl      string                 `protobuf:"bytes,10,opt,name=image_url,json=imageUrl,proto3" json:"image_url,omitempty"`
+	Ndc           []string               `protobuf:"bytes,11,rep,name=ndc,proto3" json:"ndc,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -181,6 +190,13 @@ func (x *Book) GetImageUrl() string {
 	return ""
 }
 
+func (x *Book) GetNdc() []string {
+	if x != nil {
+		return x.Ndc
+	}
+	return nil
+}
+
 type RandomBooksResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Books         []*Book                `protobuf:"bytes,1,rep,name=books,proto3" json:"books,omitempty"`
@@ -225,13 +241,170 @@ func (x *RandomBooksResponse) GetBooks() []*Book {
 	return nil
 }
 
+type SearchBooksRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchBooksRequest) Reset() {
+	*x = SearchBooksRequest{}
+	mi := &file_api_v1_book_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchBooksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchBooksRequest) ProtoMessage() {}
+
+func (x *SearchBooksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_book_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchBooksRequest.ProtoReflect.Descriptor instead.
+func (*SearchBooksRequest) Descriptor() ([]byte, []int) {
+	return file_api_v1_book_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SearchBooksRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchBooksRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type SearchHit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Book          *Book                  `protobuf:"bytes,1,opt,name=book,proto3" json:"book,omitempty"`
+	Rank          float64                `protobuf:"fixed64,2,opt,name=rank,proto3" json:"rank,omitempty"`
+	Snippet       string                 `protobuf:"bytes,3,opt,name=snippet,proto3" json:"snippet,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchHit) Reset() {
+	*x = SearchHit{}
+	mi := &file_api_v1_book_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchHit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchHit) ProtoMessage() {}
+
+func (x *SearchHit) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_book_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchHit.ProtoReflect.Descriptor instead.
+func (*SearchHit) Descriptor() ([]byte, []int) {
+	return file_api_v1_book_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SearchHit) GetBook() *Book {
+	if x != nil {
+		return x.Book
+	}
+	return nil
+}
+
+func (x *SearchHit) GetRank() float64 {
+	if x != nil {
+		return x.Rank
+	}
+	return 0
+}
+
+func (x *SearchHit) GetSnippet() string {
+	if x != nil {
+		return x.Snippet
+	}
+	return ""
+}
+
+type SearchBooksResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Hits          []*SearchHit           `protobuf:"bytes,1,rep,name=hits,proto3" json:"hits,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchBooksResponse) Reset() {
+	*x = SearchBooksResponse{}
+	mi := &file_api_v1_book_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchBooksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchBooksResponse) ProtoMessage() {}
+
+func (x *SearchBooksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_book_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchBooksResponse.ProtoReflect.Descriptor instead.
+func (*SearchBooksResponse) Descriptor() ([]byte, []int) {
+	return file_api_v1_book_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SearchBooksResponse) GetHits() []*SearchHit {
+	if x != nil {
+		return x.Hits
+	}
+	return nil
+}
+
 var File_api_v1_book_proto protoreflect.FileDescriptor
 
 const file_api_v1_book_proto_rawDesc = "" +
 	"\n" +
-	"\x11api/v1/book.proto\x12\abook.v1\"*\n" +
+	"\x11api/v1/book.proto\x12\abook.v1\"<\n" +
 	"\x12RandomBooksRequest\x12\x14\n" +
-	"\x05count\x18\x01 \x01(\x05R\x05count\"\x95\x02\n" +
+	"\x05count\x18\x01 \x01(\x05R\x05count\x12\x10\n" +
+	"\x03ndc\x18\x02 \x01(\tR\x03ndc\"\xa7\x02\n" +
 	"\x04Book\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
 	"\x04isbn\x18\x02 \x01(\tR\x04isbn\x12\x14\n" +
@@ -243,11 +416,22 @@ const file_api_v1_book_proto_rawDesc = "" +
 	"\vdescription\x18\b \x01(\tR\vdescription\x12\x19\n" +
 	"\bbook_url\x18\t \x01(\tR\abookUrl\x12\x1b\n" +
 	"\timage_url\x18\n" +
-	" \x01(\tR\bimageUrl\":\n" +
+	" \x01(\tR\bimageUrl\x12\x10\n" +
+	"\x03ndc\x18\v \x03(\tR\x03ndc\":\n" +
 	"\x13RandomBooksResponse\x12#\n" +
-	"\x05books\x18\x01 \x03(\v2\r.book.v1.BookR\x05books2Z\n" +
+	"\x05books\x18\x01 \x03(\v2\r.book.v1.BookR\x05books\"@\n" +
+	"\x12SearchBooksRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"\\\n" +
+	"\tSearchHit\x12!\n" +
+	"\x04book\x18\x01 \x01(\v2\r.book.v1.BookR\x04book\x12\x12\n" +
+	"\x04rank\x18\x02 \x01(\x01R\x04rank\x12\x18\n" +
+	"\asnippet\x18\x03 \x01(\tR\asnippet\"=\n" +
+	"\x13SearchBooksResponse\x12&\n" +
+	"\x04hits\x18\x01 \x03(\v2\x12.book.v1.SearchHitR\x04hits2\xa4\x01\n" +
 	"\vBookService\x12K\n" +
-	"\x0eGetRandomBooks\x12\x1b.book.v1.RandomBooksRequest\x1a\x1c.book.v1.RandomBooksResponseB7Z5github.com/taiki-umetsu/ndc007-bookpicker/api/book_v1b\x06proto3"
+	"\x0eGetRandomBooks\x12\x1b.book.v1.RandomBooksRequest\x1a\x1c.book.v1.RandomBooksResponse\x12H\n" +
+	"\vSearchBooks\x12\x1b.book.v1.SearchBooksRequest\x1a\x1c.book.v1.SearchBooksResponseB7Z5github.com/taiki-umetsu/ndc007-bookpicker/api/book_v1b\x06proto3"
 
 var (
 	file_api_v1_book_proto_rawDescOnce sync.Once
@@ -261,21 +445,28 @@ func file_api_v1_book_proto_rawDescGZIP() []byte {
 	return file_api_v1_book_proto_rawDescData
 }
 
-var file_api_v1_book_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_api_v1_book_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_api_v1_book_proto_goTypes = []any{
 	(*RandomBooksRequest)(nil),  // 0: book.v1.RandomBooksRequest
 	(*Book)(nil),                // 1: book.v1.Book
 	(*RandomBooksResponse)(nil), // 2: book.v1.RandomBooksResponse
+	(*SearchBooksRequest)(nil),  // 3: book.v1.SearchBooksRequest
+	(*SearchHit)(nil),           // 4: book.v1.SearchHit
+	(*SearchBooksResponse)(nil), // 5: book.v1.SearchBooksResponse
 }
 var file_api_v1_book_proto_depIdxs = []int32{
 	1, // 0: book.v1.RandomBooksResponse.books:type_name -> book.v1.Book
-	0, // 1: book.v1.BookService.GetRandomBooks:input_type -> book.v1.RandomBooksRequest
-	2, // 2: book.v1.BookService.GetRandomBooks:output_type -> book.v1.RandomBooksResponse
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	1, // 1: book.v1.SearchHit.book:type_name -> book.v1.Book
+	4, // 2: book.v1.SearchBooksResponse.hits:type_name -> book.v1.SearchHit
+	0, // 3: book.v1.BookService.GetRandomBooks:input_type -> book.v1.RandomBooksRequest
+	3, // 4: book.v1.BookService.SearchBooks:input_type -> book.v1.SearchBooksRequest
+	2, // 5: book.v1.BookService.GetRandomBooks:output_type -> book.v1.RandomBooksResponse
+	5, // 6: book.v1.BookService.SearchBooks:output_type -> book.v1.SearchBooksResponse
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_api_v1_book_proto_init() }
@@ -289,7 +480,7 @@ func file_api_v1_book_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_v1_book_proto_rawDesc), len(file_api_v1_book_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
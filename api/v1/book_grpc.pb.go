@@ -20,6 +20,7 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	BookService_GetRandomBooks_FullMethodName = "/book.v1.BookService/GetRandomBooks"
+	BookService_SearchBooks_FullMethodName    = "/book.v1.BookService/SearchBooks"
 )
 
 // BookServiceClient is the client API for BookService service.
@@ -27,6 +28,7 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type BookServiceClient interface {
 	GetRandomBooks(ctx context.Context, in *RandomBooksRequest, opts ...grpc.CallOption) (*RandomBooksResponse, error)
+	SearchBooks(ctx context.Context, in *SearchBooksRequest, opts ...grpc.CallOption) (*SearchBooksResponse, error)
 }
 
 type bookServiceClient struct {
@@ -47,11 +49,22 @@ func (c *bookServiceClient) GetRandomBooks(ctx context.Context, in *RandomBooksR
 	return out, nil
 }
 
+func (c *bookServiceClient) SearchBooks(ctx context.Context, in *SearchBooksRequest, opts ...grpc.CallOption) (*SearchBooksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchBooksResponse)
+	err := c.cc.Invoke(ctx, BookService_SearchBooks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BookServiceServer is the server API for BookService service.
 // All implementations must embed UnimplementedBookServiceServer
 // for forward compatibility.
 type BookServiceServer interface {
 	GetRandomBooks(context.Context, *RandomBooksRequest) (*RandomBooksResponse, error)
+	SearchBooks(context.Context, *SearchBooksRequest) (*SearchBooksResponse, error)
 	mustEmbedUnimplementedBookServiceServer()
 }
 
@@ -65,6 +78,9 @@ type UnimplementedBookServiceServer struct{}
 func (UnimplementedBookServiceServer) GetRandomBooks(context.Context, *RandomBooksRequest) (*RandomBooksResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetRandomBooks not implemented")
 }
+func (UnimplementedBookServiceServer) SearchBooks(context.Context, *SearchBooksRequest) (*SearchBooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchBooks not implemented")
+}
 func (UnimplementedBookServiceServer) mustEmbedUnimplementedBookServiceServer() {}
 func (UnimplementedBookServiceServer) testEmbeddedByValue()                     {}
 
@@ -104,6 +120,24 @@ func _BookService_GetRandomBooks_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BookService_SearchBooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchBooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookServiceServer).SearchBooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookService_SearchBooks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookServiceServer).SearchBooks(ctx, req.(*SearchBooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // BookService_ServiceDesc is the grpc.ServiceDesc for BookService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,6 +149,10 @@ var BookService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetRandomBooks",
 			Handler:    _BookService_GetRandomBooks_Handler,
 		},
+		{
+			MethodName: "SearchBooks",
+			Handler:    _BookService_SearchBooks_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "api/v1/book.proto",
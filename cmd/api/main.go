@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/server"
 )
 
@@ -25,8 +27,13 @@ func main() {
 	}
 	defer db.Close()
 
-	handler := server.NewHandler(db)
-	router := server.NewRouter(handler)
+	if err := database.CheckVersion(context.Background(), db); err != nil {
+		log.Fatal("スキーマ確認エラー:", err)
+	}
+
+	handler := server.NewHandler(repository.NewPostgresBookRepository(db), repository.NewPostgresRunRepository(db))
+	// 未設定の場合、バッチの実行履歴（/api/v1/admin）は公開しない
+	router := server.NewRouter(handler, os.Getenv("ADMIN_TOKEN"), server.DefaultRateLimit())
 
 	fmt.Println("Server is running on port 8080")
 	http.ListenAndServe(":8080", router)
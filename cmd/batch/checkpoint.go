@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/batch"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
+)
+
+// runConfig は実行記録に保存する設定です。-resume では保存した設定で再開します。
+type runConfig struct {
+	*batch.Config
+	Incremental bool `json:"incremental"`
+	PruneMissed int  `json:"pruneMissed"`
+	VerifyNDC   bool `json:"verifyNdc"`
+}
+
+// resumeFlags は -resume と併用できないフラグです。再開時は元の実行の設定を使います。
+var resumeFlags = []string{
+	"config", "ndc", "count", "year-from", "year-to", "sort", "chunk-size",
+	"incremental", "prune-missed", "verify-ndc", "dry-run", "out",
+}
+
+// resumeRun は中断した実行の記録・設定・途中経過を読み込み、実行中に戻します。
+// 後の取り込みがコミット済みの実行は、古い途中経過で登録し直さないよう再開しません。
+// 設定にない項目（以前のバージョンで実行した場合の policy など）は既定値を使います。
+func resumeRun(ctx context.Context, db *sql.DB, id int64) (*run.Run, runConfig, *run.Checkpoint, error) {
+	rc := runConfig{Config: batch.DefaultConfig()}
+	rc.Targets = nil
+
+	ingestion, err := repository.NewPostgresRunRepository(db).Get(ctx, id)
+	if errors.Is(err, repository.ErrRunNotFound) {
+		return nil, rc, nil, withExit(exitConfig, fmt.Errorf("実行記録が見つかりません (id: %d)", id))
+	}
+	if err != nil {
+		return nil, rc, nil, withExit(exitDatabase, fmt.Errorf("実行記録取得エラー (id: %d): %w", id, err))
+	}
+
+	// retry-failed の実行など、取得対象のない実行は再開できない
+	var probe struct {
+		Targets []batch.Target `json:"targets"`
+	}
+	if err := json.Unmarshal(ingestion.Config, &probe); err != nil || len(probe.Targets) == 0 {
+		return nil, rc, nil, withExit(exitConfig, fmt.Errorf("実行 %d は CiNii からの取り込みではないため再開できません", id))
+	}
+	if err := json.Unmarshal(ingestion.Config, &rc); err != nil {
+		return nil, rc, nil, withExit(exitConfig, fmt.Errorf("実行 %d の設定の読み取りエラー: %w", id, err))
+	}
+	if rc.Config, err = rc.Config.Resolve(); err != nil {
+		return nil, rc, nil, withExit(exitConfig, err)
+	}
+	if ingestion.Status == run.StatusCommitted {
+		return nil, rc, nil, withExit(exitConfig, fmt.Errorf("実行 %d はコミット済みのため再開できません", id))
+	}
+	superseded, err := ingestion.Superseded(ctx, db)
+	if err != nil {
+		return nil, rc, nil, withExit(exitDatabase, err)
+	}
+	if superseded {
+		return nil, rc, nil, withExit(exitConfig, fmt.Errorf("実行 %d より後の取り込みがコミット済みのため再開できません", id))
+	}
+
+	cp, err := ingestion.LoadCheckpoint(ctx, db)
+	if err != nil {
+		return nil, rc, nil, withExit(exitDatabase, err)
+	}
+	if err := ingestion.Resume(ctx, db); err != nil {
+		return nil, rc, nil, withExit(exitDatabase, err)
+	}
+	return ingestion, rc, cp, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/batch"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/enrich"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/failure"
+)
+
+// 終了コードです。スケジューラや監視が失敗の種類を区別できるよう、原因ごとに分けます。
+const (
+	exitOK = 0
+	// exitFailure は分類できないエラーやシグナルによる中断です
+	exitFailure = 1
+	// exitConfig は設定・フラグ・環境変数の誤りです（flag パッケージの使い方の誤りと同じ値）
+	exitConfig = 2
+	// exitUpstream は CiNii や書誌情報の提供元の障害・上限による失敗です
+	exitUpstream = 3
+	// exitDatabase はデータベースの接続・書き込みの失敗です
+	exitDatabase = 4
+	// exitPolicy は成功の条件（設定の policy）を満たさなかったことを表します
+	exitPolicy = 5
+	// exitBusy は別のプロセスが実行中（アドバイザリロックを取得できない）のため実行しなかったことを表します
+	exitBusy = 6
+)
+
+// exitCodeName は終了コードの種類の名前です。batch serve の状態に使います。
+func exitCodeName(code int) string {
+	switch code {
+	case exitOK:
+		return "ok"
+	case exitConfig:
+		return "config"
+	case exitUpstream:
+		return "upstream"
+	case exitDatabase:
+		return "database"
+	case exitPolicy:
+		return "policy"
+	case exitBusy:
+		return "busy"
+	default:
+		return "failure"
+	}
+}
+
+// exitError は終了コードを伴うエラーです。
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExit は err に終了コードを付けます。err が nil の場合は nil を返します。
+func withExit(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode は err に付けた終了コードを返します。付いていない場合は exitFailure です。
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
+
+// fatal は err を出力し、err に付けた終了コードで終了します。
+func fatal(err error) {
+	log.Println(err)
+	os.Exit(exitCode(err))
+}
+
+// fatalf はメッセージを出力し、code で終了します。
+func fatalf(code int, format string, v ...any) {
+	log.Printf(format, v...)
+	os.Exit(code)
+}
+
+// pipelineExitCode は batch.Pipeline が中断した理由の終了コードです。
+func pipelineExitCode(err error) int {
+	switch {
+	case errors.Is(err, batch.ErrStore):
+		return exitDatabase
+	case errors.Is(err, batch.ErrUpstream):
+		return exitUpstream
+	default:
+		return exitCode(err)
+	}
+}
+
+// upstreamOutage は外部 API の障害で取り込めなかったかを判定します。
+// CiNii のすべての分類の取得に失敗した場合と、書誌情報の問い合わせがすべて通信エラー・タイムアウト・上限・429・5xx で失敗した場合です。
+func upstreamOutage(s batch.Stats, failures []failure.Attempt) error {
+	if s.Targets > 0 && s.FailedTargets == s.Targets {
+		return fmt.Errorf("CiNii からすべての分類の ISBN を取得できませんでした (%d 分類)", s.Targets)
+	}
+	if s.Lookups == 0 || s.FailedLookups < s.Lookups {
+		return nil
+	}
+	for _, f := range failures {
+		switch f.Class {
+		case enrich.ClassNetwork, enrich.ClassTimeout, enrich.ClassQuotaExceeded, enrich.ClassRateLimited, enrich.ClassServerError:
+		default:
+			return nil
+		}
+	}
+	return fmt.Errorf("書誌情報の問い合わせがすべて外部 API の障害で失敗しました (%d 件)", s.Lookups)
+}
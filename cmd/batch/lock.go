@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
+)
+
+// lockBatch はバッチ・-resume・retry-failed が同時に取り込まないようアドバイザリロックを取得します。
+// 別のプロセスが実行中の場合は exitBusy で終了します。
+// ロックを保持するコネクションが切れた場合は、別のプロセスと重ならないよう ctx をキャンセルして中断します。
+func lockBatch(ctx context.Context, db *sql.DB, cancel context.CancelCauseFunc) (unlock func()) {
+	lock, ok, err := database.TryAdvisoryLock(ctx, db, database.BatchLockKey)
+	if err != nil {
+		fatal(withExit(exitDatabase, err))
+	}
+	if !ok {
+		fatalf(exitBusy, "別のプロセスがバッチを実行中のため終了します")
+	}
+
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel(withExit(exitDatabase, errors.New("アドバイザリロックを保持するDBコネクションが切れました")))
+		case <-ctx.Done():
+		}
+	}()
+	return lock.Unlock
+}
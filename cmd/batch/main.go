@@ -2,181 +2,521 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/batch"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/cinii"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/enrich"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
-	"github.com/taiki-umetsu/ndc007-bookpicker/internal/googlebooks"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata/providers"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/failure"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndc"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndlsearch"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
 
 	_ "github.com/lib/pq"
 )
 
-const (
-	ciniiFetchCount     = 10
-	bulkInsertChunkSize = 10
-	yearFrom            = 2020
-)
-
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "runs":
+			runsCommand(os.Args[2:])
+			return
+		case "retry-failed":
+			retryFailedCommand(os.Args[2:])
+			return
+		case "serve":
+			serveCommand(os.Args[2:])
+			return
+		}
+	}
+
 	startTime := time.Now()
 
+	incremental := flag.Bool("incremental", false, "TRUNCATE せずに ISBN 単位で差分登録する")
+	verifyNDC := flag.Bool("verify-ndc", false, "NDL サーチの NDC 分類と CiNii の分類を照合し、不一致を警告する")
+	workers := flag.Int("workers", enrich.DefaultWorkers, "書誌情報を同時に問い合わせるワーカー数")
+	pruneMissed := flag.Int("prune-missed", 0, "指定回数以上連続で取得されなかった書籍を削除する (-incremental 時のみ, 0 で無効)")
+	configPath := flag.String("config", "", "取得対象と取得条件の設定ファイル (YAML/JSON, 省略時は既定の設定)")
+	codes := flag.String("ndc", "", "取得する NDC 分類コード (カンマ区切り, 設定ファイルの targets を置き換える)")
+	count := flag.Int("count", 0, "分類ごとに取得する ISBN の件数 (全分類に適用)")
+	yearFrom := flag.Int("year-from", 0, "出版年の下限 (全分類に適用, 0 で指定なし)")
+	yearTo := flag.Int("year-to", 0, "出版年の上限 (全分類に適用, 0 で指定なし)")
+	sorts := flag.String("sort", "", "CiNii の並び順 (カンマ区切り, 全分類に適用): score, year-asc, year-desc, library-asc, library-desc")
+	chunkSize := flag.Int("chunk-size", 0, "一括登録する件数")
+	dryRunMode := flag.Bool("dry-run", false, "データベースに接続せず、登録する書籍とエラーを JSON Lines で書き出す")
+	outPath := flag.String("out", "-", "-dry-run の書き出し先ファイル (- で標準出力)")
+	reportPath := flag.String("report", "", "実行結果のレポートを JSON で書き出すファイル (- で標準出力, 省略時は書き出さない)")
+	resumeID := flag.Int64("resume", 0, "中断した実行 (実行記録 id) を途中経過から再開する (設定は元の実行のものを使う)")
+	flag.Parse()
+
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	if *resumeID != 0 {
+		for _, name := range resumeFlags {
+			if setFlags[name] {
+				fatalf(exitConfig, "-resume は元の実行の設定で再開するため -%s と併用できません", name)
+			}
+		}
+	}
+
+	if *pruneMissed < 0 {
+		fatalf(exitConfig, "-prune-missed には 0 以上を指定してください: %d", *pruneMissed)
+	}
+	if *workers < 1 {
+		fatalf(exitConfig, "-workers には 1 以上を指定してください: %d", *workers)
+	}
+	if *pruneMissed > 0 && !*incremental {
+		fatalf(exitConfig, "-prune-missed は -incremental と併用してください")
+	}
+	if *dryRunMode && (*incremental || *pruneMissed > 0) {
+		fatalf(exitConfig, "-dry-run は -incremental・-prune-missed と併用できません")
+	}
+	if *dryRunMode && *outPath == "-" && *reportPath == "-" {
+		fatalf(exitConfig, "-dry-run の書き出し先とレポートの両方を標準出力にはできません")
+	}
+
+	// 進捗は標準出力に表示する。-dry-run の書き出しやレポートを標準出力に書き出す場合は、
+	// JSON と混ざらないよう標準エラー出力にする
+	var progress io.Writer = os.Stdout
+	if *reportPath == "-" {
+		progress = os.Stderr
+	}
+	var dryRun *batch.DryRun
+	if *dryRunMode {
+		out := os.Stdout
+		if *outPath == "-" {
+			progress = os.Stderr
+		} else {
+			f, err := os.Create(*outPath)
+			if err != nil {
+				fatalf(exitConfig, "書き出し先ファイルの作成エラー: %v", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		dryRun = batch.NewDryRun(out)
+	}
+
+	// 設定ファイル（または既定の設定）にコマンドラインで指定した値を重ね、起動時に検証する。
+	// -resume では元の実行の設定をデータベースから読み込む
+	var rc runConfig
+	if *resumeID == 0 {
+		cfg := batch.DefaultConfig()
+		if *configPath != "" {
+			var err error
+			if cfg, err = batch.LoadConfig(*configPath); err != nil {
+				fatal(withExit(exitConfig, err))
+			}
+		}
+		var override batch.Override
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "ndc":
+				override.Codes = splitList(*codes)
+			case "count":
+				override.Count = count
+			case "year-from":
+				override.YearFrom = yearFrom
+			case "year-to":
+				override.YearTo = yearTo
+			case "sort":
+				override.Sort = splitList(*sorts)
+			case "chunk-size":
+				override.ChunkSize = chunkSize
+			}
+		})
+		cfg.Apply(override)
+		cfg, err := cfg.Resolve()
+		if err != nil {
+			fatal(withExit(exitConfig, err))
+		}
+		rc = runConfig{Config: cfg, Incremental: *incremental, PruneMissed: *pruneMissed, VerifyNDC: *verifyNDC}
+		printConfig(progress, rc)
+	}
+
 	env.Load()
 
 	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("環境変数 DATABASE_URL が未設定です")
+	if dsn == "" && dryRun == nil {
+		fatalf(exitConfig, "環境変数 DATABASE_URL が未設定です")
 	}
 
 	appid := os.Getenv("CINII_APPID")
 	if appid == "" {
-		log.Fatal("環境変数 CINII_APPID が未設定です")
+		fatalf(exitConfig, "環境変数 CINII_APPID が未設定です")
 	}
 
-	gbKey := os.Getenv("GOOGLE_BOOKS_KEY")
-	if gbKey == "" {
-		log.Fatal("環境変数 GOOGLE_BOOKS_KEY が未設定です")
+	// 外部 API クライアントはすべて ratelimit.Shared() の制限を共有する
+	if err := ratelimit.LoadEnv(); err != nil {
+		fatal(withExit(exitConfig, err))
 	}
 
-	db, err := database.Setup(dsn)
+	provider, err := providers.FromEnv()
 	if err != nil {
-		log.Fatal("DB接続エラー:", err)
+		fatalf(exitConfig, "書誌情報の提供元の設定エラー: %v", err)
 	}
-	defer db.Close()
 
-	err = database.CreateTable(db)
-	if err != nil {
-		log.Fatal("テーブル作成エラー:", err)
-	}
+	// SIGINT/SIGTERM で ctx をキャンセルし、通信中のリクエストや待機中のリトライを止める。
+	// キャンセル後はシグナルの捕捉をやめ、もう一度送れば即座に終了できるようにする
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
 
-	ciniiClient := cinii.NewClient(appid)
-	gbClient := googlebooks.NewClient(gbKey)
-	ctx := context.Background()
+	// ワーカープールが致命的なエラーで止まった場合も ctx をキャンセルし、実行全体を中断する
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
-	// 参考: https://www.ndl.go.jp/jp/data/NDC10code201708.pdf
-	ndcList := []string{
-		"007",     // 情報学．情報科学
-		"007.3*",  // 情報と社会：情報政策，情報倫理
-		"007.6",   // データ処理．情報処理
-		"007.609", // データ管理：データセキュリティ，データマイニング
-		"007.61",  // システム分析．システム設計．システム開発
-		"007.63",  // コンピュータシステム．ソフトウェア．ミドルウェア．アプリケーション
-		"007.64",  // コンピュータプログラミング
+	// -dry-run ではデータベースに一切接続しない
+	var db *sql.DB
+	if dryRun == nil {
+		db, err = database.Setup(dsn)
+		if err != nil {
+			fatalf(exitDatabase, "DB接続エラー: %v", err)
+		}
+		defer db.Close()
+
+		if err := database.CheckVersion(ctx, db); err != nil {
+			fatalf(exitDatabase, "スキーマ確認エラー: %v", err)
+		}
+
+		// 同じ実行を -resume した場合も含め、取り込みは 1 つずつ実行する
+		unlock := lockBatch(ctx, db, cancel)
+		defer unlock()
+
+		// 日次上限は同じ日の retry-failed や再実行と合わせて数える
+		ratelimit.Shared().SetCounter(&ratelimit.PostgresCounter{DB: db})
+	}
+
+	// 実行記録はトランザクションの外に書き込み、ロールバックした実行も残す。
+	// 途中経過 (cp) は読み取り専用のため、ゴルーチンから参照しても構わない
+	var ingestion *run.Run
+	cp := &run.Checkpoint{}
+	if *resumeID != 0 {
+		ingestion, rc, cp, err = resumeRun(ctx, db, *resumeID)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Fprintf(progress, "実行 %d を再開します (取得済みの分類: %d 件, 問い合わせ済みの ISBN: %d 件)\n",
+			ingestion.ID, len(cp.Targets), len(cp.Records))
+		printConfig(progress, rc)
+	} else if dryRun == nil {
+		ingestion, err = run.Start(ctx, db, rc)
+		if err != nil {
+			fatal(withExit(exitDatabase, err))
+		}
+		fmt.Fprintf(progress, "実行記録 id: %d\n", ingestion.ID)
 	}
+	cfg := rc.Config
+
+	// 差分登録ではチャンクごとにコミットし、中断しても登録済みの書籍を残す。
+	// TRUNCATE する場合は全件を 1 つのトランザクションで登録し直す
+	var tx *sql.Tx
+	var store batch.Store
+	if dryRun != nil {
+		fmt.Fprintln(progress, "ドライランで実行します（データベースは変更しません）")
+	} else if rc.Incremental {
+		fmt.Fprintln(progress, "差分登録モードで実行します")
+		store = &batch.PostgresStore{DB: db, Run: ingestion}
+	} else {
+		tx, err = db.BeginTx(ctx, nil)
+		if err != nil {
+			finishIngestion(ctx, db, ingestion, run.StatusRolledBack, err)
+			fatalf(exitDatabase, "トランザクション開始エラー: %v", err)
+		}
+		defer tx.Rollback()
 
-	baf := len(ndcList) * ciniiFetchCount
-	isbnCh := make(chan string, baf)
-	bookCh := make(chan *book.Book, baf)
-	errChan := make(chan error)
+		if _, err := tx.ExecContext(ctx, "TRUNCATE TABLE books CASCADE"); err != nil {
+			tx.Rollback()
+			finishIngestion(ctx, db, ingestion, run.StatusRolledBack, err)
+			fatalf(exitDatabase, "TRUNCATEエラー: %v", err)
+		}
+		fmt.Fprintln(progress, "books テーブルを TRUNCATE しました")
+		store = &batch.PostgresStore{DB: db, Run: ingestion, Tx: tx}
+	}
 
-	tx, txErr := db.BeginTx(ctx, nil)
-	if txErr != nil {
-		log.Fatalf("トランザクション開始エラー: %v", txErr)
+	if rc.VerifyNDC {
+		provider = ndcFiller{Provider: provider, ndl: ndlsearch.NewClient()}
 	}
-	defer tx.Rollback()
 
-	_, err = tx.ExecContext(ctx, "TRUNCATE TABLE books")
-	if err != nil {
-		tx.Rollback()
-		log.Fatalf("TRUNCATEエラー: %v", err)
-	}
-	fmt.Println("books テーブルを TRUNCATE しました")
-
-	// エラーチャネルを監視するゴルーチン
-	go func() {
-		for err := range errChan {
-			log.Println("エラー:", err)
-		}
-	}()
-
-	// 1. CiNii から ISBN を取得するゴルーチン
-	go func() {
-		defer close(isbnCh)
-		seen := make(map[string]struct{})
-		for _, ndc := range ndcList {
-			fmt.Printf("\nfetch from CiNii 分類コード: %s\n", ndc)
-			isbns, fetchErr := ciniiClient.FetchRandomISBNs(ndc, yearFrom, ciniiFetchCount)
-			if fetchErr != nil {
-				errChan <- fmt.Errorf("CiNii ISBN 取得エラー (%s): %w", ndc, fetchErr)
-				continue
+	// 1〜3. CiNii からの ISBN の取得、書誌情報の問い合わせ、チャンクごとの登録
+	pipeline := &batch.Pipeline{
+		Config:     cfg,
+		Fetcher:    cinii.NewClient(appid),
+		Provider:   provider,
+		Workers:    *workers,
+		Store:      store,
+		Checkpoint: cp,
+		Progress:   progress,
+	}
+	if dryRun != nil {
+		pipeline.OnError = func(isbn string, err error) {
+			if werr := dryRun.WriteError(isbn, err); werr != nil {
+				log.Println(werr)
 			}
-			for _, isbn := range isbns {
-				if _, ok := seen[isbn]; !ok {
-					isbnCh <- isbn
-					seen[isbn] = struct{}{}
-				}
+		}
+	}
+	res, interrupted := pipeline.Run(ctx)
+	ratelimit.Shared().LogUsage()
+
+	finishRun := func(status run.Status, cause error) {
+		if ingestion == nil {
+			return
+		}
+		ingestion.Discovered = res.Discovered
+		ingestion.Enriched = res.Enriched
+		ingestion.Failed = res.Failed()
+		ingestion.Inserted = res.Inserted
+
+		finishIngestion(ctx, db, ingestion, status, cause)
+	}
+
+	report := batch.NewReport(startTime)
+	report.Config = rc
+	if ingestion != nil {
+		report.RunID = ingestion.ID
+	}
+	res.Fill(report)
+	writeReport := func(status string, code int, cause error) {
+		if *reportPath == "" {
+			return
+		}
+		report.Finish(status, code, cause, time.Now())
+		if err := report.WriteFile(*reportPath); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// abort はトランザクションをロールバックして実行記録に結果を書き込み、code で終了します
+	abort := func(status run.Status, cause error, code int, msg string) {
+		if tx != nil {
+			if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+				log.Printf("ロールバックエラー: %v", err)
 			}
 		}
-	}()
-
-	// 2. Google Books API から書籍情報を取得するゴルーチン
-	go func() {
-		defer close(bookCh)
-		for isbn := range isbnCh {
-			fmt.Printf("fetch from Google isbn: %s\n", isbn)
-			gbInfo, gbErr := gbClient.Fetch(isbn)
-			fmt.Println(gbInfo)
-			if gbErr != nil {
-				errChan <- fmt.Errorf("google books API 取得エラー (isbn: %s): %w", isbn, gbErr)
-				continue
+		finishRun(status, cause)
+		writeReport(string(status), code, cause)
+		fatalf(code, "%s: %v (経過時間: %s)", msg, cause, time.Since(startTime))
+	}
+
+	// 取得できなかった ISBN は batch retry-failed で再処理できるよう、トランザクションの外に記録する
+	failures := res.Failures
+	if dryRun == nil && len(failures) > 0 {
+		for i := range failures {
+			failures[i].NDC = res.NDCByISBN[failures[i].ISBN]
+		}
+		recordCtx, cancelRecord := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		gaveUp, err := failure.Record(recordCtx, db, failures, failure.DefaultMaxAttempts, time.Now())
+		if err != nil {
+			log.Printf("取得できなかった ISBN の記録エラー: %v", err)
+		} else {
+			fmt.Fprintf(progress, "取得できなかった ISBN を記録しました: %d 件 (再処理を諦めた ISBN: %d 件)\n", len(failures), gaveUp)
+			// 再開時に試行回数を重ねて数えないよう、記録済みであることを途中経過に残す
+			isbns := make([]string, len(failures))
+			for i, f := range failures {
+				isbns[i] = f.ISBN
 			}
-			bookCh <- book.NewBook(
-				isbn,
-				gbInfo.Title,
-				gbInfo.Subtitle,
-				gbInfo.Authors,
-				gbInfo.Publisher,
-				gbInfo.PublishedDate,
-				gbInfo.Description,
-				gbInfo.InfoLink,
-				gbInfo.ImageLinks.Thumbnail,
-			)
-		}
-	}()
-
-	// 3. 書籍情報をチャンクごとにバルクインサート
-	insertedCnt := 0
-	var bookChunk []*book.Book
-	for b := range bookCh {
-		bookChunk = append(bookChunk, b)
-		if len(bookChunk) >= bulkInsertChunkSize {
-			cnt, err := book.BulkInsert(ctx, tx, bookChunk)
-			if err != nil {
-				errChan <- fmt.Errorf("チャンクのバルクインサートエラー: %w", err)
-			} else {
-				fmt.Printf("チャンクのバルクインサート完了: %d 件\n", cnt)
-				insertedCnt += cnt
+			if err := ingestion.MarkFailuresRecorded(recordCtx, db, isbns); err != nil {
+				log.Println(err)
+			}
+		}
+		cancelRecord()
+	}
+
+	// 中断された場合は途中経過を残し、-resume で再開できるようにする。
+	// TRUNCATE する場合は途中までの登録をすべて破棄し、差分登録ではコミット済みのチャンクを残す
+	if interrupted != nil {
+		msg := "中断しました"
+		if ingestion != nil {
+			msg = fmt.Sprintf("中断しました (batch -resume %d で再開できます)", ingestion.ID)
+		}
+		abort(run.StatusInterrupted, interrupted, pipelineExitCode(interrupted), msg)
+	}
+
+	stats := res.Stats()
+
+	// 差分登録でチャンクをコミット済みの場合は、書籍が変わったことが分かるようロールバックと区別して記録する
+	failedStatus := run.StatusRolledBack
+	if rc.Incremental && res.Inserted > 0 {
+		failedStatus = run.StatusPartial
+	}
+
+	// 外部 API の障害で取り込めなかった場合は、成功の条件より先に判定する
+	if err := upstreamOutage(stats, failures); err != nil {
+		abort(failedStatus, err, exitUpstream, "外部 API の障害のため登録をコミットしません")
+	}
+
+	// -dry-run では登録する代わりに書籍を書き出し、件数の内訳を表示して終了する
+	if dryRun != nil {
+		for _, rec := range res.Records {
+			b := rec.Book()
+			b.NDC = res.NDCByISBN[rec.ISBN]
+			if err := dryRun.WriteBook(b, rec.Source); err != nil {
+				log.Fatal(err)
 			}
-			bookChunk = nil
 		}
+		dryRun.WriteSummary(progress)
+		writeReport(batch.ReportStatusDryRun, exitOK, nil)
+		log.Printf("[complete] バッチ処理時間: %s", time.Since(startTime))
+		return
+	}
+
+	// 成功の条件を満たさない場合はコミットしない。差分登録ではコミット済みのチャンクは残るが、
+	// 取得されなかった書籍の記録や削除は行わない
+	if err := cfg.Policy.Check(stats); err != nil {
+		msg := "登録をコミットしません"
+		if failedStatus == run.StatusPartial {
+			msg = "仕上げの処理を行いません (コミット済みのチャンクは残ります)"
+		}
+		abort(failedStatus, err, exitPolicy, msg)
 	}
-	if len(bookChunk) > 0 {
-		cnt, err := book.BulkInsert(ctx, tx, bookChunk)
+
+	// 差分登録ではチャンクをコミット済みのため、仕上げの処理を新しいトランザクションで行う
+	finalizeStart := time.Now()
+	if rc.Incremental {
+		tx, err = db.BeginTx(ctx, nil)
 		if err != nil {
-			errChan <- fmt.Errorf("残りのチャンクのバルクインサートエラー: %w", err)
-		} else {
-			fmt.Printf("残りのチャンクのバルクインサート完了: %d 件\n", cnt)
-			insertedCnt += cnt
+			abort(failedStatus, err, exitDatabase, "トランザクション開始エラー")
 		}
+		defer tx.Rollback()
 	}
 
-	close(errChan)
+	// 仕上げの処理に失敗した場合は、登録と整合しない状態を残さないようロールバックする
+	var finishErrs []error
 
-	if insertedCnt > 0 {
-		if err := tx.Commit(); err != nil {
-			log.Fatalf("コミットエラー: %v", err)
-		} else {
-			fmt.Printf("%d 件保存しました\n", insertedCnt)
-			fmt.Println("トランザクションをコミットしました")
+	// 4. 書籍ごとの NDC 分類コードを登録
+	// 提供元（NDL サーチなど）の分類が CiNii の検索分類と関連しない書籍は警告する
+	for _, isbn := range res.Stored {
+		if codes, ok := res.SourceNDC[isbn]; ok && !ndcRelated(res.NDCByISBN[isbn], codes) {
+			log.Printf("警告: NDC 分類の不一致 (isbn: %s): CiNii %v, 書誌情報 %v", isbn, res.NDCByISBN[isbn], codes)
 		}
+	}
+	stored := make(map[string][]string, len(res.Stored))
+	for _, isbn := range res.Stored {
+		stored[isbn] = res.NDCByISBN[isbn]
+	}
+	if cnt, err := book.SaveNDC(ctx, tx, stored); err != nil {
+		finishErrs = append(finishErrs, err)
 	} else {
-		log.Println("トランザクションをロールバックしました")
+		fmt.Fprintf(progress, "NDC分類の登録完了: %d 件\n", cnt)
+	}
+
+	// 5. 差分登録時は今回取得されなかった書籍を記録し、必要なら削除
+	if rc.Incremental {
+		if cnt, err := book.MarkMissed(ctx, tx, res.Stored); err != nil {
+			finishErrs = append(finishErrs, err)
+		} else {
+			fmt.Fprintf(progress, "今回取得されなかった書籍: %d 件\n", cnt)
+		}
+
+		if rc.PruneMissed > 0 {
+			if cnt, err := book.PruneMissed(ctx, tx, rc.PruneMissed); err != nil {
+				finishErrs = append(finishErrs, err)
+			} else {
+				fmt.Fprintf(progress, "%d 回以上取得されなかった書籍を削除しました: %d 件\n", rc.PruneMissed, cnt)
+			}
+		}
+	}
+
+	// 今回取得できた ISBN は再処理の対象から外す
+	if cnt, err := failure.Delete(ctx, tx, res.Stored); err != nil {
+		finishErrs = append(finishErrs, err)
+	} else if cnt > 0 {
+		fmt.Fprintf(progress, "再処理の対象から外した ISBN: %d 件\n", cnt)
+	}
+
+	// 途中経過はコミットと同じトランザクションで削除する
+	if err := ingestion.ClearCheckpoint(ctx, tx); err != nil {
+		finishErrs = append(finishErrs, err)
+	}
+
+	if err := errors.Join(finishErrs...); err != nil {
+		abort(failedStatus, err, exitDatabase, "登録の仕上げに失敗したためロールバックしました")
+	}
+	if err := tx.Commit(); err != nil {
+		abort(failedStatus, err, exitDatabase, "コミットエラー")
 	}
+	finishRun(run.StatusCommitted, nil)
+	fmt.Fprintf(progress, "%d 件保存しました\n", res.Inserted)
+	fmt.Fprintln(progress, "トランザクションをコミットしました")
+	report.AddTiming(batch.StageFinalize, time.Since(finalizeStart))
+	writeReport(string(run.StatusCommitted), exitOK, nil)
 
 	elapsedTime := time.Since(startTime)
 	log.Printf("[complete] バッチ処理時間: %s", elapsedTime)
 }
+
+// printConfig は実行時の設定を表示します。
+func printConfig(w io.Writer, rc runConfig) {
+	fmt.Fprintln(w, "実行時の設定:")
+	if err := rc.WriteYAML(w); err != nil {
+		log.Fatal(err)
+	}
+	if rc.Incremental {
+		fmt.Fprintf(w, "差分登録: true (prune-missed: %d)\n", rc.PruneMissed)
+	}
+}
+
+// ndcFiller は書誌情報に NDC 分類がない場合に NDL サーチで補います。
+// NDL サーチの取得に失敗しても書誌情報はそのまま返します。
+type ndcFiller struct {
+	metadata.Provider
+	ndl *ndlsearch.Client
+}
+
+func (f ndcFiller) Prefetch(ctx context.Context, isbns []string) error {
+	return metadata.Prefetch(ctx, f.Provider, isbns)
+}
+
+func (f ndcFiller) Lookup(ctx context.Context, isbn string) (*metadata.Record, error) {
+	rec, err := f.Provider.Lookup(ctx, isbn)
+	if err != nil || len(rec.NDC) > 0 {
+		return rec, err
+	}
+
+	ndlRec, err := f.ndl.Lookup(ctx, isbn)
+	if err == nil {
+		rec.NDC = ndlRec.NDC
+	} else if ctx.Err() == nil && !errors.Is(err, metadata.ErrNotFound) {
+		log.Printf("NDL サーチ取得エラー (isbn: %s): %v", isbn, err)
+	}
+	return rec, nil
+}
+
+// ndcRelated は a と b に関連する分類コードの組があるかを返します。
+func ndcRelated(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if ndc.Related(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitList はカンマ区切りの値を空白を除いて分割します。
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/batch"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/enrich"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata/providers"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/failure"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+const defaultRetryLimit = 100
+
+// retryConfig は retry-failed の実行記録に保存する設定です。
+type retryConfig struct {
+	Command     string `json:"command"`
+	MaxAttempts int    `json:"maxAttempts"`
+	Limit       int    `json:"limit"`
+	Workers     int    `json:"workers"`
+}
+
+// retryFailedCommand は failed_enrichments のうち再処理の時刻を過ぎた ISBN の書誌情報を取得し直し、
+// 取得できた書籍を差分登録します。再び失敗した ISBN は試行回数を増やし、上限に達したら諦めます。
+func retryFailedCommand(args []string) {
+	startTime := time.Now()
+
+	fs := flag.NewFlagSet("retry-failed", flag.ExitOnError)
+	maxAttempts := fs.Int("max-attempts", failure.DefaultMaxAttempts, "この回数失敗した ISBN は再処理を諦める")
+	limit := fs.Int("limit", defaultRetryLimit, "1 回に再処理する ISBN の上限")
+	workers := fs.Int("workers", enrich.DefaultWorkers, "書誌情報を同時に問い合わせるワーカー数")
+	fs.Parse(args)
+
+	if *maxAttempts < 1 {
+		fatalf(exitConfig, "-max-attempts には 1 以上を指定してください: %d", *maxAttempts)
+	}
+	if *limit < 1 {
+		fatalf(exitConfig, "-limit には 1 以上を指定してください: %d", *limit)
+	}
+	if *workers < 1 {
+		fatalf(exitConfig, "-workers には 1 以上を指定してください: %d", *workers)
+	}
+
+	env.Load()
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		fatalf(exitConfig, "環境変数 DATABASE_URL が未設定です")
+	}
+
+	if err := ratelimit.LoadEnv(); err != nil {
+		fatal(withExit(exitConfig, err))
+	}
+
+	provider, err := providers.FromEnv()
+	if err != nil {
+		fatalf(exitConfig, "書誌情報の提供元の設定エラー: %v", err)
+	}
+
+	db, err := database.Setup(dsn)
+	if err != nil {
+		fatalf(exitDatabase, "DB接続エラー: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if err := database.CheckVersion(ctx, db); err != nil {
+		fatalf(exitDatabase, "スキーマ確認エラー: %v", err)
+	}
+
+	// 通常の実行と同時に同じ ISBN を登録しないよう、取り込みは 1 つずつ実行する
+	unlock := lockBatch(ctx, db, cancel)
+	defer unlock()
+
+	// 日次上限は同じ日のバッチと合わせて数える
+	ratelimit.Shared().SetCounter(&ratelimit.PostgresCounter{DB: db})
+
+	due, err := failure.Due(ctx, db, time.Now(), *limit)
+	if err != nil {
+		fatal(withExit(exitDatabase, err))
+	}
+	if len(due) == 0 {
+		fmt.Println("再処理の対象の ISBN はありません")
+		return
+	}
+	fmt.Printf("再処理する ISBN: %d 件\n", len(due))
+
+	ingestion, err := run.Start(ctx, db, retryConfig{
+		Command:     "retry-failed",
+		MaxAttempts: *maxAttempts,
+		Limit:       *limit,
+		Workers:     *workers,
+	})
+	if err != nil {
+		fatal(withExit(exitDatabase, err))
+	}
+	fmt.Printf("実行記録 id: %d\n", ingestion.ID)
+
+	// ndcByISBN は読み取り専用のため、ワーカーから参照しても構わない
+	ndcByISBN := make(map[string][]string, len(due))
+	isbns := make([]string, len(due))
+	isbnCh := make(chan string, len(due))
+	for i, f := range due {
+		ndcByISBN[f.ISBN] = f.NDC
+		isbns[i] = f.ISBN
+		isbnCh <- f.ISBN
+	}
+	close(isbnCh)
+
+	// まとめて取得できる提供元（openBD）は 1 回のリクエストで取得し、失敗した場合は 1 件ずつ問い合わせる
+	if err := metadata.Prefetch(ctx, provider, isbns); err != nil && ctx.Err() == nil {
+		log.Printf("書誌情報の一括取得エラー: %v", err)
+	}
+
+	var failuresMu sync.Mutex
+	var failures []failure.Attempt
+	recordCh := make(chan *metadata.Record, len(due))
+	pool := &enrich.Pool{
+		Provider: provider,
+		Workers:  *workers,
+		OnError: func(isbn string, err error) {
+			log.Printf("書誌情報取得エラー (isbn: %s): %v", isbn, err)
+			failuresMu.Lock()
+			failures = append(failures, failure.Attempt{ISBN: isbn, NDC: ndcByISBN[isbn], Class: enrich.Classify(err), Err: err})
+			failuresMu.Unlock()
+		},
+	}
+	go func() {
+		defer close(recordCh)
+		if err := pool.Run(ctx, isbnCh, recordCh); err != nil {
+			cancel(withExit(exitUpstream, err))
+		}
+	}()
+
+	var books []*book.Book
+	for rec := range recordCh {
+		fmt.Printf("取得元: %s, isbn: %s, タイトル: %s\n", rec.Source, rec.ISBN, rec.Title)
+		books = append(books, rec.Book())
+	}
+
+	ratelimit.Shared().LogUsage()
+	ingestion.Enriched = len(books)
+	ingestion.Failed = len(failures)
+
+	// 中断された場合は、取得できた書籍も失敗も記録せず次回に持ち越す
+	if ctx.Err() != nil {
+		cause := context.Cause(ctx)
+		finishIngestion(ctx, db, ingestion, run.StatusRolledBack, cause)
+		fatalf(exitCode(cause), "中断しました: %v (経過時間: %s)", cause, time.Since(startTime))
+	}
+
+	gaveUp, err := failure.Record(ctx, db, failures, *maxAttempts, time.Now())
+	if err != nil {
+		log.Printf("再処理の結果の記録エラー: %v", err)
+	}
+
+	// すべて外部 API の障害で失敗した場合は、スケジューラが区別できるよう exitUpstream で終了する
+	stats := batch.Stats{Lookups: len(due), FailedLookups: len(failures)}
+	if err := upstreamOutage(stats, failures); err != nil {
+		finishIngestion(ctx, db, ingestion, run.StatusRolledBack, err)
+		fatalf(exitUpstream, "%v (経過時間: %s)", err, time.Since(startTime))
+	}
+
+	if len(books) == 0 {
+		finishIngestion(ctx, db, ingestion, run.StatusRolledBack, errors.New("再処理で取得できた書籍がありません"))
+	} else {
+		inserted, err := saveRetried(ctx, db, books, ndcByISBN)
+		if err != nil {
+			finishIngestion(ctx, db, ingestion, run.StatusRolledBack, err)
+			fatal(withExit(exitDatabase, err))
+		}
+		ingestion.Inserted = inserted
+		finishIngestion(ctx, db, ingestion, run.StatusCommitted, nil)
+	}
+
+	fmt.Printf("再処理の結果: 取得 %d 件, 失敗 %d 件 (再処理を諦めた ISBN: %d 件)\n", len(books), len(failures), gaveUp)
+	log.Printf("[complete] 再処理時間: %s", time.Since(startTime))
+}
+
+// saveRetried は取得できた書籍と NDC 分類を差分登録し、再処理の対象から外します。
+func saveRetried(ctx context.Context, db *sql.DB, books []*book.Book, ndcByISBN map[string][]string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("トランザクション開始エラー: %w", err)
+	}
+	defer tx.Rollback()
+
+	inserted, err := book.BulkUpsert(ctx, tx, books)
+	if err != nil {
+		return 0, fmt.Errorf("バルクインサートエラー: %w", err)
+	}
+
+	stored := make(map[string][]string, len(books))
+	isbns := make([]string, len(books))
+	for i, b := range books {
+		stored[b.ISBN] = ndcByISBN[b.ISBN]
+		isbns[i] = b.ISBN
+	}
+	if _, err := book.SaveNDC(ctx, tx, stored); err != nil {
+		return 0, err
+	}
+	if _, err := failure.Delete(ctx, tx, isbns); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("コミットエラー: %w", err)
+	}
+	fmt.Printf("%d 件保存しました\n", inserted)
+	return inserted, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
+)
+
+const runsUsage = "使い方: batch runs list [-limit N] [-status running|committed|rolled_back|interrupted|partial] | batch runs show <id>"
+
+// runsCommand はバッチの実行記録を表示します。
+func runsCommand(args []string) {
+	if len(args) < 1 {
+		fatalf(exitConfig, runsUsage)
+	}
+
+	env.Load()
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		fatalf(exitConfig, "環境変数 DATABASE_URL が未設定です")
+	}
+
+	db, err := database.Setup(dsn)
+	if err != nil {
+		fatalf(exitDatabase, "DB接続エラー: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := database.CheckVersion(ctx, db); err != nil {
+		fatalf(exitDatabase, "スキーマ確認エラー: %v", err)
+	}
+	repo := repository.NewPostgresRunRepository(db)
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("runs list", flag.ExitOnError)
+		limit := fs.Int("limit", repository.DefaultRunLimit, "表示する件数")
+		status := fs.String("status", "", "指定した結果の実行のみ表示する")
+		fs.Parse(args[1:])
+
+		runs, err := repo.List(ctx, repository.RunListParams{Limit: *limit, Status: run.Status(*status)})
+		if err != nil {
+			fatalf(runsExitCode(err), "実行記録取得エラー: %v", err)
+		}
+		fmt.Printf("%6s  %-19s  %-11s  %10s  %6s  %6s  %6s  %6s\n",
+			"ID", "開始", "結果", "所要時間", "発見", "取得", "失敗", "登録")
+		for _, rn := range runs {
+			fmt.Printf("%6d  %-19s  %-11s  %10s  %6d  %6d  %6d  %6d\n",
+				rn.ID, rn.StartedAt.Format(time.DateTime), rn.Status, formatDuration(rn),
+				totalDiscovered(rn), rn.Enriched, rn.Failed, rn.Inserted)
+		}
+
+	case "show":
+		if len(args) < 2 {
+			fatalf(exitConfig, runsUsage)
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fatalf(exitConfig, "id には整数を指定してください: %s", args[1])
+		}
+		rn, err := repo.Get(ctx, id)
+		if err != nil {
+			fatalf(runsExitCode(err), "実行記録取得エラー (id: %d): %v", id, err)
+		}
+		printRun(rn)
+
+	default:
+		fatalf(exitConfig, runsUsage)
+	}
+}
+
+// runsExitCode は実行記録の取得エラーの終了コードです。指定の誤りとデータベースの失敗を区別します。
+func runsExitCode(err error) int {
+	if errors.Is(err, repository.ErrRunNotFound) || errors.Is(err, repository.ErrInvalidCount) {
+		return exitConfig
+	}
+	return exitDatabase
+}
+
+// finishIngestion は実行記録に結果を書き込みます。
+// 中断された場合も記録できるよう、ctx のキャンセルを引き継ぎません。
+func finishIngestion(ctx context.Context, db *sql.DB, ingestion *run.Run, status run.Status, cause error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := ingestion.Finish(ctx, db, status, cause); err != nil {
+		log.Println(err)
+	}
+}
+
+func printRun(rn *run.Run) {
+	fmt.Printf("ID:       %d\n", rn.ID)
+	fmt.Printf("結果:     %s\n", rn.Status)
+	fmt.Printf("開始:     %s\n", rn.StartedAt.Format(time.DateTime))
+	if rn.FinishedAt != nil {
+		fmt.Printf("終了:     %s (所要時間: %s)\n", rn.FinishedAt.Format(time.DateTime), formatDuration(rn))
+	} else {
+		fmt.Println("終了:     -")
+	}
+	if rn.Error != "" {
+		fmt.Printf("エラー:   %s\n", rn.Error)
+	}
+	fmt.Printf("書誌情報: 取得 %d 件, 失敗 %d 件\n", rn.Enriched, rn.Failed)
+	fmt.Printf("登録:     %d 件\n", rn.Inserted)
+
+	fmt.Printf("CiNii で見つかった ISBN: %d 件\n", totalDiscovered(rn))
+	for _, code := range slices.Sorted(maps.Keys(rn.Discovered)) {
+		fmt.Printf("  %-10s %d 件\n", code, rn.Discovered[code])
+	}
+
+	var config bytes.Buffer
+	if err := json.Indent(&config, rn.Config, "", "  "); err != nil {
+		config.Write(rn.Config)
+	}
+	fmt.Printf("設定:\n%s\n", config.String())
+}
+
+func totalDiscovered(rn *run.Run) int {
+	total := 0
+	for _, n := range rn.Discovered {
+		total += n
+	}
+	return total
+}
+
+func formatDuration(rn *run.Run) string {
+	if rn.FinishedAt == nil {
+		return "-"
+	}
+	return rn.Duration().Round(time.Second).String()
+}
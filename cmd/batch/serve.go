@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/batch"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/redact"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/schedule"
+)
+
+const serveUsage = `使い方: batch serve -schedule "0 3 * * *" [-jitter 10m] [-addr :8081] [-shutdown-timeout 1m] [-- バッチのフラグ...]`
+
+// スケジュール実行の結果です。終了コードの種類に加え、別のプロセスが実行中で見送った場合（exitBusy）は skipped です。
+const (
+	resultRunning = "running"
+	resultSkipped = "skipped"
+)
+
+// scheduledRun はスケジュール実行 1 回分の状態です。
+type scheduledRun struct {
+	ScheduledAt time.Time  `json:"scheduledAt"`
+	StartedAt   time.Time  `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	// Result は running・skipped または終了コードの種類（ok, failure, config, upstream, database, policy）です
+	Result   string `json:"result"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	// RunID・Status・Inserted はバッチが書き出したレポートの値です
+	RunID    int64  `json:"runId,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Inserted int    `json:"inserted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// serveStatus は /status で返すスケジューラの状態です。
+type serveStatus struct {
+	mu       sync.Mutex
+	Schedule string        `json:"schedule"`
+	Jitter   string        `json:"jitter"`
+	Running  *scheduledRun `json:"running,omitempty"`
+	LastRun  *scheduledRun `json:"lastRun,omitempty"`
+	NextRun  *time.Time    `json:"nextRun,omitempty"`
+}
+
+func (s *serveStatus) setNext(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.NextRun = &t
+}
+
+// start は実行中の状態を記録します。r は記録後も書き換えるため、コピーを保持します。
+func (s *serveStatus) start(r scheduledRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Running = &r
+	s.NextRun = nil
+}
+
+func (s *serveStatus) finish(r *scheduledRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Running = nil
+	s.LastRun = r
+}
+
+func (s *serveStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		log.Printf("状態の書き出しエラー: %v", err)
+	}
+}
+
+// serveCommand は cron 式の時刻ごとにバッチを子プロセスとして実行し続けます。
+// 複数のレプリカや手動の実行と重ならないよう、バッチ自身がアドバイザリロックを取得し、取得できない回は見送ります。
+// -- の後に指定したフラグは各回のバッチにそのまま渡します。
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	expr := fs.String("schedule", "", "実行する時刻の cron 式 (分 時 日 月 曜日, @daily などの省略形も可)")
+	jitter := fs.Duration("jitter", 0, "実行を遅らせる最大の時間 (0 から指定値までのランダムな時間だけ遅らせる)")
+	addr := fs.String("addr", ":8081", "状態を返す HTTP サーバーのアドレス (空で起動しない)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", time.Minute, "終了時に実行中のバッチの中断を待つ時間")
+	fs.Parse(args)
+
+	if *expr == "" {
+		fatalf(exitConfig, serveUsage)
+	}
+	cron, err := schedule.Parse(*expr)
+	if err != nil {
+		fatal(withExit(exitConfig, err))
+	}
+	if *jitter < 0 || *shutdownTimeout < 0 {
+		fatalf(exitConfig, "-jitter・-shutdown-timeout には 0 以上を指定してください")
+	}
+
+	// 結果を読み取るため、レポートの書き出し先はスケジューラが指定する
+	batchArgs := fs.Args()
+	for _, a := range batchArgs {
+		name, _, _ := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if strings.HasPrefix(a, "-") && slices.Contains([]string{"report", "resume", "dry-run"}, name) {
+			fatalf(exitConfig, "batch serve では -%s を指定できません", name)
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf(exitFailure, "実行ファイルのパス取得エラー: %v", err)
+	}
+
+	// SIGINT/SIGTERM で新しい実行を止め、実行中のバッチには SIGTERM を送って中断を待つ。
+	// キャンセル後はシグナルの捕捉をやめ、もう一度送れば即座に終了できるようにする
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	status := &serveStatus{Schedule: cron.String(), Jitter: jitter.String()}
+
+	var srv *http.Server
+	if *addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /status", status)
+		srv = &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("状態の HTTP サーバーのエラー: %v", err)
+			}
+		}()
+		log.Printf("状態を http://%s/status で返します", *addr)
+	}
+
+	log.Printf("スケジュール %q でバッチを実行します (jitter: %s)", cron, *jitter)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for {
+		next := cron.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("スケジュール %q に一致する時刻がありません", cron)
+			break
+		}
+		at := next.Add(schedule.Jitter(rng, *jitter))
+		status.setNext(at)
+		log.Printf("次の実行: %s", at.Format(time.DateTime))
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+			runScheduled(ctx, status, exe, batchArgs, at, *shutdownTimeout)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if srv != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("状態の HTTP サーバーの終了エラー: %v", err)
+		}
+	}
+	log.Println("スケジューラを終了しました")
+}
+
+// runScheduled はバッチを 1 回実行し、結果を status に記録します。
+// ctx がキャンセルされるとバッチに SIGTERM を送り、shutdownTimeout 後も終了しなければ強制終了します。
+func runScheduled(ctx context.Context, status *serveStatus, exe string, args []string, scheduledAt time.Time, shutdownTimeout time.Duration) {
+	r := &scheduledRun{ScheduledAt: scheduledAt, StartedAt: time.Now(), Result: resultRunning}
+	status.start(*r)
+	defer func() {
+		now := time.Now()
+		r.FinishedAt = &now
+		status.finish(r)
+		log.Printf("スケジュール実行の結果: %s (実行記録 id: %d, 登録: %d 件)", r.Result, r.RunID, r.Inserted)
+	}()
+
+	report, err := os.CreateTemp("", "batch-report-*.json")
+	if err != nil {
+		r.Result = exitCodeName(exitFailure)
+		r.Error = fmt.Sprintf("レポートファイルの作成エラー: %v", err)
+		return
+	}
+	report.Close()
+	defer os.Remove(report.Name())
+
+	cmd := exec.CommandContext(ctx, exe, append([]string{"-report", report.Name()}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = shutdownTimeout
+
+	log.Printf("バッチを実行します: %s %s", filepath.Base(exe), strings.Join(cmd.Args[1:], " "))
+	err = cmd.Run()
+	if cmd.ProcessState == nil {
+		r.Result = exitCodeName(exitFailure)
+		r.Error = fmt.Sprintf("バッチの起動エラー: %v", err)
+		return
+	}
+	code := cmd.ProcessState.ExitCode()
+	r.ExitCode = &code
+	r.Result = exitCodeName(code)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	// バッチがアドバイザリロックを取得できなかった場合は、取り込まずに終了している
+	if code == exitBusy {
+		r.Result = resultSkipped
+		r.Error = "別のプロセスがバッチを実行中のため見送りました"
+		return
+	}
+
+	// 設定の誤りなどでレポートを書き出す前に終了した場合は、レポートの値を記録しない
+	if rep, err := readReport(report.Name()); err == nil {
+		r.RunID = rep.RunID
+		r.Status = rep.Status
+		r.Inserted = rep.Inserted
+		if rep.Error != "" {
+			// /status は認証なしで返すため、外部 API の URL のクエリ文字列を除く
+			r.Error = redact.URLs(rep.Error)
+		}
+	}
+}
+
+func readReport(path string) (*batch.Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rep batch.Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
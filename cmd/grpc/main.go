@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/grpcserver"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
 	"google.golang.org/grpc"
 )
 
@@ -27,13 +29,17 @@ func main() {
 	}
 	defer db.Close()
 
+	if err := database.CheckVersion(context.Background(), db); err != nil {
+		log.Fatal("スキーマ確認エラー:", err)
+	}
+
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
 	s := grpc.NewServer()
-	pb.RegisterBookServiceServer(s, grpcserver.NewBookServiceServer(db))
+	pb.RegisterBookServiceServer(s, grpcserver.NewBookServiceServer(repository.NewPostgresBookRepository(db)))
 
 	log.Println("gRPC server listening on :50051")
 	if err := s.Serve(lis); err != nil {
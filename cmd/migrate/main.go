@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
+)
+
+const usage = "使い方: migrate up | down [steps] | status"
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	env.Load()
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		log.Fatal("環境変数 DATABASE_URL が未設定です")
+	}
+
+	db, err := database.Setup(dsn)
+	if err != nil {
+		log.Fatal("DB接続エラー:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "up":
+		n, err := database.MigrateUp(ctx, db)
+		if err != nil {
+			log.Fatalf("マイグレーションエラー: %v", err)
+		}
+		fmt.Printf("%d 件のマイグレーションを適用しました\n", n)
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("steps には 1 以上の整数を指定してください: %s", os.Args[2])
+			}
+		}
+		n, err := database.MigrateDown(ctx, db, steps)
+		if err != nil {
+			log.Fatalf("ロールバックエラー: %v", err)
+		}
+		fmt.Printf("%d 件のマイグレーションをロールバックしました\n", n)
+
+	case "status":
+		statuses, err := database.Status(ctx, db)
+		if err != nil {
+			log.Fatalf("ステータス取得エラー: %v", err)
+		}
+		for _, s := range statuses {
+			applied := "未適用"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		log.Fatal(usage)
+	}
+}
@@ -0,0 +1,267 @@
+package batch
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/cinii"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndc"
+)
+
+//go:embed default.yaml
+var defaultYAML []byte
+
+// Config はバッチの取得対象と取得条件です。
+// Count・YearFrom・YearTo・Sort は各対象で省略した場合の既定値です。
+type Config struct {
+	Count     int      `yaml:"count" json:"count"`
+	YearFrom  int      `yaml:"yearFrom" json:"yearFrom"`
+	YearTo    int      `yaml:"yearTo" json:"yearTo"`
+	Sort      []string `yaml:"sort" json:"sort"`
+	ChunkSize int      `yaml:"chunkSize" json:"chunkSize"`
+	Policy    Policy   `yaml:"policy" json:"policy"`
+	Targets   []Target `yaml:"targets" json:"targets"`
+}
+
+// Target は CiNii から ISBN を取得する NDC 分類です。
+// Code は ndc.ParsePattern と同じ書式で、0 や空の項目は Config の既定値を使います。
+type Target struct {
+	Code     string   `yaml:"code" json:"code"`
+	Label    string   `yaml:"label,omitempty" json:"label,omitempty"`
+	Count    int      `yaml:"count,omitempty" json:"count,omitempty"`
+	YearFrom int      `yaml:"yearFrom,omitempty" json:"yearFrom,omitempty"`
+	YearTo   int      `yaml:"yearTo,omitempty" json:"yearTo,omitempty"`
+	Sort     []string `yaml:"sort,omitempty" json:"sort,omitempty"`
+}
+
+// DefaultConfig はバイナリに埋め込んだ既定の設定を返します。
+func DefaultConfig() *Config {
+	var c Config
+	if err := decodeConfig(bytes.NewReader(defaultYAML), ".yaml", &c); err != nil {
+		panic(fmt.Sprintf("既定の設定の読み込みエラー: %v", err))
+	}
+	return &c
+}
+
+// LoadConfig は YAML または JSON（拡張子 .json）の設定ファイルを読み込みます。
+// ファイルで省略した項目は DefaultConfig の値を使い、targets を指定した場合は既定の対象を置き換えます。
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("設定ファイルの読み込みエラー: %w", err)
+	}
+	defer f.Close()
+
+	c := DefaultConfig()
+	defaults := c.Targets
+	c.Targets = nil
+	if err := decodeConfig(f, filepath.Ext(path), c); err != nil {
+		return nil, fmt.Errorf("設定ファイルの解析エラー (%s): %w", path, err)
+	}
+	if c.Targets == nil {
+		c.Targets = defaults
+	}
+	return c, nil
+}
+
+func decodeConfig(r io.Reader, ext string, c *Config) error {
+	var err error
+	if strings.EqualFold(ext, ".json") {
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	} else {
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+	}
+	// 空のファイルはすべて既定値とみなす
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// Override はコマンドラインで指定された値です。nil の項目は上書きしません。
+// 指定した値は各対象の個別の指定よりも優先します。
+type Override struct {
+	Codes     []string
+	Count     *int
+	YearFrom  *int
+	YearTo    *int
+	Sort      []string
+	ChunkSize *int
+}
+
+// Apply は o の値で c を上書きします。
+// Codes を指定した場合は対象をその分類だけにし、設定にある分類の個別の指定やラベルは引き継ぎます。
+func (c *Config) Apply(o Override) {
+	if o.Codes != nil {
+		targets := make([]Target, 0, len(o.Codes))
+		for _, code := range o.Codes {
+			i := slices.IndexFunc(c.Targets, func(t Target) bool { return t.Code == code })
+			if i >= 0 {
+				targets = append(targets, c.Targets[i])
+			} else {
+				targets = append(targets, Target{Code: code})
+			}
+		}
+		c.Targets = targets
+	}
+	if o.ChunkSize != nil {
+		c.ChunkSize = *o.ChunkSize
+	}
+
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		if o.Count != nil {
+			t.Count = 0
+		}
+		if o.YearFrom != nil {
+			t.YearFrom = 0
+		}
+		if o.YearTo != nil {
+			t.YearTo = 0
+		}
+		if o.Sort != nil {
+			t.Sort = nil
+		}
+	}
+	if o.Count != nil {
+		c.Count = *o.Count
+	}
+	if o.YearFrom != nil {
+		c.YearFrom = *o.YearFrom
+	}
+	if o.YearTo != nil {
+		c.YearTo = *o.YearTo
+	}
+	if o.Sort != nil {
+		c.Sort = o.Sort
+	}
+}
+
+// Resolve は既定値を各対象に反映して検証し、実際に使う設定を返します。
+// 並び順を省略した対象にはすべての並び順を設定します。
+func (c *Config) Resolve() (*Config, error) {
+	r := &Config{
+		Count:     c.Count,
+		YearFrom:  c.YearFrom,
+		YearTo:    c.YearTo,
+		Sort:      slices.Clone(c.Sort),
+		ChunkSize: c.ChunkSize,
+		Policy:    c.Policy,
+		Targets:   make([]Target, len(c.Targets)),
+	}
+
+	var errs []error
+	if r.ChunkSize < 1 {
+		errs = append(errs, fmt.Errorf("chunkSize には 1 以上を指定してください: %d", r.ChunkSize))
+	}
+	errs = append(errs, r.Policy.validate()...)
+	if len(c.Targets) == 0 {
+		errs = append(errs, errors.New("targets に取得対象の分類を 1 つ以上指定してください"))
+	}
+
+	seen := make(map[string]bool, len(c.Targets))
+	for i, t := range c.Targets {
+		if t.Count == 0 {
+			t.Count = c.Count
+		}
+		if t.YearFrom == 0 {
+			t.YearFrom = c.YearFrom
+		}
+		if t.YearTo == 0 {
+			t.YearTo = c.YearTo
+		}
+		if len(t.Sort) == 0 {
+			t.Sort = c.Sort
+		}
+		if len(t.Sort) == 0 {
+			for _, s := range cinii.SortOptions() {
+				t.Sort = append(t.Sort, cinii.SortName(s))
+			}
+		}
+		t.Sort = slices.Clone(t.Sort)
+		r.Targets[i] = t
+
+		if seen[t.Code] {
+			errs = append(errs, fmt.Errorf("targets[%d]: 分類コードが重複しています: %q", i, t.Code))
+		}
+		seen[t.Code] = true
+		for _, err := range t.validate() {
+			errs = append(errs, fmt.Errorf("targets[%d] (%s): %w", i, t.Code, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("設定エラー: %w", errors.Join(errs...))
+	}
+	return r, nil
+}
+
+func (t Target) validate() []error {
+	var errs []error
+	if _, err := ndc.ParsePattern(t.Code); err != nil {
+		errs = append(errs, err)
+	}
+	if t.Count < 1 || t.Count > cinii.MaxCount {
+		errs = append(errs, fmt.Errorf("count は 1 から %d の範囲で指定してください: %d", cinii.MaxCount, t.Count))
+	}
+	if t.YearFrom < 0 || t.YearTo < 0 {
+		errs = append(errs, fmt.Errorf("出版年には 0 以上を指定してください: yearFrom=%d, yearTo=%d", t.YearFrom, t.YearTo))
+	} else if t.YearFrom > 0 && t.YearTo > 0 && t.YearFrom > t.YearTo {
+		errs = append(errs, fmt.Errorf("yearFrom が yearTo より後です: %d > %d", t.YearFrom, t.YearTo))
+	}
+	for _, s := range t.Sort {
+		if _, err := cinii.ParseSort(s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Pattern は対象の分類コードの指定を返します。Resolve で検証済みの Target に使います。
+func (t Target) Pattern() ndc.Pattern {
+	p, _ := ndc.ParsePattern(t.Code)
+	return p
+}
+
+// Query は対象の CiNii の検索条件を返します。Resolve で検証済みの Target に使います。
+func (t Target) Query() cinii.Query {
+	q := cinii.Query{NDC: t.Code, YearFrom: t.YearFrom, YearTo: t.YearTo}
+	for _, s := range t.Sort {
+		sort, _ := cinii.ParseSort(s)
+		q.Sorts = append(q.Sorts, sort)
+	}
+	return q
+}
+
+// TotalCount は全対象の取得件数の合計です。
+func (c *Config) TotalCount() int {
+	total := 0
+	for _, t := range c.Targets {
+		total += t.Count
+	}
+	return total
+}
+
+// WriteYAML は設定を設定ファイルと同じ形式で w に書き出します。
+func (c *Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return fmt.Errorf("設定の書き出しエラー: %w", err)
+	}
+	return enc.Close()
+}
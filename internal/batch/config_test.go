@@ -0,0 +1,202 @@
+package batch
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/cinii"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("設定ファイルの作成失敗: %v", err)
+	}
+	return path
+}
+
+func TestDefaultConfig(t *testing.T) {
+	cfg, err := DefaultConfig().Resolve()
+	if err != nil {
+		t.Fatalf("既定の設定が不正です: %v", err)
+	}
+	if len(cfg.Targets) != 7 || cfg.ChunkSize != 10 {
+		t.Fatalf("既定の設定が想定と異なります: %+v", cfg)
+	}
+	for _, target := range cfg.Targets {
+		if target.Count != 10 || target.YearFrom != 2020 || target.Label == "" {
+			t.Errorf("既定値が反映されていません: %+v", target)
+		}
+		if len(target.Query().Sorts) != len(cinii.SortOptions()) {
+			t.Errorf("並び順の既定値はすべての並び順です: %v", target.Sort)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []Target
+		chunk   int
+	}{
+		{
+			name: "YAML",
+			file: "batch.yaml",
+			content: `
+count: 20
+yearTo: 2024
+targets:
+  - code: "007.64"
+    label: コンピュータプログラミング
+    count: 5
+    sort: [year-desc]
+  - code: "007.3*"
+    yearFrom: 2010
+`,
+			want: []Target{
+				{Code: "007.64", Label: "コンピュータプログラミング", Count: 5, YearFrom: 2020, YearTo: 2024, Sort: []string{"year-desc"}},
+				{Code: "007.3*", Count: 20, YearFrom: 2010, YearTo: 2024},
+			},
+			chunk: 10,
+		},
+		{
+			name:    "JSON",
+			file:    "batch.json",
+			content: `{"chunkSize": 50, "sort": ["score"], "targets": [{"code": "007.6", "label": "データ処理"}]}`,
+			want: []Target{
+				{Code: "007.6", Label: "データ処理", Count: 10, YearFrom: 2020, Sort: []string{"score"}},
+			},
+			chunk: 50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeConfig(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			got, err := cfg.Resolve()
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if got.ChunkSize != tt.chunk {
+				t.Errorf("chunkSize: got %d, want %d", got.ChunkSize, tt.chunk)
+			}
+			if len(got.Targets) != len(tt.want) {
+				t.Fatalf("対象の数: got %d, want %d", len(got.Targets), len(tt.want))
+			}
+			for i, want := range tt.want {
+				g := got.Targets[i]
+				if want.Sort == nil {
+					want.Sort = g.Sort
+				}
+				if g.Code != want.Code || g.Label != want.Label || g.Count != want.Count ||
+					g.YearFrom != want.YearFrom || g.YearTo != want.YearTo || !slices.Equal(g.Sort, want.Sort) {
+					t.Errorf("targets[%d]: got %+v, want %+v", i, g, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	for _, file := range []string{"batch.yaml", "batch.json"} {
+		content := "counts: 10\n"
+		if strings.HasSuffix(file, ".json") {
+			content = `{"counts": 10}`
+		}
+		if _, err := LoadConfig(writeConfig(t, file, content)); err == nil {
+			t.Errorf("%s: 未知の項目がエラーになりません", file)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"分類コード", func(c *Config) { c.Targets[0].Code = "7" }, "NDC分類コードの形式が不正です"},
+		{"重複", func(c *Config) { c.Targets[1].Code = c.Targets[0].Code }, "重複"},
+		{"件数", func(c *Config) { c.Targets[0].Count = cinii.MaxCount + 1 }, "count は 1 から 200"},
+		{"出版年の範囲", func(c *Config) { c.YearTo = 2000 }, "yearFrom が yearTo より後です"},
+		{"並び順", func(c *Config) { c.Sort = []string{"random"} }, "不明な並び順"},
+		{"一括登録件数", func(c *Config) { c.ChunkSize = 0 }, "chunkSize"},
+		{"対象なし", func(c *Config) { c.Targets = nil }, "targets"},
+		{"登録件数の下限", func(c *Config) { c.Policy.MinInserted = 0 }, "policy.minInserted"},
+		{"失敗率", func(c *Config) { c.Policy.MaxEnrichErrorRatio = 1.5 }, "policy.maxEnrichErrorRatio"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(cfg)
+			_, err := cfg.Resolve()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q を含むエラー", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	count, yearFrom := 3, 0
+	cfg := DefaultConfig()
+	cfg.Targets[1].Count = 50
+	cfg.Apply(Override{
+		Codes:    []string{"007.3*", "007.1"},
+		Count:    &count,
+		YearFrom: &yearFrom,
+		Sort:     []string{"library-desc"},
+	})
+
+	got, err := cfg.Resolve()
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if len(got.Targets) != 2 || got.Targets[0].Code != "007.3*" || got.Targets[1].Code != "007.1" {
+		t.Fatalf("対象が置き換えられていません: %+v", got.Targets)
+	}
+	if got.Targets[0].Label == "" {
+		t.Errorf("設定にある分類のラベルが引き継がれていません")
+	}
+	for _, target := range got.Targets {
+		// コマンドラインの値は対象ごとの指定より優先する
+		if target.Count != 3 || target.YearFrom != 0 || !slices.Equal(target.Sort, []string{"library-desc"}) {
+			t.Errorf("上書きされていません: %+v", target)
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	cfg, err := DefaultConfig().Resolve()
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := cfg.WriteYAML(&buf); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	// 書き出した設定はそのまま設定ファイルとして読み込める
+	loaded, err := LoadConfig(writeConfig(t, "effective.yaml", buf.String()))
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	again, err := loaded.Resolve()
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if len(again.Targets) != len(cfg.Targets) || again.Targets[1].Code != "007.3*" {
+		t.Errorf("読み込み直した設定が異なります: %+v", again.Targets)
+	}
+}
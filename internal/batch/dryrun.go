@@ -0,0 +1,89 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/redact"
+)
+
+// DryRun は登録する代わりに書籍と ISBN ごとのエラーを JSON Lines で書き出します。
+// 複数のゴルーチンから同時に呼び出せます。
+type DryRun struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	books    int
+	errors   int
+	byNDC    map[string]int
+	bySource map[string]int
+}
+
+// dryRunEntry は JSON Lines の 1 行です。Type は "book" または "error" です。
+type dryRunEntry struct {
+	Type   string     `json:"type"`
+	ISBN   string     `json:"isbn"`
+	Source string     `json:"source,omitempty"`
+	Book   *book.Book `json:"book,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+func NewDryRun(w io.Writer) *DryRun {
+	return &DryRun{
+		enc:      json.NewEncoder(w),
+		byNDC:    make(map[string]int),
+		bySource: make(map[string]int),
+	}
+}
+
+// WriteBook は登録予定の書籍を書き出します。source は書誌情報の提供元の名前です。
+func (d *DryRun) WriteBook(b *book.Book, source string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.enc.Encode(dryRunEntry{Type: "book", ISBN: b.ISBN, Source: source, Book: b}); err != nil {
+		return fmt.Errorf("書籍の書き出しエラー (isbn: %s): %w", b.ISBN, err)
+	}
+	d.books++
+	for _, code := range b.NDC {
+		d.byNDC[code]++
+	}
+	d.bySource[source]++
+	return nil
+}
+
+// WriteError は ISBN の書誌情報を取得できなかったことを書き出します。エラーは URL のクエリ文字列を除いて書き出します。
+func (d *DryRun) WriteError(isbn string, err error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.enc.Encode(dryRunEntry{Type: "error", ISBN: isbn, Error: redact.URLs(err.Error())}); err != nil {
+		return fmt.Errorf("エラーの書き出しエラー (isbn: %s): %w", isbn, err)
+	}
+	d.errors++
+	return nil
+}
+
+// WriteSummary は登録されるはずだった件数を分類別・提供元別に w へ出力します。
+func (d *DryRun) WriteSummary(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Fprintf(w, "[dry-run] 登録予定の書籍: %d 件 (書誌情報の取得エラー: %d 件)\n", d.books, d.errors)
+	writeCounts(w, "分類別", d.byNDC)
+	writeCounts(w, "提供元別", d.bySource)
+}
+
+func writeCounts(w io.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  %s:\n", title)
+	for _, key := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Fprintf(w, "    %s: %d 件\n", key, counts[key])
+	}
+}
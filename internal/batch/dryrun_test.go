@@ -0,0 +1,86 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+)
+
+func TestDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewDryRun(&buf)
+
+	b1 := book.NewBook("9784873119038", "入門 Go", "", []string{"著者A"}, "出版社", "2020", "", "", "")
+	b1.NDC = []string{"007.64"}
+	b2 := book.NewBook("9784297124519", "データ設計", "", []string{"著者B"}, "出版社", "2021", "", "", "")
+	b2.NDC = []string{"007.6", "007.609"}
+
+	// 書誌情報の取得エラーはワーカーから同時に書き出される
+	var wg sync.WaitGroup
+	for _, isbn := range []string{"9784000000001", "9784000000002"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.WriteError(isbn, errors.New("書誌情報が見つかりません")); err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, b := range []*book.Book{b1, b2} {
+		if err := d.WriteBook(b, "googlebooks"); err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+	}
+
+	var types []string
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var entry struct {
+			Type  string     `json:"type"`
+			ISBN  string     `json:"isbn"`
+			Book  *book.Book `json:"book"`
+			Error string     `json:"error"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			t.Fatalf("JSON Lines として読めません: %v: %s", err, sc.Text())
+		}
+		types = append(types, entry.Type)
+		if entry.Type == "book" && (entry.Book == nil || entry.Book.ISBN != entry.ISBN || len(entry.Book.NDC) == 0) {
+			t.Errorf("書籍の内容が不正です: %s", sc.Text())
+		}
+		if entry.Type == "error" && entry.Error == "" {
+			t.Errorf("エラーの内容がありません: %s", sc.Text())
+		}
+	}
+	if got := strings.Join(types, ","); got != "error,error,book,book" {
+		t.Errorf("行の種類: got %s", got)
+	}
+
+	var summary bytes.Buffer
+	d.WriteSummary(&summary)
+	for _, want := range []string{"登録予定の書籍: 2 件", "取得エラー: 2 件", "007.609: 1 件", "googlebooks: 2 件"} {
+		if !strings.Contains(summary.String(), want) {
+			t.Errorf("サマリーに %q がありません:\n%s", want, summary.String())
+		}
+	}
+}
+
+func TestDryRunWriteErrorRedactsURLs(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewDryRun(&buf)
+
+	err := errors.New(`Get "https://www.googleapis.com/books/v1/volumes?q=isbn:9784873115658&key=secret": timeout`)
+	if err := d.WriteError("9784873115658", err); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), "https://www.googleapis.com/books/v1/volumes") {
+		t.Errorf("URL のクエリ文字列を除いていません: %s", buf.String())
+	}
+}
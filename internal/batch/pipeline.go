@@ -0,0 +1,405 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/cinii"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/enrich"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/failure"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/redact"
+)
+
+// Pipeline.Run が中断した理由です。errors.Is で判定します。
+var (
+	// ErrStore は途中経過や書籍の保存に失敗したことを表します
+	ErrStore = errors.New("保存エラー")
+	// ErrUpstream は日次上限など外部 API 側の理由で書誌情報の取得を続けられないことを表します
+	ErrUpstream = errors.New("外部 API エラー")
+)
+
+// stageError は中断した理由（ErrStore など）と元のエラーをまとめます。メッセージは元のエラーのままです。
+type stageError struct {
+	kind error
+	err  error
+}
+
+func (e *stageError) Error() string   { return e.err.Error() }
+func (e *stageError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// Fetcher は NDC 分類ごとの ISBN を取得します。*cinii.Client が満たします。
+type Fetcher interface {
+	FetchRandomISBNs(ctx context.Context, q cinii.Query, count int) (*cinii.Result, error)
+}
+
+// Store は途中経過と書籍の保存先です。
+type Store interface {
+	// SaveTarget は分類ごとに取得した ISBN を途中経過に保存します
+	SaveTarget(ctx context.Context, code string, isbns []string) error
+	// SaveRecord・SaveFailure は ISBN ごとの問い合わせの結果を途中経過に保存します
+	SaveRecord(ctx context.Context, rec *metadata.Record) error
+	SaveFailure(ctx context.Context, isbn, class string, cause error) error
+	// InsertChunk は書籍のチャンクを登録し、登録した件数を返します。
+	// 失敗した場合はそのチャンクだけを取り消し、パイプラインは残りの登録を続けます
+	InsertChunk(ctx context.Context, books []*book.Book) (int, error)
+}
+
+// Pipeline は CiNii からの ISBN の取得、書誌情報の問い合わせ、チャンクごとの登録を並行して進めます。
+type Pipeline struct {
+	Config   *Config
+	Fetcher  Fetcher
+	Provider metadata.Provider
+	Workers  int
+	// Store が nil の場合（-dry-run）は何も保存せず、取得した書誌情報を Result.Records に残します
+	Store Store
+	// Checkpoint は再開する実行の途中経過です。nil の場合は最初から実行します
+	Checkpoint *run.Checkpoint
+	// Progress は進捗の出力先です。nil の場合は出力しません
+	Progress io.Writer
+	// OnError は書誌情報を取得できなかった ISBN の通知先です。複数のワーカーから同時に呼ばれます
+	OnError func(isbn string, err error)
+}
+
+// Result はパイプラインの集計です。中断した場合もそれまでの集計を返します。
+type Result struct {
+	// Discovered は NDC 分類コードごとに見つかった ISBN の件数です
+	Discovered    map[string]int
+	Targets       []TargetReport
+	FailedTargets int
+	// NDCByISBN は ISBN ごとの CiNii の検索分類、SourceNDC は提供元が返した NDC 分類です
+	NDCByISBN map[string][]string
+	SourceNDC map[string][]string
+	// Stored は登録した書籍の ISBN です（再開前にコミット済みのものを含む）
+	Stored   []string
+	Enriched int
+	BySource map[string]int
+	// Failures は書誌情報を取得できなかった ISBN のうち、failed_enrichments に未記録のものです。
+	// 再開前に記録済みのものは RecordedFailures・RecordedClasses に数えます
+	Failures         []failure.Attempt
+	RecordedFailures int
+	RecordedClasses  map[string]int
+	Inserted         int
+	Chunks           int
+	FailedChunks     int
+	// Records は Store が nil の場合に取得した書誌情報です
+	Records []*metadata.Record
+	// 段階ごとの所要時間です。InsertTime はチャンクの登録にかかった時間の合計です
+	CiNiiTime  time.Duration
+	EnrichTime time.Duration
+	InsertTime time.Duration
+
+	targets int
+}
+
+// Failed は書誌情報を取得できなかった ISBN の件数です。
+func (r *Result) Failed() int {
+	return len(r.Failures) + r.RecordedFailures
+}
+
+// Stats は成功の条件の判定に使う件数です。
+func (r *Result) Stats() Stats {
+	return Stats{
+		Targets:       r.targets,
+		FailedTargets: r.FailedTargets,
+		Lookups:       r.Enriched + r.Failed(),
+		FailedLookups: r.Failed(),
+		Chunks:        r.Chunks,
+		FailedChunks:  r.FailedChunks,
+		Inserted:      r.Inserted,
+	}
+}
+
+// Fill は集計をレポートに加えます。
+func (r *Result) Fill(report *Report) {
+	report.Targets = append(report.Targets, r.Targets...)
+	report.AddTiming(StageCiNii, r.CiNiiTime)
+	report.AddTiming(StageEnrich, r.EnrichTime)
+	report.AddTiming(StageInsert, r.InsertTime)
+	report.Enrichment.Enriched = r.Enriched
+	report.Enrichment.Failed = r.Failed()
+	report.Enrichment.Lookups = r.Enriched + r.Failed()
+	for class, n := range r.RecordedClasses {
+		report.Enrichment.FailuresByClass[class] += n
+	}
+	for _, f := range r.Failures {
+		report.Enrichment.FailuresByClass[f.Class]++
+	}
+	for source, n := range r.BySource {
+		report.Enrichment.BySource[source] += n
+	}
+	report.Inserted = r.Inserted
+}
+
+// pipelineRun は 1 回分の実行の状態です。
+type pipelineRun struct {
+	*Pipeline
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	cp       *run.Checkpoint
+	res      *Result
+	progress io.Writer
+
+	failuresMu sync.Mutex
+	bookChunk  []*book.Book
+}
+
+// Run はパイプラインを実行します。ctx のキャンセルや保存の失敗で中断した場合は、
+// それまでの集計とともに中断した理由（ErrStore・ErrUpstream を含むことがある）を返します。
+func (p *Pipeline) Run(ctx context.Context) (*Result, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	r := &pipelineRun{
+		Pipeline: p,
+		ctx:      ctx,
+		cancel:   cancel,
+		cp:       p.Checkpoint,
+		progress: p.Progress,
+		res: &Result{
+			Discovered:      make(map[string]int),
+			NDCByISBN:       make(map[string][]string),
+			SourceNDC:       make(map[string][]string),
+			BySource:        make(map[string]int),
+			RecordedClasses: make(map[string]int),
+			targets:         len(p.Config.Targets),
+		},
+	}
+	if r.cp == nil {
+		r.cp = &run.Checkpoint{}
+	}
+	if r.progress == nil {
+		r.progress = io.Discard
+	}
+
+	// 再開前に取得できなかった ISBN のうち、failed_enrichments に記録済みのものは数えるだけにする
+	for _, rec := range r.cp.Records {
+		if rec.Record != nil {
+			continue
+		}
+		if rec.FailureRecorded {
+			r.res.RecordedFailures++
+			r.res.RecordedClasses[rec.ErrorClass]++
+		} else {
+			r.res.Failures = append(r.res.Failures, failure.Attempt{ISBN: rec.ISBN, Class: rec.ErrorClass, Err: errors.New(rec.Error)})
+		}
+	}
+
+	total := p.Config.TotalCount()
+	isbnCh := make(chan string, total)
+	recordCh := make(chan *metadata.Record, total)
+
+	// 1. CiNii から ISBN を取得するゴルーチン
+	ciniiDone := make(chan struct{})
+	go func() {
+		defer close(ciniiDone)
+		defer close(isbnCh)
+		defer func(start time.Time) { r.res.CiNiiTime = time.Since(start) }(time.Now())
+		r.fetchTargets(isbnCh)
+	}()
+
+	// 2. 書誌情報の提供元に問い合わせるワーカープール
+	pool := &enrich.Pool{
+		Provider: p.Provider,
+		Workers:  p.Workers,
+		OnError:  r.addFailure,
+	}
+	go func() {
+		defer close(recordCh)
+		defer func(start time.Time) { r.res.EnrichTime = time.Since(start) }(time.Now())
+		// ワーカープールが止まるのは日次上限など外部 API 側の理由による
+		if err := pool.Run(ctx, isbnCh, recordCh); err != nil {
+			cancel(&stageError{kind: ErrUpstream, err: err})
+		}
+	}()
+
+	// 3. 書籍情報をチャンクごとに登録する。再開前に取得した書誌情報を先に登録し、コミット済みの書籍は登録し直さない
+	r.addCheckpointRecords()
+	for rec := range recordCh {
+		if p.Store != nil {
+			if err := p.Store.SaveRecord(ctx, rec); err != nil {
+				cancel(&stageError{kind: ErrStore, err: err})
+				continue
+			}
+		}
+		r.addRecord(rec)
+	}
+	if len(r.bookChunk) > 0 && ctx.Err() == nil {
+		r.insertChunk("残りのチャンク")
+	}
+
+	<-ciniiDone
+	if ctx.Err() != nil {
+		return r.res, context.Cause(ctx)
+	}
+	return r.res, nil
+}
+
+// fetchTargets は分類ごとに ISBN を取得し、問い合わせていない ISBN を isbnCh に送ります。
+// res の Discovered・Targets・FailedTargets・NDCByISBN はこのゴルーチンだけが書き込みます。
+func (r *pipelineRun) fetchTargets(isbnCh chan<- string) {
+	for _, target := range r.Config.Targets {
+		if r.ctx.Err() != nil {
+			return
+		}
+		tr := TargetReport{Code: target.Code, Label: target.Label}
+		// 再開時は取得済みの分類を CiNii に問い合わせ直さない
+		isbns, fetched := r.cp.Targets[target.Code]
+		if fetched {
+			fmt.Fprintf(r.progress, "\n取得済みの分類コード: %s %s (%d 件)\n", target.Code, target.Label, len(isbns))
+			tr.Resumed = true
+		} else {
+			fmt.Fprintf(r.progress, "\nfetch from CiNii 分類コード: %s %s\n", target.Code, target.Label)
+			result, err := r.Fetcher.FetchRandomISBNs(r.ctx, target.Query(), target.Count)
+			if r.ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				r.res.FailedTargets++
+				tr.Error = redact.URLs(err.Error())
+				r.res.Targets = append(r.res.Targets, tr)
+				log.Printf("エラー: CiNii ISBN 取得エラー (%s): %v", target.Code, err)
+				continue
+			}
+			isbns = result.ISBNs
+			tr.TotalResults = result.TotalResults
+			tr.Page = result.Page
+			tr.Sort = cinii.SortName(result.Sort)
+			tr.Skipped = result.Skipped
+			fmt.Fprintf(r.progress, "検索結果: %d 件, ページ: %d, 並び順: %s, ISBN: %d 件\n",
+				tr.TotalResults, tr.Page, tr.Sort, len(isbns))
+			if r.Store != nil {
+				if err := r.Store.SaveTarget(r.ctx, target.Code, isbns); err != nil {
+					r.cancel(&stageError{kind: ErrStore, err: err})
+					return
+				}
+			}
+		}
+		r.res.Discovered[target.Code] += len(isbns)
+		tr.Found = len(isbns)
+		// "007.3*" のような前方一致指定は末尾の * を除いた分類コードとして記録する
+		code := target.Pattern().Code
+		var pending []string
+		for _, isbn := range isbns {
+			codes, seen := r.res.NDCByISBN[isbn]
+			if !slices.Contains(codes, code) {
+				r.res.NDCByISBN[isbn] = append(codes, code)
+			}
+			if seen {
+				tr.Duplicates++
+				continue
+			}
+			// 問い合わせ済みの ISBN は途中経過の結果を使う
+			if _, done := r.cp.Records[isbn]; done {
+				continue
+			}
+			pending = append(pending, isbn)
+		}
+
+		// openBD のようにまとめて取得できる提供元には、ワーカーが問い合わせる前に分類ごとに取得させる。
+		// 失敗した場合はワーカーが 1 件ずつ問い合わせる
+		if err := metadata.Prefetch(r.ctx, r.Provider, pending); err != nil && r.ctx.Err() == nil {
+			log.Printf("書誌情報の一括取得エラー (%s): %v", target.Code, err)
+		}
+		for _, isbn := range pending {
+			select {
+			case isbnCh <- isbn:
+			case <-r.ctx.Done():
+				return
+			}
+		}
+		r.res.Targets = append(r.res.Targets, tr)
+	}
+}
+
+// addFailure は書誌情報を取得できなかった ISBN を記録します。複数のワーカーから同時に呼ばれます。
+func (r *pipelineRun) addFailure(isbn string, err error) {
+	class := enrich.Classify(err)
+	if r.Store != nil {
+		if serr := r.Store.SaveFailure(r.ctx, isbn, class, err); serr != nil {
+			r.cancel(&stageError{kind: ErrStore, err: serr})
+		}
+	}
+	r.failuresMu.Lock()
+	r.res.Failures = append(r.res.Failures, failure.Attempt{ISBN: isbn, Class: class, Err: err})
+	r.failuresMu.Unlock()
+	if r.OnError != nil {
+		r.OnError(isbn, err)
+	}
+	log.Printf("エラー: 書誌情報取得エラー (isbn: %s): %v", isbn, err)
+}
+
+// addCheckpointRecords は再開前に取得した書誌情報を登録します。コミット済みの書籍は数えるだけにします。
+func (r *pipelineRun) addCheckpointRecords() {
+	for _, cr := range r.cp.Records {
+		if cr.Record == nil {
+			continue
+		}
+		var rec metadata.Record
+		if err := json.Unmarshal(cr.Record, &rec); err != nil {
+			r.cancel(fmt.Errorf("途中経過の書誌情報の読み取りエラー (isbn: %s): %w", cr.ISBN, err))
+			return
+		}
+		if cr.Committed {
+			r.res.Enriched++
+			r.res.BySource[rec.Source]++
+			r.res.Inserted++
+			r.res.Stored = append(r.res.Stored, rec.ISBN)
+			if len(rec.NDC) > 0 {
+				r.res.SourceNDC[rec.ISBN] = rec.NDC
+			}
+			continue
+		}
+		r.addRecord(&rec)
+	}
+}
+
+// addRecord は取得した書誌情報をチャンクに加え、チャンクが埋まったら登録します。
+func (r *pipelineRun) addRecord(rec *metadata.Record) {
+	fmt.Fprintf(r.progress, "取得元: %s, isbn: %s, タイトル: %s\n", rec.Source, rec.ISBN, rec.Title)
+	r.res.Enriched++
+	r.res.BySource[rec.Source]++
+	if len(rec.NDC) > 0 {
+		r.res.SourceNDC[rec.ISBN] = rec.NDC
+	}
+	if r.Store == nil {
+		r.res.Records = append(r.res.Records, rec)
+		return
+	}
+	r.bookChunk = append(r.bookChunk, rec.Book())
+	if len(r.bookChunk) >= r.Config.ChunkSize {
+		r.insertChunk("チャンク")
+	}
+}
+
+func (r *pipelineRun) insertChunk(label string) {
+	start := time.Now()
+	cnt, err := r.Store.InsertChunk(r.ctx, r.bookChunk)
+	r.res.InsertTime += time.Since(start)
+	r.res.Chunks++
+	if err != nil {
+		r.res.FailedChunks++
+		log.Printf("エラー: %sのバルクインサートエラー: %v", label, err)
+	} else {
+		fmt.Fprintf(r.progress, "%sのバルクインサート完了: %d 件\n", label, cnt)
+		r.res.Inserted += cnt
+		r.res.Stored = appendISBNs(r.res.Stored, r.bookChunk)
+	}
+	r.bookChunk = nil
+}
+
+func appendISBNs(isbns []string, books []*book.Book) []string {
+	for _, b := range books {
+		isbns = append(isbns, b.ISBN)
+	}
+	return isbns
+}
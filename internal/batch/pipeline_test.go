@@ -0,0 +1,309 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/cinii"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+// stubFetcher は分類コードごとに決めた ISBN を返し、問い合わせ回数を記録します。
+type stubFetcher struct {
+	isbns map[string][]string
+	errs  map[string]error
+	calls map[string]int
+}
+
+func (f *stubFetcher) FetchRandomISBNs(ctx context.Context, q cinii.Query, count int) (*cinii.Result, error) {
+	f.calls[q.NDC]++
+	if err := f.errs[q.NDC]; err != nil {
+		return nil, err
+	}
+	return &cinii.Result{TotalResults: len(f.isbns[q.NDC]), Page: 1, Sort: cinii.SortByScore, ISBNs: f.isbns[q.NDC]}, nil
+}
+
+// stubProvider は ISBN ごとに決めたエラーを返し、問い合わせ回数を記録します。
+type stubProvider struct {
+	mu    sync.Mutex
+	errs  map[string]error
+	calls map[string]int
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) Lookup(ctx context.Context, isbn string) (*metadata.Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls[isbn]++
+	if err := p.errs[isbn]; err != nil {
+		return nil, err
+	}
+	return &metadata.Record{ISBN: isbn, Title: "title " + isbn, Source: "stub"}, nil
+}
+
+// memStore は途中経過と登録した書籍をメモリに保存する Store です。
+// 差分登録と同じく、チャンクを登録した書籍は途中経過をコミット済みにします。
+type memStore struct {
+	mu      sync.Mutex
+	targets map[string][]string
+	records map[string]*run.CheckpointRecord
+	// inserted は ISBN ごとの登録回数です
+	inserted map[string]int
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		targets:  make(map[string][]string),
+		records:  make(map[string]*run.CheckpointRecord),
+		inserted: make(map[string]int),
+	}
+}
+
+func (s *memStore) SaveTarget(ctx context.Context, code string, isbns []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[code] = slices.Clone(isbns)
+	return nil
+}
+
+func (s *memStore) SaveRecord(ctx context.Context, rec *metadata.Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.ISBN] = &run.CheckpointRecord{ISBN: rec.ISBN, Record: data}
+	return nil
+}
+
+func (s *memStore) SaveFailure(ctx context.Context, isbn, class string, cause error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[isbn] = &run.CheckpointRecord{ISBN: isbn, ErrorClass: class, Error: cause.Error()}
+	return nil
+}
+
+func (s *memStore) InsertChunk(ctx context.Context, books []*book.Book) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range books {
+		s.inserted[b.ISBN]++
+		s.records[b.ISBN].Committed = true
+	}
+	return len(books), nil
+}
+
+// checkpoint は保存した途中経過を run.Run.LoadCheckpoint と同じ形で返します。
+func (s *memStore) checkpoint() *run.Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := &run.Checkpoint{Targets: maps.Clone(s.targets), Records: make(map[string]*run.CheckpointRecord)}
+	for isbn, rec := range s.records {
+		c := *rec
+		cp.Records[isbn] = &c
+	}
+	return cp
+}
+
+func testConfig() *Config {
+	return &Config{
+		ChunkSize: 2,
+		Targets: []Target{
+			{Code: "007.1", Count: 3},
+			{Code: "007.6", Count: 3},
+		},
+	}
+}
+
+// 9784000000015 は両方の分類で見つかる
+var testISBNs = map[string][]string{
+	"007.1": {"9784000000015", "9784000000022", "9784000000039"},
+	"007.6": {"9784000000046", "9784000000053", "9784000000015"},
+}
+
+func TestPipelineRun(t *testing.T) {
+	fetcher := &stubFetcher{
+		isbns: testISBNs,
+		calls: make(map[string]int),
+	}
+	provider := &stubProvider{
+		errs:  map[string]error{"9784000000039": fmt.Errorf("見つからない: %w", metadata.ErrNotFound)},
+		calls: make(map[string]int),
+	}
+	store := newMemStore()
+
+	p := &Pipeline{Config: testConfig(), Fetcher: fetcher, Provider: provider, Workers: 2, Store: store}
+	res, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	if got := provider.calls["9784000000015"]; got != 1 {
+		t.Errorf("重複した ISBN の問い合わせ回数: got %d, want 1", got)
+	}
+	if got := res.NDCByISBN["9784000000015"]; !slices.Equal(got, []string{"007.1", "007.6"}) {
+		t.Errorf("NDC 分類不一致: %v", got)
+	}
+	if res.Inserted != 4 || res.Enriched != 4 || res.Failed() != 1 {
+		t.Errorf("件数不一致: inserted %d, enriched %d, failed %d", res.Inserted, res.Enriched, res.Failed())
+	}
+	if len(res.Failures) != 1 || res.Failures[0].Class != "not_found" {
+		t.Errorf("失敗の記録不一致: %+v", res.Failures)
+	}
+	want := Stats{Targets: 2, Lookups: 5, FailedLookups: 1, Chunks: 2, Inserted: 4}
+	if got := res.Stats(); got != want {
+		t.Errorf("Stats 不一致: got %+v, want %+v", got, want)
+	}
+	if res.Targets[1].Duplicates != 1 {
+		t.Errorf("重複件数不一致: %+v", res.Targets[1])
+	}
+}
+
+func TestPipelineRunWithoutStore(t *testing.T) {
+	fetcher := &stubFetcher{
+		isbns: testISBNs,
+		errs:  map[string]error{"007.6": errors.New("CiNii エラー")},
+		calls: make(map[string]int),
+	}
+	provider := &stubProvider{calls: make(map[string]int)}
+
+	p := &Pipeline{Config: testConfig(), Fetcher: fetcher, Provider: provider, Workers: 2}
+	res, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	if len(res.Records) != 3 || res.Inserted != 0 || res.Chunks != 0 {
+		t.Errorf("登録せずに書誌情報を残していません: records %d, inserted %d, chunks %d", len(res.Records), res.Inserted, res.Chunks)
+	}
+	if res.FailedTargets != 1 || res.Targets[1].Error == "" {
+		t.Errorf("取得できなかった分類の記録不一致: %+v", res.Targets)
+	}
+}
+
+// prefetchProvider は分類ごとに Prefetch に渡された ISBN を記録します。
+type prefetchProvider struct {
+	stubProvider
+	prefetched [][]string
+}
+
+func (p *prefetchProvider) Prefetch(ctx context.Context, isbns []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prefetched = append(p.prefetched, isbns)
+	return nil
+}
+
+func TestPipelineRunPrefetch(t *testing.T) {
+	provider := &prefetchProvider{stubProvider: stubProvider{calls: make(map[string]int)}}
+
+	p := &Pipeline{
+		Config:   testConfig(),
+		Fetcher:  &stubFetcher{isbns: testISBNs, calls: make(map[string]int)},
+		Provider: provider,
+		Workers:  2,
+		// 007.1 の 2 件目は問い合わせ済み
+		Checkpoint: &run.Checkpoint{Records: map[string]*run.CheckpointRecord{
+			"9784000000022": {ISBN: "9784000000022", Record: json.RawMessage(`{"isbn":"9784000000022","title":"t","source":"stub"}`)},
+		}},
+	}
+	if _, err := p.Run(context.Background()); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	// 問い合わせ済みの ISBN と、前の分類で見つかった ISBN は除いて分類ごとにまとめて取得する
+	want := [][]string{
+		{"9784000000015", "9784000000039"},
+		{"9784000000046", "9784000000053"},
+	}
+	if !slices.EqualFunc(provider.prefetched, want, slices.Equal) {
+		t.Errorf("まとめて取得した ISBN 不一致: got %v, want %v", provider.prefetched, want)
+	}
+}
+
+func TestPipelineResume(t *testing.T) {
+	store := newMemStore()
+
+	// 1 回目は日次上限で中断する。ワーカーは 1 つにし、上限に達するまでの結果を途中経過に残す
+	first := &Pipeline{
+		Config:  testConfig(),
+		Fetcher: &stubFetcher{isbns: testISBNs, calls: make(map[string]int)},
+		Provider: &stubProvider{
+			errs: map[string]error{
+				"9784000000039": fmt.Errorf("見つからない: %w", metadata.ErrNotFound),
+				"9784000000046": fmt.Errorf("上限: %w", ratelimit.ErrQuotaExceeded),
+			},
+			calls: make(map[string]int),
+		},
+		Workers: 1,
+		Store:   store,
+	}
+	if _, err := first.Run(context.Background()); !errors.Is(err, ErrUpstream) {
+		t.Fatalf("ErrUpstream で中断しませんでした: %v", err)
+	}
+
+	cp := store.checkpoint()
+	if len(cp.Targets) == 0 || len(cp.Records) == 0 {
+		t.Fatalf("途中経過が保存されていません: %+v", cp)
+	}
+
+	// 2 回目は途中経過から再開する
+	fetcher := &stubFetcher{isbns: testISBNs, calls: make(map[string]int)}
+	provider := &stubProvider{calls: make(map[string]int)}
+	resumed := &Pipeline{
+		Config:     testConfig(),
+		Fetcher:    fetcher,
+		Provider:   provider,
+		Workers:    2,
+		Store:      store,
+		Checkpoint: cp,
+	}
+	res, err := resumed.Run(context.Background())
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	for code := range cp.Targets {
+		if fetcher.calls[code] > 0 {
+			t.Errorf("取得済みの分類を問い合わせ直しました: %s", code)
+		}
+	}
+	for isbn := range cp.Records {
+		if provider.calls[isbn] > 0 {
+			t.Errorf("問い合わせ済みの ISBN を問い合わせ直しました: %s", isbn)
+		}
+	}
+	for _, tr := range res.Targets {
+		if _, ok := cp.Targets[tr.Code]; ok != tr.Resumed {
+			t.Errorf("Resumed 不一致: %+v", tr)
+		}
+	}
+
+	// 見つからなかった ISBN 以外は、2 回の実行を通してちょうど 1 回ずつ登録する
+	wantStored := []string{"9784000000015", "9784000000022", "9784000000046", "9784000000053"}
+	for _, isbn := range wantStored {
+		if got := store.inserted[isbn]; got != 1 {
+			t.Errorf("登録回数不一致 (isbn: %s): got %d, want 1", isbn, got)
+		}
+	}
+	if got := slices.Sorted(slices.Values(res.Stored)); !slices.Equal(got, wantStored) {
+		t.Errorf("登録した ISBN 不一致: got %v, want %v", got, wantStored)
+	}
+	if res.Inserted != 4 || res.Enriched != 4 || res.Failed() != 1 {
+		t.Errorf("件数不一致: inserted %d, enriched %d, failed %d", res.Inserted, res.Enriched, res.Failed())
+	}
+	if got := res.NDCByISBN["9784000000015"]; !slices.Equal(got, []string{"007.1", "007.6"}) {
+		t.Errorf("NDC 分類不一致: %v", got)
+	}
+}
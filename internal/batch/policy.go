@@ -0,0 +1,82 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Policy はバッチの実行を成功とみなす条件です。満たさない場合は登録をコミットしません。
+// 失敗率は段階ごとの失敗件数 / 試行件数で、0 から 1 の範囲で指定します。
+type Policy struct {
+	// MinInserted は登録件数の下限です
+	MinInserted int `yaml:"minInserted" json:"minInserted"`
+	// MaxFetchErrorRatio は CiNii から ISBN を取得できなかった分類の割合の上限です
+	MaxFetchErrorRatio float64 `yaml:"maxFetchErrorRatio" json:"maxFetchErrorRatio"`
+	// MaxEnrichErrorRatio は書誌情報を取得できなかった ISBN の割合の上限です
+	MaxEnrichErrorRatio float64 `yaml:"maxEnrichErrorRatio" json:"maxEnrichErrorRatio"`
+	// MaxInsertErrorRatio は登録に失敗したチャンクの割合の上限です
+	MaxInsertErrorRatio float64 `yaml:"maxInsertErrorRatio" json:"maxInsertErrorRatio"`
+}
+
+// Stats はバッチの段階ごとの試行件数と失敗件数です。
+type Stats struct {
+	// Targets・FailedTargets は CiNii に問い合わせた分類と取得できなかった分類の数です
+	Targets       int
+	FailedTargets int
+	// Lookups・FailedLookups は書誌情報を問い合わせた ISBN と取得できなかった ISBN の数です
+	Lookups       int
+	FailedLookups int
+	// Chunks・FailedChunks は登録したチャンクと登録に失敗したチャンクの数です
+	Chunks       int
+	FailedChunks int
+	Inserted     int
+}
+
+func (p Policy) validate() []error {
+	var errs []error
+	if p.MinInserted < 1 {
+		errs = append(errs, fmt.Errorf("policy.minInserted には 1 以上を指定してください: %d", p.MinInserted))
+	}
+	for _, r := range []struct {
+		name  string
+		ratio float64
+	}{
+		{"maxFetchErrorRatio", p.MaxFetchErrorRatio},
+		{"maxEnrichErrorRatio", p.MaxEnrichErrorRatio},
+		{"maxInsertErrorRatio", p.MaxInsertErrorRatio},
+	} {
+		if r.ratio < 0 || r.ratio > 1 {
+			errs = append(errs, fmt.Errorf("policy.%s は 0 から 1 の範囲で指定してください: %g", r.name, r.ratio))
+		}
+	}
+	return errs
+}
+
+// Check は s が成功の条件を満たすかを判定し、満たさない条件をすべてまとめたエラーを返します。
+func (p Policy) Check(s Stats) error {
+	var errs []error
+	if s.Inserted < p.MinInserted {
+		errs = append(errs, fmt.Errorf("登録件数が下限を下回りました: %d 件 (下限 %d 件)", s.Inserted, p.MinInserted))
+	}
+	if r := ratio(s.FailedTargets, s.Targets); r > p.MaxFetchErrorRatio {
+		errs = append(errs, fmt.Errorf("CiNii の取得失敗率が上限を超えました: %d/%d 分類 (上限 %g)", s.FailedTargets, s.Targets, p.MaxFetchErrorRatio))
+	}
+	if r := ratio(s.FailedLookups, s.Lookups); r > p.MaxEnrichErrorRatio {
+		errs = append(errs, fmt.Errorf("書誌情報の取得失敗率が上限を超えました: %d/%d 件 (上限 %g)", s.FailedLookups, s.Lookups, p.MaxEnrichErrorRatio))
+	}
+	if r := ratio(s.FailedChunks, s.Chunks); r > p.MaxInsertErrorRatio {
+		errs = append(errs, fmt.Errorf("チャンクの登録失敗率が上限を超えました: %d/%d チャンク (上限 %g)", s.FailedChunks, s.Chunks, p.MaxInsertErrorRatio))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("成功の条件を満たしていません: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func ratio(failed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
@@ -0,0 +1,68 @@
+package batch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := Policy{MinInserted: 10, MaxFetchErrorRatio: 0.5, MaxEnrichErrorRatio: 0.2, MaxInsertErrorRatio: 0}
+
+	tests := []struct {
+		name  string
+		stats Stats
+		want  []string
+	}{
+		{
+			name:  "成功",
+			stats: Stats{Targets: 4, FailedTargets: 2, Lookups: 50, FailedLookups: 10, Chunks: 4, Inserted: 40},
+		},
+		{
+			name:  "登録件数",
+			stats: Stats{Targets: 4, Lookups: 5, Chunks: 1, Inserted: 5},
+			want:  []string{"登録件数が下限を下回りました"},
+		},
+		{
+			name:  "複数の条件",
+			stats: Stats{Targets: 4, FailedTargets: 3, Lookups: 50, FailedLookups: 11, Chunks: 5, FailedChunks: 1, Inserted: 30},
+			want:  []string{"CiNii の取得失敗率", "書誌情報の取得失敗率", "チャンクの登録失敗率"},
+		},
+		{
+			name:  "試行なし",
+			stats: Stats{Inserted: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.stats)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("予期しないエラー: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("エラーになりません")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("got %v, want %q を含むエラー", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigPolicy(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "batch.yaml", "policy:\n  minInserted: 50\n"))
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	// 省略した条件は既定値を使う
+	want := DefaultConfig().Policy
+	want.MinInserted = 50
+	if cfg.Policy != want {
+		t.Errorf("got %+v, want %+v", cfg.Policy, want)
+	}
+}
@@ -0,0 +1,132 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/redact"
+)
+
+// ReportStatusDryRun は -dry-run の実行の Report.Status です。それ以外は実行記録と同じ値です。
+const ReportStatusDryRun = "dry_run"
+
+// 段階の名前です。Report.Timings のキーに使います。
+const (
+	StageCiNii    = "cinii"
+	StageEnrich   = "enrich"
+	StageInsert   = "insert"
+	StageFinalize = "finalize"
+	StageTotal    = "total"
+)
+
+// Report はバッチ 1 回分の実行結果です。JSON で書き出し、実行ごとの比較や蔵書数の推移の集計に使います。
+type Report struct {
+	RunID      int64     `json:"runId,omitempty"`
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exitCode"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Config は実行時の設定です
+	Config any `json:"config,omitempty"`
+
+	Targets    []TargetReport   `json:"targets"`
+	Enrichment EnrichmentReport `json:"enrichment"`
+	// Inserted は登録した書籍の件数です
+	Inserted int `json:"inserted"`
+	// Timings は段階ごとの所要時間（秒）です。CiNii と書誌情報の取得は並行して進み、
+	// insert はチャンクの登録にかかった時間の合計です
+	Timings map[string]float64 `json:"timings"`
+}
+
+// TargetReport は NDC 分類ごとの CiNii の取得結果です。
+type TargetReport struct {
+	Code         string `json:"code"`
+	Label        string `json:"label,omitempty"`
+	TotalResults int    `json:"totalResults"`
+	// Page・Sort はランダムに選んだページと並び順です
+	Page int    `json:"page"`
+	Sort string `json:"sort"`
+	// Found は取得した ISBN の件数です
+	Found int `json:"found"`
+	// Duplicates は先に取得した分類で見つかっていたため問い合わせなかった ISBN の件数です
+	Duplicates int `json:"duplicates"`
+	// Skipped は不正な ISBN や同じ結果の中での重複として捨てた件数です
+	Skipped int    `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+	// Resumed は中断した実行の途中経過の ISBN を使ったことを表します。検索結果の件数・ページ・並び順は記録されません
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// EnrichmentReport は書誌情報の取得結果です。
+type EnrichmentReport struct {
+	Lookups  int `json:"lookups"`
+	Enriched int `json:"enriched"`
+	Failed   int `json:"failed"`
+	// FailuresByClass は取得できなかった原因の種類（enrich.Class*）ごとの件数です
+	FailuresByClass map[string]int `json:"failuresByClass"`
+	// BySource は書誌情報の提供元ごとの取得件数です
+	BySource map[string]int `json:"bySource"`
+}
+
+// NewReport は startedAt に開始した実行の Report を作成します。
+func NewReport(startedAt time.Time) *Report {
+	return &Report{
+		StartedAt: startedAt,
+		Targets:   []TargetReport{},
+		Enrichment: EnrichmentReport{
+			FailuresByClass: make(map[string]int),
+			BySource:        make(map[string]int),
+		},
+		Timings: make(map[string]float64),
+	}
+}
+
+// AddTiming は段階の所要時間を加算します。
+func (r *Report) AddTiming(stage string, d time.Duration) {
+	r.Timings[stage] += d.Seconds()
+}
+
+// Finish は結果を記録します。cause は失敗の理由で、nil でも構いません。
+// レポートは共有や保管を想定するため、cause は URL のクエリ文字列（API キーなど）を除いて記録します。
+func (r *Report) Finish(status string, exitCode int, cause error, finishedAt time.Time) {
+	r.Status = status
+	r.ExitCode = exitCode
+	if cause != nil {
+		r.Error = redact.URLs(cause.Error())
+	}
+	r.FinishedAt = finishedAt
+	r.Timings[StageTotal] = finishedAt.Sub(r.StartedAt).Seconds()
+}
+
+// Write は Report を整形した JSON で w に書き出します。
+func (r *Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("レポートの書き出しエラー: %w", err)
+	}
+	return nil
+}
+
+// WriteFile は Report を path に書き出します。path が "-" の場合は標準出力に書き出します。
+func (r *Report) WriteFile(path string) error {
+	if path == "-" {
+		return r.Write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("レポートファイルの作成エラー: %w", err)
+	}
+	if err := r.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("レポートファイルの書き出しエラー: %w", err)
+	}
+	return nil
+}
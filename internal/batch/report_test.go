@@ -0,0 +1,71 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReportWrite(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	r := NewReport(start)
+	r.RunID = 42
+	r.Targets = append(r.Targets, TargetReport{Code: "007.64", TotalResults: 1234, Page: 5, Sort: "year-desc", Found: 10, Duplicates: 2})
+	r.Enrichment.FailuresByClass["not_found"] = 3
+	r.AddTiming(StageInsert, 500*time.Millisecond)
+	r.AddTiming(StageInsert, 1500*time.Millisecond)
+	r.Finish("rolled_back", 5, errors.New("成功の条件を満たしていません"), start.Add(90*time.Second))
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("JSON として読み込めません: %v\n%s", err, buf.String())
+	}
+	if got["runId"] != float64(42) || got["status"] != "rolled_back" || got["exitCode"] != float64(5) {
+		t.Errorf("結果が書き出されていません: %s", buf.String())
+	}
+	if got["error"] != "成功の条件を満たしていません" {
+		t.Errorf("error: got %v", got["error"])
+	}
+
+	timings := got["timings"].(map[string]any)
+	if timings[StageInsert] != float64(2) || timings[StageTotal] != float64(90) {
+		t.Errorf("timings: got %v", timings)
+	}
+	target := got["targets"].([]any)[0].(map[string]any)
+	if target["totalResults"] != float64(1234) || target["page"] != float64(5) || target["sort"] != "year-desc" {
+		t.Errorf("targets: got %v", target)
+	}
+	failures := got["enrichment"].(map[string]any)["failuresByClass"].(map[string]any)
+	if failures["not_found"] != float64(3) {
+		t.Errorf("failuresByClass: got %v", failures)
+	}
+}
+
+func TestNewReportEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewReport(time.Now()).Write(&buf); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	// 対象や失敗がない場合も null ではなく空の配列・オブジェクトとして書き出す
+	for _, want := range []string{`"targets": []`, `"failuresByClass": {}`, `"bySource": {}`} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("%s が含まれません:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestReportFinishRedactsURLs(t *testing.T) {
+	r := NewReport(time.Now())
+	r.Finish("rolled_back", 3, errors.New(`Get "https://ci.nii.ac.jp/books/opensearch/search?appid=secret&isbn=1": EOF`), time.Now())
+
+	if want := `Get "https://ci.nii.ac.jp/books/opensearch/search": EOF`; r.Error != want {
+		t.Errorf("error: got %q, want %q", r.Error, want)
+	}
+}
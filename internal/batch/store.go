@@ -0,0 +1,81 @@
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+)
+
+// PostgresStore は途中経過を実行記録に、書籍を books テーブルに保存します。
+// Tx が nil の場合（差分登録）はチャンクごとにコミットし、中断しても登録済みの書籍を残します。
+// Tx を指定した場合（TRUNCATE して登録し直す場合）は Tx の中で登録し、コミットは呼び出し側で行います。
+type PostgresStore struct {
+	DB  *sql.DB
+	Run *run.Run
+	Tx  *sql.Tx
+}
+
+func (s *PostgresStore) SaveTarget(ctx context.Context, code string, isbns []string) error {
+	return s.Run.SaveTarget(ctx, s.DB, code, isbns)
+}
+
+func (s *PostgresStore) SaveRecord(ctx context.Context, rec *metadata.Record) error {
+	return s.Run.SaveRecord(ctx, s.DB, rec.ISBN, rec)
+}
+
+func (s *PostgresStore) SaveFailure(ctx context.Context, isbn, class string, cause error) error {
+	return s.Run.SaveFailure(ctx, s.DB, isbn, class, cause)
+}
+
+func (s *PostgresStore) InsertChunk(ctx context.Context, books []*book.Book) (int, error) {
+	if s.Tx != nil {
+		return bulkInsertChunk(ctx, s.Tx, books)
+	}
+	return s.commitChunk(ctx, books)
+}
+
+// commitChunk は差分登録のチャンクを 1 つのトランザクションで登録してコミットし、
+// 再開時に登録し直さないよう同じトランザクションで途中経過に記録します。
+func (s *PostgresStore) commitChunk(ctx context.Context, books []*book.Book) (int, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("トランザクション開始エラー: %w", err)
+	}
+	defer tx.Rollback()
+
+	cnt, err := book.BulkUpsert(ctx, tx, books)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.Run.MarkCommitted(ctx, tx, appendISBNs(nil, books)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("コミットエラー: %w", err)
+	}
+	return cnt, nil
+}
+
+// bulkInsertChunk は TRUNCATE したトランザクションにチャンクを登録します。
+// 失敗したチャンクだけを取り消して残りの登録を続けられるよう、セーブポイントの中で登録します。
+func bulkInsertChunk(ctx context.Context, tx *sql.Tx, books []*book.Book) (int, error) {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT chunk"); err != nil {
+		return 0, fmt.Errorf("セーブポイント作成エラー: %w", err)
+	}
+	cnt, err := book.BulkInsert(ctx, tx, books)
+	if err != nil {
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT chunk"); rbErr != nil {
+			return 0, errors.Join(err, fmt.Errorf("セーブポイントへのロールバックエラー: %w", rbErr))
+		}
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT chunk"); err != nil {
+		return 0, fmt.Errorf("セーブポイント解放エラー: %w", err)
+	}
+	return cnt, nil
+}
@@ -1,16 +1,20 @@
 package cinii
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/avast/retry-go"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/isbn"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
 )
 
 const (
@@ -21,6 +25,9 @@ const (
 	SortByLibraryDesc = 5 // 所蔵館数降順
 )
 
+// MaxCount は 1 回のリクエストで取得できる最大件数です。
+const MaxCount = 200
+
 var sortOptions = []int{
 	SortByScore,
 	SortByYearAsc,
@@ -29,19 +36,61 @@ var sortOptions = []int{
 	SortByLibraryDesc,
 }
 
+// sortNames は設定ファイルなどで並び順を指定するための名前です。
+var sortNames = map[int]string{
+	SortByScore:       "score",
+	SortByYearAsc:     "year-asc",
+	SortByYearDesc:    "year-desc",
+	SortByLibraryAsc:  "library-asc",
+	SortByLibraryDesc: "library-desc",
+}
+
+// SortOptions はすべての並び順を返します。
+func SortOptions() []int {
+	return slices.Clone(sortOptions)
+}
+
+// ParseSort は "year-desc" のような名前から並び順を返します。
+func ParseSort(name string) (int, error) {
+	for sort, n := range sortNames {
+		if n == name {
+			return sort, nil
+		}
+	}
+	return 0, fmt.Errorf("不明な並び順です: %q (指定可能な値: score, year-asc, year-desc, library-asc, library-desc)", name)
+}
+
+// SortName は並び順の名前を返します。
+func SortName(sort int) string {
+	if n, ok := sortNames[sort]; ok {
+		return n
+	}
+	return strconv.Itoa(sort)
+}
+
+// Query は ISBN を取得する検索条件です。
+// YearFrom・YearTo が 0 の場合は出版年を絞り込まず、Sorts が空の場合はすべての並び順から選びます。
+type Query struct {
+	NDC      string
+	YearFrom int
+	YearTo   int
+	Sorts    []int
+}
+
 type Client struct {
 	HTTPClient *http.Client
 	AppID      string
-	FetchDelay time.Duration
 	Rand       *rand.Rand
+	// RetryDelay は失敗したリクエストを再送するまでの初回の待ち時間です（以降は倍々に延びる）
+	RetryDelay time.Duration
 }
 
 func NewClient(appID string) *Client {
 	return &Client{
-		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		HTTPClient: &http.Client{Timeout: 10 * time.Second, Transport: ratelimit.Shared().Transport(nil)},
 		AppID:      appID,
-		FetchDelay: 1 * time.Second,
 		Rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		RetryDelay: 2 * time.Second,
 	}
 }
 
@@ -56,25 +105,33 @@ type ciniiResponse struct {
 	} `json:"@graph"`
 }
 
-func (c *Client) fetch(ndc string, count, page, yearFrom, sort int) ([]byte, error) {
+func (c *Client) fetch(ctx context.Context, q Query, count, page, sort int) ([]byte, error) {
 	url := fmt.Sprintf(
-		"https://ci.nii.ac.jp/books/opensearch/search?format=json&lang=jpn&appid=%s&clas=%s&count=%d&p=%d&year_from=%d&sortorder=%d",
-		c.AppID, ndc, count, page, yearFrom, sort,
+		"https://ci.nii.ac.jp/books/opensearch/search?format=json&lang=jpn&appid=%s&clas=%s&count=%d&p=%d&sortorder=%d",
+		c.AppID, q.NDC, count, page, sort,
 	)
-
-	time.Sleep(c.FetchDelay) // 負荷分散のため
+	if q.YearFrom > 0 {
+		url += fmt.Sprintf("&year_from=%d", q.YearFrom)
+	}
+	if q.YearTo > 0 {
+		url += fmt.Sprintf("&year_to=%d", q.YearTo)
+	}
 
 	var body []byte
 	err := retry.Do(
 		func() error {
-			resp, err := c.HTTPClient.Get(url)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return retry.Unrecoverable(fmt.Errorf("リクエスト作成失敗: %w", err))
+			}
+			resp, err := c.HTTPClient.Do(req)
 			if err != nil {
 				return fmt.Errorf("HTTPリクエスト失敗: %w", err)
 			}
 			defer resp.Body.Close()
 
 			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("HTTPステータス: %d", resp.StatusCode)
+				return &ratelimit.StatusError{StatusCode: resp.StatusCode}
 			}
 			body, err = io.ReadAll(resp.Body)
 			if err != nil {
@@ -84,16 +141,22 @@ func (c *Client) fetch(ndc string, count, page, yearFrom, sort int) ([]byte, err
 		},
 		retry.Attempts(3),
 		retry.DelayType(retry.BackOffDelay),
-		retry.Delay(2*time.Second),
+		retry.Delay(c.RetryDelay),
+		retry.RetryIf(ratelimit.Retryable),
+		retry.Context(ctx),
+		retry.LastErrorOnly(true),
 	)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, fmt.Errorf("CiNii Books API リクエストエラー: %w", err)
 	}
 	return body, nil
 }
 
-func (c *Client) fetchTotalResults(ndc string, yearFrom int) (int, error) {
-	raw, err := c.fetch(ndc, 1, 1, yearFrom, 1)
+func (c *Client) fetchTotalResults(ctx context.Context, q Query) (int, error) {
+	raw, err := c.fetch(ctx, q, 1, 1, SortByScore)
 	if err != nil {
 		return 0, err
 	}
@@ -116,12 +179,23 @@ func (c *Client) fetchTotalResults(ndc string, yearFrom int) (int, error) {
 	return total, nil
 }
 
-func (c *Client) FetchRandomISBNs(ndc string, yearFrom, count int) ([]string, error) {
-	if count <= 0 {
-		return nil, fmt.Errorf("count が正の整数ではありません: %d", count)
+// Result は FetchRandomISBNs の検索結果と、ランダムに選んだページ・並び順です。
+type Result struct {
+	TotalResults int
+	Page         int
+	Sort         int
+	ISBNs        []string
+	// Skipped は不正な ISBN や同じ結果の中での重複として捨てた件数です
+	Skipped int
+}
+
+// FetchRandomISBNs は q に一致する書籍からランダムなページを選び、最大 count 件の ISBN を返します。
+func (c *Client) FetchRandomISBNs(ctx context.Context, q Query, count int) (*Result, error) {
+	if count <= 0 || count > MaxCount {
+		return nil, fmt.Errorf("count は 1 から %d の範囲で指定してください: %d", MaxCount, count)
 	}
 
-	total, err := c.fetchTotalResults(ndc, yearFrom)
+	total, err := c.fetchTotalResults(ctx, q)
 	if err != nil {
 		return nil, fmt.Errorf("検索結果の取得に失敗: %w", err)
 	}
@@ -135,9 +209,13 @@ func (c *Client) FetchRandomISBNs(ndc string, yearFrom, count int) ([]string, er
 	}
 
 	page := c.Rand.Intn(maxPage) + 1
-	sort := sortOptions[c.Rand.Intn(len(sortOptions))]
+	sorts := q.Sorts
+	if len(sorts) == 0 {
+		sorts = sortOptions
+	}
+	sort := sorts[c.Rand.Intn(len(sorts))]
 
-	raw, err := c.fetch(ndc, count, page, yearFrom, sort)
+	raw, err := c.fetch(ctx, q, count, page, sort)
 	if err != nil {
 		return nil, err
 	}
@@ -147,17 +225,24 @@ func (c *Client) FetchRandomISBNs(ndc string, yearFrom, count int) ([]string, er
 		return nil, fmt.Errorf("JSONパース失敗: %w", err)
 	}
 
+	result := &Result{TotalResults: total, Page: page, Sort: sort, ISBNs: []string{}}
 	if len(cr.Graph) == 0 || len(cr.Graph[0].Items) == 0 {
-		return []string{}, nil
+		return result, nil
 	}
 
-	isbns := make([]string, 0, count)
+	// ISBN-10/13 やハイフンの有無が混在するため ISBN-13 に揃え、不正な ISBN は捨てる
 	for _, itm := range cr.Graph[0].Items {
 		for _, p := range itm.HasPart {
-			if strings.HasPrefix(p.ID, "urn:isbn:") {
-				isbns = append(isbns, strings.TrimPrefix(p.ID, "urn:isbn:"))
+			if !strings.HasPrefix(p.ID, "urn:isbn:") {
+				continue
+			}
+			code, err := isbn.Normalize(p.ID)
+			if err != nil || slices.Contains(result.ISBNs, code) {
+				result.Skipped++
+				continue
 			}
+			result.ISBNs = append(result.ISBNs, code)
 		}
 	}
-	return isbns, nil
+	return result, nil
 }
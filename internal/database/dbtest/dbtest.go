@@ -0,0 +1,33 @@
+// Package dbtest はデータベースを使うテストの共通処理です。
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
+)
+
+// Open は環境変数 TEST_DATABASE_URL のデータベースに接続し、マイグレーションを適用します。
+// 未設定の場合はテストをスキップします。テストはデータを書き換えるため、テスト専用のデータベースを指定してください。
+func Open(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		tb.Skip("TEST_DATABASE_URL が未設定のためスキップします")
+	}
+
+	db, err := database.Setup(dsn)
+	if err != nil {
+		tb.Fatalf("DB接続失敗: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	if _, err := database.MigrateUp(context.Background(), db); err != nil {
+		tb.Fatalf("マイグレーションエラー: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchLockKey はバッチと retry-failed が取り込みを 1 つずつ実行するためのアドバイザリロックのキーです。
+const BatchLockKey int64 = 7_007_002
+
+// LockCheckInterval はロックを保持するコネクションの生存を確認する間隔です。
+const LockCheckInterval = 10 * time.Second
+
+// AdvisoryLock はセッション単位のアドバイザリロックです。
+// ロックはセッションに紐づくため、解放するまで同じコネクションを保持し、定期的に生存を確認します。
+type AdvisoryLock struct {
+	conn *sql.Conn
+	key  int64
+	lost chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// TryAdvisoryLock はセッション単位のアドバイザリロックを待たずに取得します。
+// 他のプロセスが保持している場合は ok が false です。取得した場合は Unlock で解放します。
+func TryAdvisoryLock(ctx context.Context, db *sql.DB, key int64) (lock *AdvisoryLock, ok bool, err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("DBコネクション取得エラー: %w", err)
+	}
+
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("アドバイザリロック取得エラー: %w", err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	lock = &AdvisoryLock{conn: conn, key: key, lost: make(chan struct{}), stop: make(chan struct{})}
+	lock.wg.Add(1)
+	go lock.watch()
+	return lock, true, nil
+}
+
+// watch はコネクションが切れてロックが解放されたことを検知し、Lost をクローズします。
+func (l *AdvisoryLock) watch() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(LockCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), LockCheckInterval)
+			err := l.conn.PingContext(ctx)
+			cancel()
+			if err != nil {
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+// Lost はロックを保持するコネクションが切れた場合にクローズされます。
+// 以降は別のプロセスがロックを取得できるため、保持していた処理は中断してください。
+func (l *AdvisoryLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock はロックを解放してコネクションを返します。複数回呼び出しても構いません。
+func (l *AdvisoryLock) Unlock() {
+	l.once.Do(func() {
+		close(l.stop)
+		l.wg.Wait()
+		l.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, l.key)
+		l.conn.Close()
+	})
+}
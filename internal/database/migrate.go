@@ -0,0 +1,303 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// migrationLockKey は pg_advisory_lock に渡すキー（複数プロセスの同時実行防止用）
+const migrationLockKey int64 = 7_007_001
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrSchemaVersionMismatch はスキーマのバージョンが期待値と異なる場合のエラー
+var ErrSchemaVersionMismatch = errors.New("スキーマバージョン不一致")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrations は埋め込まれたマイグレーションをバージョン昇順で返します。
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("マイグレーション一覧取得エラー: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("不正なマイグレーションファイル名: %s", e.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("バージョンのパース失敗 (%s): %w", e.Name(), err)
+		}
+		body, err := migrationFS.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("マイグレーション読み込みエラー (%s): %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("バージョン %d の名前が一致しません: %s, %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("バージョン %d の up/down が揃っていません", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// LatestVersion はアプリケーションが期待するスキーマバージョンを返します。
+func LatestVersion() (int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// CurrentVersion は DB に適用済みの最新バージョンを返します。未適用の場合は 0 です。
+func CurrentVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("schema_migrations 確認エラー: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int64
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("スキーマバージョン取得エラー: %w", err)
+	}
+	return version, nil
+}
+
+// CheckVersion は DB のスキーマが LatestVersion と一致するかを確認します。
+func CheckVersion(ctx context.Context, db *sql.DB) error {
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+	current, err := CurrentVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current != latest {
+		return fmt.Errorf("%w: 現在 %d, 期待値 %d (migrate up を実行してください)", ErrSchemaVersionMismatch, current, latest)
+	}
+	return nil
+}
+
+// MigrateUp は未適用のマイグレーションをすべて適用し、適用件数を返します。
+func MigrateUp(ctx context.Context, db *sql.DB) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, m.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+				return fmt.Errorf("マイグレーション %d_%s 適用エラー: %w", m.Version, m.Name, err)
+			}
+			fmt.Printf("マイグレーション適用: %d_%s\n", m.Version, m.Name)
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown は適用済みのマイグレーションを新しい順に steps 件ロールバックします。
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, fmt.Errorf("steps が正の整数ではありません: %d", steps)
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && reverted < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, m.Down,
+				`DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+				return fmt.Errorf("マイグレーション %d_%s ロールバックエラー: %w", m.Version, m.Name, err)
+			}
+			fmt.Printf("マイグレーションロールバック: %d_%s\n", m.Version, m.Name)
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status は各マイグレーションの適用状況を返します。
+func Status(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("schema_migrations 確認エラー: %w", err)
+	}
+
+	done := map[int64]time.Time{}
+	if exists {
+		done, err = appliedVersions(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := done[m.Version]; ok {
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+func withMigrationLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("DBコネクション取得エラー: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("アドバイザリロック取得エラー: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	if err := ensureMigrationTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureMigrationTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT       PRIMARY KEY,
+			name       VARCHAR(255) NOT NULL DEFAULT '',
+			applied_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("schema_migrations 作成エラー: %w", err)
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, q queryer) (map[int64]time.Time, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("適用済みバージョン取得エラー: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("適用済みバージョン読み取りエラー: %w", err)
+		}
+		done[version] = at
+	}
+	return done, rows.Err()
+}
+
+func runMigration(ctx context.Context, conn *sql.Conn, ddl, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("トランザクション開始エラー: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, ddl); err != nil {
+		return fmt.Errorf("DDL実行エラー: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("schema_migrations 更新エラー: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("トランザクションコミットエラー: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package database
+
+import "testing"
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("マイグレーション読み込み失敗: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("マイグレーションが 1 件もありません")
+	}
+
+	for i, m := range migrations {
+		if want := int64(i + 1); m.Version != want {
+			t.Errorf("バージョンが連番ではありません: got %d, want %d", m.Version, want)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("%d_%s: up/down SQL が空です", m.Version, m.Name)
+		}
+	}
+
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatalf("LatestVersion 失敗: %v", err)
+	}
+	if latest != migrations[len(migrations)-1].Version {
+		t.Errorf("LatestVersion 不一致: got %d, want %d", latest, migrations[len(migrations)-1].Version)
+	}
+}
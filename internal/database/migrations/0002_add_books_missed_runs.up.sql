@@ -0,0 +1 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS missed_runs INTEGER NOT NULL DEFAULT 0;
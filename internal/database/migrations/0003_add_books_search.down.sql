@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS books_search_bigrams_idx;
+ALTER TABLE books DROP COLUMN IF EXISTS search_text;
+DROP FUNCTION IF EXISTS text_bigrams(TEXT);
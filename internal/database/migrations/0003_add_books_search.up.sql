@@ -0,0 +1,12 @@
+-- 日本語は単語境界で区切れないため、ロケールに依存しない 2-gram で索引を作る
+CREATE OR REPLACE FUNCTION text_bigrams(t TEXT) RETURNS TEXT[]
+    LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+AS $$
+    SELECT COALESCE(array_agg(DISTINCT substr(t, i, 2)), '{}')
+    FROM generate_series(1, char_length(t) - 1) AS i
+$$;
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_text TEXT
+    GENERATED ALWAYS AS (lower(title || ' ' || subtitle || ' ' || authors || ' ' || description)) STORED;
+
+CREATE INDEX IF NOT EXISTS books_search_bigrams_idx ON books USING gin (text_bigrams(search_text));
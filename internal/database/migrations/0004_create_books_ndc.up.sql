@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS books_ndc (
+    book_id    BIGINT        NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    ndc        VARCHAR(20)   NOT NULL,
+    created_at TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (book_id, ndc)
+);
+
+-- 分類コードの完全一致・前方一致での絞り込み用
+CREATE INDEX IF NOT EXISTS books_ndc_ndc_idx ON books_ndc (ndc varchar_pattern_ops, book_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS ingestion_runs (
+    id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    status      VARCHAR(20)   NOT NULL DEFAULT 'running',
+    config      JSONB         NOT NULL DEFAULT '{}'::jsonb,
+    -- NDC 分類コードごとに CiNii で見つかった ISBN の件数
+    discovered  JSONB         NOT NULL DEFAULT '{}'::jsonb,
+    enriched    INTEGER       NOT NULL DEFAULT 0,
+    failed      INTEGER       NOT NULL DEFAULT 0,
+    inserted    INTEGER       NOT NULL DEFAULT 0,
+    error       TEXT          NOT NULL DEFAULT '',
+    started_at  TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- 直近の実行や、最後にコミットされた実行の検索用
+CREATE INDEX IF NOT EXISTS ingestion_runs_status_started_at_idx ON ingestion_runs (status, started_at DESC);
+CREATE INDEX IF NOT EXISTS ingestion_runs_started_at_idx ON ingestion_runs (started_at DESC);
@@ -0,0 +1,16 @@
+-- 書誌情報を取得できなかった ISBN（batch retry-failed で再処理する）
+CREATE TABLE IF NOT EXISTS failed_enrichments (
+    isbn          VARCHAR(20)   PRIMARY KEY,
+    -- CiNii で見つかった NDC 分類コード（再処理で登録する際に books_ndc へ保存する）
+    ndc           TEXT[]        NOT NULL DEFAULT '{}',
+    error_class   VARCHAR(30)   NOT NULL DEFAULT '',
+    last_error    TEXT          NOT NULL DEFAULT '',
+    attempts      INTEGER       NOT NULL DEFAULT 0,
+    next_retry_at TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    gave_up       BOOLEAN       NOT NULL DEFAULT FALSE,
+    created_at    TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 再処理の対象（諦めていない、再試行時刻を過ぎたもの）の検索用
+CREATE INDEX IF NOT EXISTS failed_enrichments_next_retry_at_idx ON failed_enrichments (next_retry_at) WHERE NOT gave_up;
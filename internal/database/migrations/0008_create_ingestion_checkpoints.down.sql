@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ingestion_run_records;
+DROP TABLE IF EXISTS ingestion_run_targets;
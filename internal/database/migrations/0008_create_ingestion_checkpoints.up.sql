@@ -0,0 +1,25 @@
+-- 中断した実行を再開するための途中経過。実行がコミットされると削除する
+
+-- CiNii から取得済みの NDC 分類コードと、見つかった ISBN
+CREATE TABLE IF NOT EXISTS ingestion_run_targets (
+    run_id     BIGINT        NOT NULL REFERENCES ingestion_runs (id) ON DELETE CASCADE,
+    ndc        VARCHAR(20)   NOT NULL,
+    isbns      TEXT[]        NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, ndc)
+);
+
+-- 書誌情報を問い合わせ済みの ISBN。取得できた場合は record、できなかった場合は error を持つ
+CREATE TABLE IF NOT EXISTS ingestion_run_records (
+    run_id           BIGINT        NOT NULL REFERENCES ingestion_runs (id) ON DELETE CASCADE,
+    isbn             VARCHAR(20)   NOT NULL,
+    record           JSONB,
+    error_class      VARCHAR(30)   NOT NULL DEFAULT '',
+    error            TEXT          NOT NULL DEFAULT '',
+    -- 差分登録でチャンクごとにコミットした書籍
+    committed        BOOLEAN       NOT NULL DEFAULT FALSE,
+    -- failed_enrichments に記録済みの失敗
+    failure_recorded BOOLEAN       NOT NULL DEFAULT FALSE,
+    created_at       TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, isbn)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS books_search_unigrams_idx;
+DROP FUNCTION IF EXISTS text_unigrams(TEXT);
@@ -0,0 +1,9 @@
+-- 1 文字の語（猫、C など）は 2-gram が空になり 2-gram 索引で絞り込めないため、1 文字単位の索引も作る
+CREATE OR REPLACE FUNCTION text_unigrams(t TEXT) RETURNS TEXT[]
+    LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+AS $$
+    SELECT COALESCE(array_agg(DISTINCT c), '{}')
+    FROM unnest(string_to_array(t, NULL)) AS c
+$$;
+
+CREATE INDEX IF NOT EXISTS books_search_unigrams_idx ON books USING gin (text_unigrams(search_text));
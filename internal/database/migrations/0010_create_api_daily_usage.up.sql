@@ -0,0 +1,7 @@
+-- 外部 API のホストごと・日ごとのリクエスト回数。プロセスをまたいで日次の上限を数える
+CREATE TABLE IF NOT EXISTS api_daily_usage (
+    host VARCHAR(255)  NOT NULL,
+    day  DATE          NOT NULL,
+    used INTEGER       NOT NULL DEFAULT 0,
+    PRIMARY KEY (host, day)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE books DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS text_bigram_tsquery(TEXT);
+DROP FUNCTION IF EXISTS text_bigram_tsvector(TEXT, TEXT);
+DROP FUNCTION IF EXISTS text_lexeme_literal(TEXT);
@@ -0,0 +1,35 @@
+-- tsvector・tsquery の入力形式で 1 語を引用符で囲む（' と \ はエスケープする）
+CREATE OR REPLACE FUNCTION text_lexeme_literal(t TEXT) RETURNS TEXT
+    LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+AS $$
+    SELECT '''' || replace(replace(t, '\', '\\'), '''', '''''') || ''''
+$$;
+
+-- 各文字から始まる 2-gram（末尾は 1 文字）を位置と重みつきの語にした tsvector。
+-- 日本語は単語境界で区切れないため、検索の 2-gram 索引と同じ単位で ts_rank の順位付けに使う
+CREATE OR REPLACE FUNCTION text_bigram_tsvector(t TEXT, weight TEXT) RETURNS tsvector
+    LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+AS $$
+    SELECT COALESCE(string_agg(text_lexeme_literal(substr(t, i, 2)) || ':' || i || weight, ' ')::tsvector, ''::tsvector)
+    FROM generate_series(1, char_length(t)) AS i
+$$;
+
+-- 検索語の tsquery。2 文字以上の語はすべての 2-gram、1 文字の語はその文字から始まる語に一致する
+CREATE OR REPLACE FUNCTION text_bigram_tsquery(t TEXT) RETURNS tsquery
+    LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+AS $$
+    SELECT CASE
+        WHEN char_length(t) < 2 THEN (text_lexeme_literal(t) || ':*')::tsquery
+        ELSE (SELECT string_agg(text_lexeme_literal(substr(t, i, 2)), ' & ')
+              FROM generate_series(1, char_length(t) - 1) AS i)::tsquery
+    END
+$$;
+
+-- 列ごとの重み（タイトル A・サブタイトル B・著者 C・説明 D）を付けて連結する
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        text_bigram_tsvector(lower(title), 'A') ||
+        text_bigram_tsvector(lower(subtitle), 'B') ||
+        text_bigram_tsvector(lower(authors), 'C') ||
+        text_bigram_tsvector(lower(description), 'D')
+    ) STORED;
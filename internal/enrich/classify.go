@@ -0,0 +1,50 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+// 書誌情報を取得できなかった原因の種類です。failed_enrichments.error_class に保存します。
+const (
+	ClassNotFound      = "not_found"
+	ClassQuotaExceeded = "quota_exceeded"
+	ClassTimeout       = "timeout"
+	ClassNetwork       = "network"
+	// ClassRateLimited は提供元が 429（リクエスト過多）を返した場合です
+	ClassRateLimited = "rate_limited"
+	// ClassServerError は提供元が 5xx を返した場合です
+	ClassServerError = "server_error"
+	ClassOther       = "other"
+)
+
+// Classify は err の種類を返します。提供元ごとのエラーをまとめたエラーでは、上限・タイムアウト・通信エラー・ステータスコードを優先します。
+// 404 などの一時的でないステータスコードは other です。
+func Classify(err error) string {
+	var netErr net.Error
+	var statusErr *ratelimit.StatusError
+	switch {
+	case errors.Is(err, ratelimit.ErrQuotaExceeded):
+		return ClassQuotaExceeded
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ClassTimeout
+		}
+		return ClassNetwork
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests:
+		return ClassRateLimited
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 500:
+		return ClassServerError
+	case errors.Is(err, metadata.ErrNotFound):
+		return ClassNotFound
+	default:
+		return ClassOther
+	}
+}
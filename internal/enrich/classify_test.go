@@ -0,0 +1,138 @@
+package enrich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/googlebooks"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/openbd"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+const classifyISBN = "9784873115658"
+
+// 実際のクライアントが返すエラーを分類できるよう、httptest のサーバーに問い合わせる
+func newOpenBD(t *testing.T, handler http.HandlerFunc) *openbd.Client {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c := openbd.NewClient()
+	c.BaseURL = ts.URL
+	c.RetryDelay = time.Millisecond
+	c.HTTPClient.Transport = ratelimit.New(nil).Transport(nil)
+	return c
+}
+
+func newGoogleBooks(t *testing.T, handler http.HandlerFunc) *googlebooks.Client {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c := googlebooks.NewClient("key")
+	c.BaseURL = ts.URL
+	c.RetryDelay = time.Millisecond
+	c.HTTPClient.Transport = ratelimit.New(nil).Transport(nil)
+	return c
+}
+
+func status(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider func(t *testing.T) metadata.Provider
+		want     string
+	}{
+		{
+			name: "見つからない",
+			provider: func(t *testing.T) metadata.Provider {
+				return newOpenBD(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`[null]`)) })
+			},
+			want: ClassNotFound,
+		},
+		{
+			name: "日次上限",
+			provider: func(t *testing.T) metadata.Provider {
+				c := newGoogleBooks(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) })
+				c.HTTPClient.Transport = ratelimit.New(map[string]ratelimit.Limit{ratelimit.DefaultHost: {Daily: 1}}).Transport(nil)
+				// 1 回目で上限に達する
+				c.Lookup(context.Background(), classifyISBN)
+				return c
+			},
+			want: ClassQuotaExceeded,
+		},
+		{
+			name: "タイムアウト",
+			provider: func(t *testing.T) metadata.Provider {
+				c := newGoogleBooks(t, func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(time.Second):
+					}
+				})
+				c.HTTPClient.Timeout = 50 * time.Millisecond
+				return c
+			},
+			want: ClassTimeout,
+		},
+		{
+			name: "通信エラー",
+			provider: func(t *testing.T) metadata.Provider {
+				ts := httptest.NewServer(http.NotFoundHandler())
+				ts.Close()
+				c := newOpenBD(t, nil)
+				c.BaseURL = ts.URL
+				return c
+			},
+			want: ClassNetwork,
+		},
+		{
+			name:     "429",
+			provider: func(t *testing.T) metadata.Provider { return newGoogleBooks(t, status(http.StatusTooManyRequests)) },
+			want:     ClassRateLimited,
+		},
+		{
+			name:     "5xx",
+			provider: func(t *testing.T) metadata.Provider { return newOpenBD(t, status(http.StatusServiceUnavailable)) },
+			want:     ClassServerError,
+		},
+		{
+			name:     "一時的でないステータスコード",
+			provider: func(t *testing.T) metadata.Provider { return newGoogleBooks(t, status(http.StatusForbidden)) },
+			want:     ClassOther,
+		},
+		{
+			name: "フォールバックでは見つからないより障害を優先",
+			provider: func(t *testing.T) metadata.Provider {
+				return metadata.Chain{
+					newOpenBD(t, status(http.StatusBadGateway)),
+					newGoogleBooks(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) }),
+				}
+			},
+			want: ClassServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.provider(t).Lookup(context.Background(), classifyISBN)
+			if err == nil {
+				t.Fatal("エラーが返されませんでした")
+			}
+			if got := Classify(err); got != tt.want {
+				t.Errorf("got %s, want %s (err: %v)", got, tt.want, err)
+			}
+		})
+	}
+}
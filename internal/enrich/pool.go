@@ -0,0 +1,84 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+// DefaultWorkers は同時に問い合わせる ISBN 数の既定値です。
+const DefaultWorkers = 4
+
+// Pool は Workers 個のゴルーチンで ISBN ごとに Provider へ問い合わせます。
+// 外部 API ごとの間隔は ratelimit で制御するため、ワーカー数を増やしても制限は守られます。
+type Pool struct {
+	Provider metadata.Provider
+	Workers  int
+	// Fatal は実行全体を止めるべきエラーかを判定します。nil の場合は IsFatal を使います。
+	Fatal func(error) bool
+	// OnError は致命的でないエラー（見つからない ISBN など）の通知先です。複数のワーカーから同時に呼ばれます。
+	OnError func(isbn string, err error)
+}
+
+// IsFatal は既定の致命的なエラーの判定です。日次上限に達した場合は続けても取得できないため止めます。
+func IsFatal(err error) bool {
+	return errors.Is(err, ratelimit.ErrQuotaExceeded)
+}
+
+// Run は isbns から ISBN を受け取り、取得できた書誌情報を out に送ります。送る順序は問いません。
+// isbns がクローズされ、すべてのワーカーが終了すると戻ります。致命的なエラーや ctx のキャンセルの場合は
+// 残りのワーカーを止め、すべて終了してからそのエラーを返します。out はクローズしません。
+func (p *Pool) Run(ctx context.Context, isbns <-chan string, out chan<- *metadata.Record) error {
+	workers := p.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	fatal := p.Fatal
+	if fatal == nil {
+		fatal = IsFatal
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for range workers {
+		g.Go(func() error {
+			for {
+				var isbn string
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case code, ok := <-isbns:
+					if !ok {
+						return nil
+					}
+					isbn = code
+				}
+
+				rec, err := p.Provider.Lookup(ctx, isbn)
+				if err != nil {
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						return ctxErr
+					}
+					if fatal(err) {
+						return fmt.Errorf("書誌情報取得エラー (isbn: %s): %w", isbn, err)
+					}
+					if p.OnError != nil {
+						p.OnError(isbn, err)
+					}
+					continue
+				}
+
+				select {
+				case out <- rec:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		})
+	}
+	return g.Wait()
+}
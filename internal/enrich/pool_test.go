@@ -0,0 +1,166 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+// fakeProvider は ISBN ごとに決めた結果を少し待ってから返します。同時実行数の最大値を記録します。
+type fakeProvider struct {
+	delay   time.Duration
+	errs    map[string]error
+	active  atomic.Int32
+	maxSeen atomic.Int32
+	calls   atomic.Int32
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Lookup(ctx context.Context, isbn string) (*metadata.Record, error) {
+	p.calls.Add(1)
+	n := p.active.Add(1)
+	defer p.active.Add(-1)
+	for {
+		m := p.maxSeen.Load()
+		if n <= m || p.maxSeen.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if err := p.errs[isbn]; err != nil {
+		return nil, err
+	}
+	return &metadata.Record{ISBN: isbn, Title: "title " + isbn}, nil
+}
+
+func feed(isbns []string) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for _, isbn := range isbns {
+			ch <- isbn
+		}
+	}()
+	return ch
+}
+
+func testISBNs(n int) []string {
+	isbns := make([]string, n)
+	for i := range isbns {
+		isbns[i] = fmt.Sprintf("isbn-%02d", i)
+	}
+	return isbns
+}
+
+func TestPoolRun(t *testing.T) {
+	isbns := testISBNs(30)
+	provider := &fakeProvider{
+		delay: 5 * time.Millisecond,
+		errs: map[string]error{
+			"isbn-03": metadata.ErrNotFound,
+			"isbn-17": errors.New("503"),
+		},
+	}
+
+	var mu sync.Mutex
+	var failed []string
+	pool := &Pool{
+		Provider: provider,
+		Workers:  4,
+		OnError: func(isbn string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, isbn)
+		},
+	}
+
+	out := make(chan *metadata.Record)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- pool.Run(context.Background(), feed(isbns), out)
+		close(out)
+	}()
+
+	var got []string
+	for rec := range out {
+		got = append(got, rec.ISBN)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	if len(got) != len(isbns)-2 {
+		t.Errorf("取得件数不一致: got %d, want %d", len(got), len(isbns)-2)
+	}
+	sort.Strings(failed)
+	if fmt.Sprint(failed) != "[isbn-03 isbn-17]" {
+		t.Errorf("エラーの通知が不正です: %v", failed)
+	}
+	if m := provider.maxSeen.Load(); m < 2 || m > 4 {
+		t.Errorf("同時実行数がワーカー数の範囲外です: %d", m)
+	}
+}
+
+func TestPoolRunStopsOnFatalError(t *testing.T) {
+	isbns := testISBNs(100)
+	provider := &fakeProvider{
+		delay: 2 * time.Millisecond,
+		errs:  map[string]error{"isbn-05": fmt.Errorf("googlebooks: %w", ratelimit.ErrQuotaExceeded)},
+	}
+	pool := &Pool{Provider: provider, Workers: 3}
+
+	out := make(chan *metadata.Record, len(isbns))
+	err := pool.Run(context.Background(), feed(isbns), out)
+	if !errors.Is(err, ratelimit.ErrQuotaExceeded) {
+		t.Fatalf("ErrQuotaExceeded を期待しましたが %v", err)
+	}
+
+	// Run が戻った時点ですべてのワーカーが終了しているため、以降は呼ばれない
+	calls := provider.calls.Load()
+	time.Sleep(20 * time.Millisecond)
+	if provider.calls.Load() != calls || provider.active.Load() != 0 {
+		t.Errorf("Run の終了後もワーカーが動いています")
+	}
+	if calls >= int32(len(isbns)) {
+		t.Errorf("致命的なエラーの後も処理を続けています: %d 件", calls)
+	}
+}
+
+func TestPoolRunCanceled(t *testing.T) {
+	provider := &fakeProvider{delay: time.Second}
+	pool := &Pool{Provider: provider, Workers: 2}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	isbns := make(chan string) // クローズしない
+	out := make(chan *metadata.Record)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- pool.Run(ctx, isbns, out) }()
+
+	isbns <- "isbn-00"
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("context.Canceled を期待しましたが %v", err)
+		}
+	case <-time.After(time.Second / 2):
+		t.Fatal("キャンセル後も Run が戻りません")
+	}
+}
@@ -1,26 +1,42 @@
 package googlebooks
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/avast/retry-go"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/isbn"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+const (
+	// ProviderName は metadata.Provider としての名前です。
+	ProviderName = "googlebooks"
+	// DefaultBaseURL は Google Books API の URL です。テストでは httptest のサーバーに差し替えます。
+	DefaultBaseURL = "https://www.googleapis.com/books/v1"
 )
 
 type Client struct {
 	HTTPClient *http.Client
+	BaseURL    string
 	APIKey     string
-	FetchDelay time.Duration
+	// RetryDelay は失敗したリクエストを再送するまでの初回の待ち時間です（以降は倍々に延びる）
+	RetryDelay time.Duration
 }
 
 func NewClient(apiKey string) *Client {
 	return &Client{
-		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		HTTPClient: &http.Client{Timeout: 10 * time.Second, Transport: ratelimit.Shared().Transport(nil)},
+		BaseURL:    DefaultBaseURL,
 		APIKey:     apiKey,
-		FetchDelay: 1 * time.Second,
+		RetryDelay: 2 * time.Second,
 	}
 }
 
@@ -43,22 +59,32 @@ type GoogleBooksResponse struct {
 	} `json:"items"`
 }
 
-func (c *Client) Fetch(isbn string) (*VolumeInfo, error) {
-	time.Sleep(c.FetchDelay) // レート制限準拠のため
+// Fetch は ISBN で書籍を検索します。不正な ISBN はリクエストせずに isbn.ErrInvalid を返します。
+func (c *Client) Fetch(ctx context.Context, code string) (*VolumeInfo, error) {
+	normalized, err := isbn.Normalize(code)
+	if err != nil {
+		return nil, err
+	}
 
-	url := fmt.Sprintf("https://www.googleapis.com/books/v1/volumes?q=isbn:%s&key=%s", isbn, c.APIKey)
+	// API キーはエラーやログに出る URL に含めないよう、ヘッダーで送る
+	u := fmt.Sprintf("%s/volumes?q=%s", strings.TrimSuffix(c.BaseURL, "/"), url.QueryEscape("isbn:"+normalized))
 
 	var body []byte
-	err := retry.Do(
+	err = retry.Do(
 		func() error {
-			resp, err := c.HTTPClient.Get(url)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+			if err != nil {
+				return retry.Unrecoverable(fmt.Errorf("リクエスト作成失敗: %w", err))
+			}
+			req.Header.Set("X-Goog-Api-Key", c.APIKey)
+			resp, err := c.HTTPClient.Do(req)
 			if err != nil {
 				return fmt.Errorf("HTTPリクエスト失敗: %w", err)
 			}
 			defer resp.Body.Close()
 
 			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("不正なステータスコード: %d", resp.StatusCode)
+				return &ratelimit.StatusError{StatusCode: resp.StatusCode}
 			}
 
 			body, err = io.ReadAll(resp.Body)
@@ -69,9 +95,15 @@ func (c *Client) Fetch(isbn string) (*VolumeInfo, error) {
 		},
 		retry.Attempts(3),
 		retry.DelayType(retry.BackOffDelay),
-		retry.Delay(2*time.Second),
+		retry.Delay(c.RetryDelay),
+		retry.RetryIf(ratelimit.Retryable),
+		retry.Context(ctx),
+		retry.LastErrorOnly(true),
 	)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, fmt.Errorf("google books API リクエストエラー: %w", err)
 	}
 
@@ -81,8 +113,38 @@ func (c *Client) Fetch(isbn string) (*VolumeInfo, error) {
 	}
 
 	if len(response.Items) == 0 {
-		return nil, fmt.Errorf("ISBN %s の書籍が見つかりません", isbn)
+		return nil, fmt.Errorf("ISBN %s: %w", normalized, metadata.ErrNotFound)
 	}
 
 	return &response.Items[0].VolumeInfo, nil
 }
+
+func (c *Client) Name() string {
+	return ProviderName
+}
+
+// Lookup は Fetch の結果を metadata.Record に変換します。
+func (c *Client) Lookup(ctx context.Context, code string) (*metadata.Record, error) {
+	normalized, err := isbn.Normalize(code)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := c.Fetch(ctx, normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadata.Record{
+		ISBN:          normalized,
+		Title:         info.Title,
+		Subtitle:      info.Subtitle,
+		Authors:       info.Authors,
+		Publisher:     info.Publisher,
+		PublishedDate: info.PublishedDate,
+		Description:   info.Description,
+		BookURL:       info.InfoLink,
+		ImageURL:      info.ImageLinks.Thumbnail,
+		Source:        ProviderName,
+	}, nil
+}
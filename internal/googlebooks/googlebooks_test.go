@@ -0,0 +1,104 @@
+package googlebooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+const (
+	testKey      = "secret-api-key"
+	readableCode = "9784873115658"
+)
+
+const volumes = `{"items":[{"volumeInfo":{"title":"リーダブルコード","authors":["Dustin Boswell","Trevor Foucher"],"publisher":"オライリー・ジャパン"}}]}`
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c := NewClient(testKey)
+	c.BaseURL = ts.URL + "/books/v1"
+	// 共有の Limiter の使用回数に影響しないよう、テストごとの Limiter を使う
+	c.HTTPClient.Transport = ratelimit.New(nil).Transport(nil)
+	return c
+}
+
+func TestLookup(t *testing.T) {
+	var gotKey, gotQuery string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-Goog-Api-Key")
+		gotQuery = r.URL.RawQuery
+		if r.URL.Path != "/books/v1/volumes" || r.URL.Query().Get("q") != "isbn:"+readableCode {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(volumes))
+	})
+
+	rec, err := c.Lookup(context.Background(), "4-87311-565-5")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if rec.ISBN != readableCode || rec.Title != "リーダブルコード" || rec.Source != ProviderName {
+		t.Errorf("書誌情報不一致: %+v", rec)
+	}
+	if gotKey != testKey {
+		t.Errorf("API キーのヘッダー不一致: got %q, want %q", gotKey, testKey)
+	}
+	if strings.Contains(gotQuery, testKey) {
+		t.Errorf("API キーが URL に含まれています: %s", gotQuery)
+	}
+
+	if _, err := c.Lookup(context.Background(), "9784003101018"); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("metadata.ErrNotFound が返されませんでした: %v", err)
+	}
+}
+
+func TestFetchQuotaExceeded(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(volumes))
+	})
+	c.HTTPClient.Transport = ratelimit.New(map[string]ratelimit.Limit{ratelimit.DefaultHost: {Daily: 1}}).Transport(nil)
+
+	if _, err := c.Fetch(context.Background(), readableCode); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	_, err := c.Fetch(context.Background(), readableCode)
+	if !errors.Is(err, ratelimit.ErrQuotaExceeded) {
+		t.Fatalf("ratelimit.ErrQuotaExceeded が返されませんでした: %v", err)
+	}
+	if strings.Contains(err.Error(), testKey) {
+		t.Errorf("エラーに API キーが含まれています: %v", err)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	c.HTTPClient.Timeout = 50 * time.Millisecond
+
+	_, err := c.Fetch(context.Background(), readableCode)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("タイムアウトの net.Error が返されませんでした: %v", err)
+	}
+	if strings.Contains(err.Error(), testKey) {
+		t.Errorf("エラーに API キーが含まれています: %v", err)
+	}
+}
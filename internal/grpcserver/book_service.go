@@ -2,61 +2,96 @@ package grpcserver
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 
 	pb "github.com/taiki-umetsu/ndc007-bookpicker/api/v1"
-)
-
-const (
-	defaultRandomCount = 3
-	maxRandomCount     = 10
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndc"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
 )
 
 type BookServiceServer struct {
 	pb.UnimplementedBookServiceServer
-	DB *sql.DB
+	Books repository.BookRepository
+}
+
+func NewBookServiceServer(books repository.BookRepository) *BookServiceServer {
+	return &BookServiceServer{Books: books}
 }
 
-func NewBookServiceServer(db *sql.DB) *BookServiceServer {
-	return &BookServiceServer{DB: db}
+func newPBBook(b *book.Book) *pb.Book {
+	return &pb.Book{
+		Id:            b.ID,
+		Isbn:          b.ISBN,
+		Title:         b.Title,
+		Subtitle:      b.Subtitle,
+		Authors:       book.JoinAuthors(b.Authors),
+		Publisher:     b.Publisher,
+		PublishedDate: b.PublishedDate,
+		Description:   b.Description,
+		BookUrl:       b.BookURL,
+		ImageUrl:      b.ImageURL,
+		Ndc:           b.NDC,
+	}
 }
 
 func (s *BookServiceServer) GetRandomBooks(ctx context.Context, req *pb.RandomBooksRequest) (*pb.RandomBooksResponse, error) {
 	count := int(req.Count)
 	if count <= 0 {
-		count = defaultRandomCount
+		count = repository.DefaultRandomCount
 	}
-	if count > maxRandomCount {
-		return nil, fmt.Errorf("count must be between 1 and %d", maxRandomCount)
+	if count > repository.MaxRandomCount {
+		return nil, fmt.Errorf("count must be between 1 and %d", repository.MaxRandomCount)
 	}
 
-	const query = `
-		SELECT id, isbn, title, subtitle, authors, publisher,
-		       published_date, description, book_url, image_url
-		FROM books
-		ORDER BY RANDOM()
-		LIMIT $1
-	`
+	params := repository.RandomParams{Count: count}
+	if req.Ndc != "" {
+		p, err := ndc.ParsePattern(req.Ndc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ndc: %q", req.Ndc)
+		}
+		params.NDC = p
+	}
 
-	rows, err := s.DB.QueryContext(ctx, query, count)
+	books, err := s.Books.Random(ctx, params)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var books []*pb.Book
-	for rows.Next() {
-		var b pb.Book
-		if err := rows.Scan(
-			&b.Id, &b.Isbn, &b.Title, &b.Subtitle,
-			&b.Authors, &b.Publisher, &b.PublishedDate,
-			&b.Description, &b.BookUrl, &b.ImageUrl,
-		); err != nil {
-			return nil, err
-		}
-		books = append(books, &b)
+
+	res := make([]*pb.Book, 0, len(books))
+	for _, b := range books {
+		res = append(res, newPBBook(b))
+	}
+
+	return &pb.RandomBooksResponse{Books: res}, nil
+}
+
+func (s *BookServiceServer) SearchBooks(ctx context.Context, req *pb.SearchBooksRequest) (*pb.SearchBooksResponse, error) {
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = repository.DefaultListLimit
+	}
+	if limit > repository.MaxListLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", repository.MaxListLimit)
+	}
+
+	results, err := s.Books.Search(ctx, req.Query, limit)
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		return nil, fmt.Errorf("query must be between 1 and %d characters", repository.MaxSearchQueryLength)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]*pb.SearchHit, 0, len(results))
+	for _, r := range results {
+		hits = append(hits, &pb.SearchHit{
+			Book:    newPBBook(r.Book),
+			Rank:    r.Rank,
+			Snippet: r.Snippet,
+		})
 	}
 
-	return &pb.RandomBooksResponse{Books: books}, nil
+	return &pb.SearchBooksResponse{Hits: hits}, nil
 }
@@ -2,40 +2,25 @@ package grpcserver_test
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log"
 	"net"
-	"os"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	pb "github.com/taiki-umetsu/ndc007-bookpicker/api/v1"
-	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
-	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/grpcserver"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 func TestBookService_GetRandomBooks(t *testing.T) {
-	env.Load()
+	repo := setupTestData(t)
 
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		t.Skip("環境変数 DATABASE_URL が未設定のためテストをスキップします")
-	}
-
-	db, err := database.Setup(dsn)
-	if err != nil {
-		t.Fatalf("DB接続エラー: %v", err)
-	}
-	defer db.Close()
-
-	setupTestData(t, db)
-
-	addr, stop := setupGRPCServer(t, db)
+	addr, stop := setupGRPCServer(t, repo)
 	defer stop()
 
 	client := setupGRPCClient(t, addr)
@@ -43,6 +28,7 @@ func TestBookService_GetRandomBooks(t *testing.T) {
 	tests := []struct {
 		name          string
 		requestCount  int32
+		ndc           string
 		expectedCount int
 		expectError   bool
 		errorContains string
@@ -84,6 +70,27 @@ func TestBookService_GetRandomBooks(t *testing.T) {
 			expectedCount: 3, // デフォルト値が使われる
 			expectError:   false,
 		},
+		{
+			name:          "NDC完全一致",
+			requestCount:  10,
+			ndc:           "913.6",
+			expectedCount: 5,
+			expectError:   false,
+		},
+		{
+			name:          "NDC前方一致",
+			requestCount:  10,
+			ndc:           "913*",
+			expectedCount: 6,
+			expectError:   false,
+		},
+		{
+			name:          "NDC不正",
+			requestCount:  1,
+			ndc:           "913.x",
+			expectError:   true,
+			errorContains: "invalid ndc",
+		},
 	}
 
 	for _, tt := range tests {
@@ -91,7 +98,7 @@ func TestBookService_GetRandomBooks(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
-			resp, err := client.GetRandomBooks(ctx, &pb.RandomBooksRequest{Count: tt.requestCount})
+			resp, err := client.GetRandomBooks(ctx, &pb.RandomBooksRequest{Count: tt.requestCount, Ndc: tt.ndc})
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -114,68 +121,129 @@ func TestBookService_GetRandomBooks(t *testing.T) {
 	}
 }
 
-func setupTestData(t *testing.T, db *sql.DB) {
-	t.Helper()
+func TestBookService_SearchBooks(t *testing.T) {
+	repo := setupTestData(t)
+
+	addr, stop := setupGRPCServer(t, repo)
+	defer stop()
 
-	if _, err := db.Exec(`TRUNCATE books`); err != nil {
-		t.Fatalf("TRUNCATE失敗: %v", err)
+	client := setupGRPCClient(t, addr)
+
+	tests := []struct {
+		name          string
+		query         string
+		limit         int32
+		expectedCount int
+		expectError   bool
+		errorContains string
+	}{
+		{
+			name:          "著者で検索",
+			query:         "太宰",
+			expectedCount: 2,
+		},
+		{
+			name:          "複数語で検索",
+			query:         "宮沢 友情",
+			expectedCount: 1,
+		},
+		{
+			name:          "件数指定",
+			query:         "夏目漱石",
+			limit:         2,
+			expectedCount: 2,
+		},
+		{
+			name:          "一致なし",
+			query:         "データベース",
+			expectedCount: 0,
+		},
+		{
+			name:          "空の検索語",
+			query:         " ",
+			expectError:   true,
+			errorContains: "query must be between 1 and 100 characters",
+		},
+		{
+			name:          "件数上限超過",
+			query:         "夏目",
+			limit:         101,
+			expectError:   true,
+			errorContains: "limit must be between 1 and 100",
+		},
 	}
 
-	insertQuery := `
-		INSERT INTO books (
-			isbn, title, subtitle, authors, publisher,
-			published_date, description, book_url, image_url
-		) VALUES 
-		('9784003101018', '吾輩は猫である', '', '夏目漱石', '岩波書店',
-		 '1905-01-01', '猫の視点から人間社会を描いた名作',
-		 'https://example.com/neko', 'https://example.com/neko.jpg'),
-		('9784003101025', '坊っちゃん', '', '夏目漱石', '岩波書店',
-		 '1906-01-01', '正義感の強い青年教師の物語',
-		 'https://example.com/botchan', 'https://example.com/botchan.jpg'),
-		('9784003101032', 'こころ', '', '夏目漱石', '岩波書店',
-		 '1914-01-01', '友情と愛情の葛藤を描いた心理小説',
-		 'https://example.com/kokoro', 'https://example.com/kokoro.jpg'),
-		('9784003101049', '羅生門', '', '芥川龍之介', '岩波書店',
-		 '1915-01-01', '人間のエゴイズムを描いた短編小説',
-		 'https://example.com/rashomon', 'https://example.com/rashomon.jpg'),
-		('9784003101056', '蜘蛛の糸', '', '芥川龍之介', '岩波書店',
-		 '1918-01-01', '仏教的な慈悲を題材にした寓話',
-		 'https://example.com/kumo', 'https://example.com/kumo.jpg'),
-		('9784003101063', '人間失格', '', '太宰治', '岩波書店',
-		 '1948-01-01', '自己嫌悪と絶望を描いた自伝的小説',
-		 'https://example.com/ningen', 'https://example.com/ningen.jpg'),
-		('9784003101070', '走れメロス', '', '太宰治', '岩波書店',
-		 '1940-01-01', '友情と信頼をテーマにした短編小説',
-		 'https://example.com/melos', 'https://example.com/melos.jpg'),
-		('9784003101087', '銀河鉄道の夜', '', '宮沢賢治', '岩波書店',
-		 '1934-01-01', '幻想的な世界観で描かれた友情の物語',
-		 'https://example.com/ginga', 'https://example.com/ginga.jpg'),
-		('9784003101094', '風の又三郎', '', '宮沢賢治', '岩波書店',
-		 '1931-01-01', '転校生を巡る子供たちの物語',
-		 'https://example.com/kaze', 'https://example.com/kaze.jpg'),
-		('9784003101100', '檸檬', '', '梶井基次郎', '岩波書店',
-		 '1925-01-01', '青年の心境を詩的に描いた短編',
-		 'https://example.com/lemon', 'https://example.com/lemon.jpg')
-	`
-
-	if _, err := db.Exec(insertQuery); err != nil {
-		t.Fatalf("テストデータ挿入失敗: %v", err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			resp, err := client.SearchBooks(ctx, &pb.SearchBooksRequest{Query: tt.query, Limit: tt.limit})
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorContains)
+				assert.Nil(t, resp)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, resp.Hits, tt.expectedCount)
+			for _, hit := range resp.Hits {
+				assert.NotEmpty(t, hit.Book.Isbn)
+				assert.Greater(t, hit.Rank, 0.0)
+				assert.Contains(t, hit.Snippet, "<mark>")
+			}
+		})
 	}
+}
+
+func setupTestData(t *testing.T) repository.BookRepository {
+	t.Helper()
 
-	var count int
-	if err := db.QueryRow("SELECT COUNT(*) FROM books").Scan(&count); err != nil {
-		t.Fatalf("データ確認失敗: %v", err)
+	books := []*book.Book{
+		book.NewBook("9784003101018", "吾輩は猫である", "", []string{"夏目漱石"}, "岩波書店",
+			"1905-01-01", "猫の視点から人間社会を描いた名作",
+			"https://example.com/neko", "https://example.com/neko.jpg"),
+		book.NewBook("9784003101025", "坊っちゃん", "", []string{"夏目漱石"}, "岩波書店",
+			"1906-01-01", "正義感の強い青年教師の物語",
+			"https://example.com/botchan", "https://example.com/botchan.jpg"),
+		book.NewBook("9784003101032", "こころ", "", []string{"夏目漱石"}, "岩波書店",
+			"1914-01-01", "友情と愛情の葛藤を描いた心理小説",
+			"https://example.com/kokoro", "https://example.com/kokoro.jpg"),
+		book.NewBook("9784003101049", "羅生門", "", []string{"芥川龍之介"}, "岩波書店",
+			"1915-01-01", "人間のエゴイズムを描いた短編小説",
+			"https://example.com/rashomon", "https://example.com/rashomon.jpg"),
+		book.NewBook("9784003101056", "蜘蛛の糸", "", []string{"芥川龍之介"}, "岩波書店",
+			"1918-01-01", "仏教的な慈悲を題材にした寓話",
+			"https://example.com/kumo", "https://example.com/kumo.jpg"),
+		book.NewBook("9784003101063", "人間失格", "", []string{"太宰治"}, "岩波書店",
+			"1948-01-01", "自己嫌悪と絶望を描いた自伝的小説",
+			"https://example.com/ningen", "https://example.com/ningen.jpg"),
+		book.NewBook("9784003101070", "走れメロス", "", []string{"太宰治"}, "岩波書店",
+			"1940-01-01", "友情と信頼をテーマにした短編小説",
+			"https://example.com/melos", "https://example.com/melos.jpg"),
+		book.NewBook("9784003101087", "銀河鉄道の夜", "", []string{"宮沢賢治"}, "岩波書店",
+			"1934-01-01", "幻想的な世界観で描かれた友情の物語",
+			"https://example.com/ginga", "https://example.com/ginga.jpg"),
+		book.NewBook("9784003101094", "風の又三郎", "", []string{"宮沢賢治"}, "岩波書店",
+			"1931-01-01", "転校生を巡る子供たちの物語",
+			"https://example.com/kaze", "https://example.com/kaze.jpg"),
+		book.NewBook("9784003101100", "檸檬", "", []string{"梶井基次郎"}, "岩波書店",
+			"1925-01-01", "青年の心境を詩的に描いた短編",
+			"https://example.com/lemon", "https://example.com/lemon.jpg"),
 	}
-	if count != 10 {
-		t.Fatalf("期待されるデータ件数: 10, 実際: %d", count)
+
+	for _, b := range books[:4] {
+		b.NDC = []string{"913.6"}
 	}
+	books[4].NDC = []string{"913.8"}
+	books[5].NDC = []string{"913.6", "913.8"}
 
-	t.Cleanup(func() {
-		db.Exec(`TRUNCATE books`)
-	})
+	return repository.NewMemoryBookRepository(books...)
 }
 
-func setupGRPCServer(t *testing.T, db *sql.DB) (addr string, stop func()) {
+func setupGRPCServer(t *testing.T, repo repository.BookRepository) (addr string, stop func()) {
 	t.Helper()
 
 	lis, err := net.Listen("tcp", "localhost:0") // :0 で空いてるポート自動選択
@@ -184,7 +252,7 @@ func setupGRPCServer(t *testing.T, db *sql.DB) (addr string, stop func()) {
 	}
 
 	s := grpc.NewServer()
-	pb.RegisterBookServiceServer(s, grpcserver.NewBookServiceServer(db))
+	pb.RegisterBookServiceServer(s, grpcserver.NewBookServiceServer(repo))
 
 	go func() {
 		if err := s.Serve(lis); err != nil {
@@ -0,0 +1,120 @@
+package isbn
+
+import "strings"
+
+// groupRange は接頭記号ごとの登録グループ番号の範囲です。from と同じ桁数がグループ番号になります。
+type groupRange struct {
+	prefix   string
+	from, to string
+}
+
+// 国際 ISBN 機関の RangeMessage に基づく登録グループの範囲
+var groupRanges = []groupRange{
+	{"978", "0", "5"},
+	{"978", "600", "649"},
+	{"978", "65", "65"},
+	{"978", "7", "7"},
+	{"978", "80", "94"},
+	{"978", "950", "989"},
+	{"978", "9900", "9989"},
+	{"978", "99900", "99999"},
+	{"979", "10", "12"},
+	{"979", "8", "8"},
+}
+
+// registrantRange は出版者記号の範囲です。出版者記号と書名記号の先頭 7 桁で比較し、length 桁を出版者記号とします。
+type registrantRange struct {
+	from, to string
+	length   int
+}
+
+// 登録グループごとの出版者記号の区分。ここにない登録グループは出版者記号で区切りません。
+var registrantRanges = map[string][]registrantRange{
+	"978-0": {
+		{"0000000", "1999999", 2},
+		{"2000000", "2279999", 3},
+		{"2280000", "2289999", 4},
+		{"2290000", "3689999", 3},
+		{"3690000", "3699999", 4},
+		{"3700000", "6389999", 3},
+		{"6390000", "6397999", 4},
+		{"6398000", "6399999", 7},
+		{"6400000", "6447999", 3},
+		{"6448000", "6449999", 7},
+		{"6450000", "6479999", 3},
+		{"6480000", "6489999", 7},
+		{"6490000", "6549999", 3},
+		{"6550000", "6559999", 4},
+		{"6560000", "6999999", 3},
+		{"7000000", "8499999", 4},
+		{"8500000", "8999999", 5},
+		{"9000000", "9499999", 6},
+		{"9500000", "9999999", 7},
+	},
+	"978-1": {
+		{"0000000", "0999999", 2},
+		{"1000000", "3999999", 3},
+		{"4000000", "5499999", 4},
+		{"5500000", "8697999", 5},
+		{"8698000", "9989999", 6},
+		{"9990000", "9999999", 7},
+	},
+	"978-4": {
+		{"0000000", "1999999", 2},
+		{"2000000", "6999999", 3},
+		{"7000000", "8499999", 4},
+		{"8500000", "8999999", 5},
+		{"9000000", "9499999", 6},
+		{"9500000", "9999999", 7},
+	},
+}
+
+// Hyphenated は登録グループと出版者記号で区切った ISBN-13（例: 978-4-00-310101-8）を返します。
+// 出版者記号の区分が分からない登録グループは、接頭記号・登録グループ・残り・チェックディジットで区切ります。
+func (i ISBN) Hyphenated() string {
+	if i.IsZero() {
+		return ""
+	}
+	prefix, rest, check := i.digits[:3], i.digits[3:12], i.digits[12:]
+
+	group := findGroup(prefix, rest)
+	if group == "" {
+		return i.digits
+	}
+	rest = rest[len(group):]
+
+	head := (rest + "0000000")[:7]
+	for _, r := range registrantRanges[prefix+"-"+group] {
+		if head >= r.from && head <= r.to && r.length < len(rest) {
+			return strings.Join([]string{prefix, group, rest[:r.length], rest[r.length:], check}, "-")
+		}
+	}
+	return strings.Join([]string{prefix, group, rest, check}, "-")
+}
+
+// Hyphenated10 はハイフンで区切った ISBN-10（例: 4-00-310101-4）を返します。ISBN-10 がない場合は false です。
+func (i ISBN) Hyphenated10() (string, bool) {
+	s10, ok := i.ISBN10()
+	if !ok {
+		return "", false
+	}
+	h := i.Hyphenated()
+	if !strings.HasPrefix(h, "978-") {
+		return s10, true
+	}
+	// 978- を除き、チェックディジットを ISBN-10 のものに差し替える
+	body := strings.TrimPrefix(h, "978-")
+	return body[:len(body)-1] + s10[9:], true
+}
+
+func findGroup(prefix, rest string) string {
+	for _, g := range groupRanges {
+		if g.prefix != prefix || len(g.from) > len(rest) {
+			continue
+		}
+		if head := rest[:len(g.from)]; head >= g.from && head <= g.to {
+			return head
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package isbn
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalid = errors.New("ISBN の形式が不正です")
+
+var digitsRe = regexp.MustCompile(`^(\d{9}[\dX]|\d{13})$`)
+
+// ISBN は正規化済みの ISBN です。内部では ISBN-13 の 13 桁で保持します。
+// ゼロ値は無効な ISBN を表します。
+type ISBN struct {
+	digits string
+}
+
+// Parse は ISBN-10/13 を解釈します。ハイフン・空白、"urn:isbn:" や "ISBN" の接頭辞は無視し、
+// チェックディジットが一致しない場合は ErrInvalid を返します。
+func Parse(s string) (ISBN, error) {
+	raw := s
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "urn:isbn:")
+	s = strings.ToUpper(s)
+	s = strings.TrimPrefix(s, "ISBN")
+	s = strings.NewReplacer("-", "", " ", "", ":", "").Replace(s)
+
+	if !digitsRe.MatchString(s) {
+		return ISBN{}, fmt.Errorf("%w: %q", ErrInvalid, raw)
+	}
+
+	if len(s) == 10 {
+		if !validISBN10(s) {
+			return ISBN{}, fmt.Errorf("%w: チェックディジット不一致 %q", ErrInvalid, raw)
+		}
+		body := "978" + s[:9]
+		return ISBN{digits: body + string(isbn13CheckDigit(body))}, nil
+	}
+
+	if isbn13CheckDigit(s[:12]) != s[12] {
+		return ISBN{}, fmt.Errorf("%w: チェックディジット不一致 %q", ErrInvalid, raw)
+	}
+	if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+		return ISBN{}, fmt.Errorf("%w: 接頭記号が 978/979 ではありません %q", ErrInvalid, raw)
+	}
+	return ISBN{digits: s}, nil
+}
+
+// Normalize は s を ISBN-13 の 13 桁に正規化します。
+func Normalize(s string) (string, error) {
+	i, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return i.ISBN13(), nil
+}
+
+// IsZero は無効な（ゼロ値の）ISBN かどうかを返します。
+func (i ISBN) IsZero() bool {
+	return i.digits == ""
+}
+
+// ISBN13 はハイフンなしの ISBN-13 を返します。
+func (i ISBN) ISBN13() string {
+	return i.digits
+}
+
+// ISBN10 はハイフンなしの ISBN-10 を返します。979 で始まる ISBN には ISBN-10 がないため false を返します。
+func (i ISBN) ISBN10() (string, bool) {
+	if !strings.HasPrefix(i.digits, "978") {
+		return "", false
+	}
+	body := i.digits[3:12]
+	sum := 0
+	for j := 0; j < 9; j++ {
+		sum += int(body[j]-'0') * (10 - j)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X", true
+	}
+	return body + string(byte('0'+check)), true
+}
+
+// Forms は保存形式がどちらでも引けるよう、ISBN-13 と（あれば）ISBN-10 を返します。
+func (i ISBN) Forms() []string {
+	forms := []string{i.ISBN13()}
+	if s, ok := i.ISBN10(); ok {
+		forms = append(forms, s)
+	}
+	return forms
+}
+
+func (i ISBN) String() string {
+	return i.digits
+}
+
+func validISBN10(s string) bool {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		d := int(s[i] - '0')
+		if s[i] == 'X' {
+			if i != 9 {
+				return false
+			}
+			d = 10
+		}
+		sum += d * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func isbn13CheckDigit(s12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(s12[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,101 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want13  string
+		want10  string
+		wantErr bool
+	}{
+		{in: "9784003101018", want13: "9784003101018", want10: "4003101014"},
+		{in: "978-4-00-310101-8", want13: "9784003101018", want10: "4003101014"},
+		{in: "4003101014", want13: "9784003101018", want10: "4003101014"},
+		{in: "4-00-310102-2", want13: "9784003101025", want10: "4003101022"},
+		{in: "urn:isbn:9784873115658", want13: "9784873115658", want10: "4873115655"},
+		{in: "ISBN 978-4-87311-565-8", want13: "9784873115658", want10: "4873115655"},
+		{in: "080442957x", want13: "9780804429573", want10: "080442957X"},
+		{in: "9791032305690", want13: "9791032305690"},
+		{in: "9784003101019", wantErr: true},
+		{in: "4003101015", wantErr: true},
+		{in: "12345678901", wantErr: true},
+		{in: "X003101014", wantErr: true},
+		{in: "9771234567003", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Parse(%q): ErrInvalid を期待しましたが %v", tt.in, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): 予期しないエラー: %v", tt.in, err)
+			continue
+		}
+		if got.ISBN13() != tt.want13 {
+			t.Errorf("Parse(%q).ISBN13() = %q, want %q", tt.in, got.ISBN13(), tt.want13)
+		}
+		s10, ok := got.ISBN10()
+		if s10 != tt.want10 || ok != (tt.want10 != "") {
+			t.Errorf("Parse(%q).ISBN10() = %q, %v, want %q", tt.in, s10, ok, tt.want10)
+		}
+		if forms := got.Forms(); forms[0] != tt.want13 || (tt.want10 != "" && forms[1] != tt.want10) {
+			t.Errorf("Parse(%q).Forms() = %v", tt.in, forms)
+		}
+	}
+}
+
+func TestHyphenated(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		want10 string
+	}{
+		{"9784003101018", "978-4-00-310101-8", "4-00-310101-4"},
+		{"9784873115658", "978-4-87311-565-8", "4-87311-565-5"},
+		{"9784274068560", "978-4-274-06856-0", "4-274-06856-0"},
+		{"9784774142043", "978-4-7741-4204-3", "4-7741-4204-2"},
+		{"9780306406157", "978-0-306-40615-7", "0-306-40615-2"},
+		// 英語圏（0）は日本（4）と異なり、3 桁の範囲の中に 4 桁・7 桁の区分がある
+		{"9780198534532", "978-0-19-853453-2", "0-19-853453-1"},
+		{"9780228265702", "978-0-2282-6570-2", "0-2282-6570-3"},
+		{"9780851310411", "978-0-85131-041-1", "0-85131-041-9"},
+		{"9780975229804", "978-0-9752298-0-4", "0-9752298-0-X"},
+		{"9781593279288", "978-1-59327-928-8", "1-59327-928-0"},
+		// 出版者記号の区分を持たない登録グループは登録グループまで区切る
+		{"9783161484100", "978-3-16148410-0", "3-16148410-X"},
+		{"9791032305690", "979-10-3230569-0", ""},
+	}
+
+	for _, tt := range tests {
+		i, err := Parse(tt.in)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.in, err)
+		}
+		if got := i.Hyphenated(); got != tt.want {
+			t.Errorf("Hyphenated(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		got10, _ := i.Hyphenated10()
+		if got10 != tt.want10 {
+			t.Errorf("Hyphenated10(%q) = %q, want %q", tt.in, got10, tt.want10)
+		}
+
+		// 区切った形式は元の ISBN として読み戻せる
+		if back, err := Parse(i.Hyphenated()); err != nil || back != i {
+			t.Errorf("Parse(%q) = %v, %v", i.Hyphenated(), back, err)
+		}
+		if tt.want10 != "" {
+			if back, err := Parse(got10); err != nil || back != i {
+				t.Errorf("Parse(%q) = %v, %v", got10, back, err)
+			}
+		}
+	}
+}
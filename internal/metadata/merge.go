@@ -0,0 +1,273 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+)
+
+// 項目名。book.Book.Provenance のキーとして保存されます。
+const (
+	FieldTitle         = "title"
+	FieldSubtitle      = "subtitle"
+	FieldAuthors       = "authors"
+	FieldPublisher     = "publisher"
+	FieldPublishedDate = "publishedDate"
+	FieldDescription   = "description"
+	FieldBookURL       = "bookUrl"
+	FieldImageURL      = "imageUrl"
+)
+
+var fields = []struct {
+	name string
+	get  func(*Record) string
+	set  func(*Record, string)
+}{
+	{FieldTitle, func(r *Record) string { return r.Title }, func(r *Record, v string) { r.Title = v }},
+	{FieldSubtitle, func(r *Record) string { return r.Subtitle }, func(r *Record, v string) { r.Subtitle = v }},
+	{FieldAuthors, func(r *Record) string { return book.JoinAuthors(r.Authors) }, func(r *Record, v string) { r.Authors = book.SplitAuthors(v) }},
+	{FieldPublisher, func(r *Record) string { return r.Publisher }, func(r *Record, v string) { r.Publisher = v }},
+	{FieldPublishedDate, func(r *Record) string { return r.PublishedDate }, func(r *Record, v string) { r.PublishedDate = v }},
+	{FieldDescription, func(r *Record) string { return r.Description }, func(r *Record, v string) { r.Description = v }},
+	{FieldBookURL, func(r *Record) string { return r.BookURL }, func(r *Record, v string) { r.BookURL = v }},
+	{FieldImageURL, func(r *Record) string { return r.ImageURL }, func(r *Record, v string) { r.ImageURL = v }},
+}
+
+// Candidate は項目の候補値とその提供元です。
+type Candidate struct {
+	Source string
+	Value  string
+}
+
+// Strategy は候補から採用するものの添字を返します。どれも採用しない場合は -1 です。
+// 候補は提供元の優先順に並び、空の値は含みません。
+type Strategy func(ctx context.Context, candidates []Candidate) int
+
+// First は最も優先順の高い候補を採用します。
+func First(ctx context.Context, candidates []Candidate) int {
+	if len(candidates) == 0 {
+		return -1
+	}
+	return 0
+}
+
+// Longest は最も長い候補を採用します。同じ長さなら優先順の高いほうです。
+func Longest(ctx context.Context, candidates []Candidate) int {
+	best := -1
+	for i, c := range candidates {
+		if best < 0 || utf8.RuneCountInString(c.Value) > utf8.RuneCountInString(candidates[best].Value) {
+			best = i
+		}
+	}
+	return best
+}
+
+// PreferJapanese はかな・漢字を含む候補を優先し、なければ先頭の候補（ローマ字表記など）を採用します。
+func PreferJapanese(ctx context.Context, candidates []Candidate) int {
+	for i, c := range candidates {
+		if containsJapanese(c.Value) {
+			return i
+		}
+	}
+	return First(ctx, candidates)
+}
+
+func containsJapanese(s string) bool {
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageExists は HEAD リクエストで画像を取得できる最初の候補を採用します。
+// どれも取得できない場合はリンク切れの画像を保存しないよう -1 を返します。
+func ImageExists(client *http.Client) Strategy {
+	return func(ctx context.Context, candidates []Candidate) int {
+		for i, c := range candidates {
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.Value, nil)
+			if err != nil {
+				continue
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+				return i
+			}
+		}
+		return -1
+	}
+}
+
+// DefaultRules は既定の項目ごとの規則です。含まれない項目は First を使います。
+func DefaultRules(client *http.Client) map[string]Strategy {
+	return map[string]Strategy{
+		FieldTitle:       PreferJapanese,
+		FieldSubtitle:    PreferJapanese,
+		FieldAuthors:     PreferJapanese,
+		FieldPublisher:   PreferJapanese,
+		FieldDescription: Longest,
+		FieldImageURL:    ImageExists(client),
+	}
+}
+
+// ParseRules は "description=longest,title=japanese" 形式の指定を規則に変換します。
+// 規則名は first / longest / japanese / image-exists です。
+func ParseRules(spec string, client *http.Client) (map[string]Strategy, error) {
+	strategies := map[string]Strategy{
+		"first":        First,
+		"longest":      Longest,
+		"japanese":     PreferJapanese,
+		"image-exists": ImageExists(client),
+	}
+
+	rules := make(map[string]Strategy)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		field, name, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("マージ規則の形式が不正です: %q (項目=規則 で指定してください)", item)
+		}
+		field, name = strings.TrimSpace(field), strings.TrimSpace(name)
+		if !isField(field) {
+			return nil, fmt.Errorf("未知の項目です: %q", field)
+		}
+		s, ok := strategies[name]
+		if !ok {
+			return nil, fmt.Errorf("未知のマージ規則です: %q", name)
+		}
+		rules[field] = s
+	}
+	return rules, nil
+}
+
+func isField(name string) bool {
+	for _, f := range fields {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Merger は複数の提供元の Record を項目ごとの規則で 1 件にまとめます。
+type Merger struct {
+	Rules map[string]Strategy
+}
+
+// Merge は records（提供元の優先順）を 1 件にまとめ、項目ごとの採用元を Provenance に記録します。
+// 読み・価格・NDC は優先順で最初に値のある Record のものを使います。
+func (m *Merger) Merge(ctx context.Context, isbn string, records []*Record) *Record {
+	merged := &Record{ISBN: isbn, Provenance: make(map[string]string)}
+
+	var sources []string
+	for _, r := range records {
+		sources = append(sources, r.Source)
+		if merged.TitleReading == "" {
+			merged.TitleReading = r.TitleReading
+		}
+		if merged.Price == 0 {
+			merged.Price = r.Price
+		}
+		if len(merged.NDC) == 0 {
+			merged.NDC = r.NDC
+		}
+	}
+	merged.Source = strings.Join(sources, "+")
+
+	for _, f := range fields {
+		var candidates []Candidate
+		for _, r := range records {
+			if v := f.get(r); v != "" {
+				candidates = append(candidates, Candidate{Source: r.Source, Value: v})
+			}
+		}
+
+		strategy, ok := m.Rules[f.name]
+		if !ok {
+			strategy = First
+		}
+		if i := strategy(ctx, candidates); i >= 0 && i < len(candidates) {
+			f.set(merged, candidates[i].Value)
+			merged.Provenance[f.name] = candidates[i].Source
+		}
+	}
+	if merged.Authors == nil {
+		merged.Authors = []string{}
+	}
+	return merged
+}
+
+// setProvenance は値のある項目の採用元をすべて r.Source として記録します。
+func (r *Record) setProvenance() {
+	r.Provenance = make(map[string]string)
+	for _, f := range fields {
+		if f.get(r) != "" {
+			r.Provenance[f.name] = r.Source
+		}
+	}
+}
+
+// Merge はすべての Provider に問い合わせ、見つかった Record を Merger でまとめます。
+type Merge struct {
+	Providers Chain
+	Merger    *Merger
+}
+
+func (m *Merge) Name() string {
+	return "merge(" + m.Providers.Name() + ")"
+}
+
+// Prefetch は Prefetcher であるすべての Provider にまとめて取得させます。Lookup はすべての Provider に問い合わせます。
+func (m *Merge) Prefetch(ctx context.Context, isbns []string) error {
+	var errs []error
+	for _, p := range m.Providers {
+		if err := Prefetch(ctx, p, isbns); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Merge) Lookup(ctx context.Context, isbn string) (*Record, error) {
+	var records []*Record
+	var errs []error
+	for _, p := range m.Providers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		rec, err := p.Lookup(ctx, isbn)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			}
+			continue
+		}
+		if rec.Source == "" {
+			rec.Source = p.Name()
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) == 0 {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("ISBN %s: %w", isbn, ErrNotFound)
+		}
+		return nil, errors.Join(errs...)
+	}
+	return m.Merger.Merge(ctx, isbn, records), nil
+}
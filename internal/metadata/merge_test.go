@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cover.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+	}))
+	defer images.Close()
+
+	google := &Record{
+		Source:      "googlebooks",
+		Title:       "Riidaburu Kodo",
+		Authors:     []string{"Dustin Boswell"},
+		Publisher:   "O'Reilly Japan",
+		Description: "短い説明",
+		ImageURL:    images.URL + "/missing.jpg",
+		BookURL:     "https://books.google.com/",
+	}
+	openbd := &Record{
+		Source:        "openbd",
+		Title:         "リーダブルコード",
+		TitleReading:  "リーダブルコード",
+		PublishedDate: "2012-06-23",
+		Description:   "コードは理解しやすくなければならない。本書はその方法を紹介します。",
+		ImageURL:      images.URL + "/cover.jpg",
+		Price:         2400,
+	}
+
+	m := &Merger{Rules: DefaultRules(images.Client())}
+	got := m.Merge(context.Background(), "9784873115658", []*Record{google, openbd})
+
+	checks := []struct {
+		field      string
+		got        string
+		want       string
+		wantSource string
+	}{
+		{FieldTitle, got.Title, "リーダブルコード", "openbd"},
+		{FieldAuthors, strings.Join(got.Authors, ","), "Dustin Boswell", "googlebooks"},
+		{FieldPublisher, got.Publisher, "O'Reilly Japan", "googlebooks"},
+		{FieldPublishedDate, got.PublishedDate, "2012-06-23", "openbd"},
+		{FieldDescription, got.Description, openbd.Description, "openbd"},
+		{FieldBookURL, got.BookURL, google.BookURL, "googlebooks"},
+		{FieldImageURL, got.ImageURL, openbd.ImageURL, "openbd"},
+		{FieldSubtitle, got.Subtitle, "", ""},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s 不一致: got %q, want %q", c.field, c.got, c.want)
+		}
+		if got.Provenance[c.field] != c.wantSource {
+			t.Errorf("%s の採用元不一致: got %q, want %q", c.field, got.Provenance[c.field], c.wantSource)
+		}
+	}
+	if got.Price != 2400 || got.TitleReading != "リーダブルコード" || got.Source != "googlebooks+openbd" {
+		t.Errorf("付加情報の統合が不正です: %+v", got)
+	}
+
+	b := got.Book()
+	if b.Provenance[FieldDescription] != "openbd" {
+		t.Errorf("Book に Provenance が引き継がれていません: %v", b.Provenance)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	candidates := []Candidate{
+		{Source: "a", Value: "Kokoro"},
+		{Source: "b", Value: "こころ（新装版）"},
+		{Source: "c", Value: "こころ"},
+	}
+
+	tests := []struct {
+		name     string
+		strategy Strategy
+		in       []Candidate
+		want     int
+	}{
+		{"First", First, candidates, 0},
+		{"First（候補なし）", First, nil, -1},
+		{"Longest", Longest, candidates, 1},
+		{"PreferJapanese", PreferJapanese, candidates, 1},
+		{"PreferJapanese（日本語なし）", PreferJapanese, candidates[:1], 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.strategy(context.Background(), tt.in); got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMergeLookup(t *testing.T) {
+	m := &Merge{
+		Providers: Chain{
+			&fakeProvider{name: "a"},
+			&fakeProvider{name: "b", records: map[string]*Record{"1": {ISBN: "1", Title: "B"}}},
+			&fakeProvider{name: "c", records: map[string]*Record{"1": {ISBN: "1", Title: "C", Subtitle: "副題"}}},
+		},
+		Merger: &Merger{},
+	}
+
+	rec, err := m.Lookup(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if rec.Title != "B" || rec.Subtitle != "副題" || rec.Provenance[FieldSubtitle] != "c" {
+		t.Errorf("マージ結果が不正です: %+v", rec)
+	}
+
+	if _, err := m.Lookup(context.Background(), "2"); err == nil {
+		t.Error("見つからない場合にエラーになりません")
+	}
+}
@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+)
+
+// ErrNotFound は提供元に ISBN の書誌情報がない場合のエラーです。
+var ErrNotFound = errors.New("書誌情報が見つかりません")
+
+// Record は提供元ごとの差を吸収した書誌情報です。Source は取得した提供元の名前です。
+// TitleReading・Price・NDC は提供元が返す場合のみ設定されます。
+type Record struct {
+	ISBN          string
+	Title         string
+	TitleReading  string // タイトルの読み（カタカナ）
+	Subtitle      string
+	Authors       []string
+	Publisher     string
+	PublishedDate string
+	Description   string
+	BookURL       string
+	ImageURL      string
+	Price         int      // 本体価格（円）。不明な場合は 0
+	NDC           []string // 提供元が付与した NDC 分類コード
+	Source        string
+	// Provenance は項目名ごとの採用元の提供元名です。Chain や Merge が設定します。
+	Provenance map[string]string
+}
+
+// Book は Record から保存用の書籍を作成します。
+func (r *Record) Book() *book.Book {
+	b := book.NewBook(
+		r.ISBN,
+		r.Title,
+		r.Subtitle,
+		r.Authors,
+		r.Publisher,
+		r.PublishedDate,
+		r.Description,
+		r.BookURL,
+		r.ImageURL,
+	)
+	b.Provenance = maps.Clone(r.Provenance)
+	return b
+}
+
+// Provider は ISBN から書誌情報を取得する提供元です。
+// 書誌情報がない場合は ErrNotFound をラップしたエラーを返します。
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, isbn string) (*Record, error)
+}
+
+// Prefetcher は複数の ISBN の書誌情報をまとめて取得できる Provider です。
+// Prefetch で取得した書誌情報は、続く Lookup でリクエストせずに返します。
+type Prefetcher interface {
+	Prefetch(ctx context.Context, isbns []string) error
+}
+
+// Prefetch は p が Prefetcher の場合に isbns の書誌情報をまとめて取得します。それ以外の場合は何もしません。
+// 失敗しても Lookup は 1 件ずつ問い合わせるため、エラーは記録するだけで構いません。
+func Prefetch(ctx context.Context, p Provider, isbns []string) error {
+	if pf, ok := p.(Prefetcher); ok {
+		return pf.Prefetch(ctx, isbns)
+	}
+	return nil
+}
+
+// Chain は Provider を順に問い合わせ、最初に見つかった書誌情報を返します。
+// 見つからない場合やエラーの場合は次の Provider にフォールバックします。
+type Chain []Provider
+
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, p := range c {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Prefetch は先頭の Provider が Prefetcher の場合にまとめて取得させます。
+// 2 番目以降はフォールバックで、問い合わせない ISBN の取得結果が残り続けるため取得させません。
+func (c Chain) Prefetch(ctx context.Context, isbns []string) error {
+	if len(c) == 0 {
+		return nil
+	}
+	if err := Prefetch(ctx, c[0], isbns); err != nil {
+		return fmt.Errorf("%s: %w", c[0].Name(), err)
+	}
+	return nil
+}
+
+func (c Chain) Lookup(ctx context.Context, isbn string) (*Record, error) {
+	var errs []error
+	for _, p := range c {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		rec, err := p.Lookup(ctx, isbn)
+		if err == nil {
+			if rec.Source == "" {
+				rec.Source = p.Name()
+			}
+			if rec.Provenance == nil {
+				rec.setProvenance()
+			}
+			return rec, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+	}
+
+	// どの提供元も見つからなかっただけなら ErrNotFound、通信エラーなどがあればそれを返す
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("ISBN %s: %w", isbn, ErrNotFound)
+	}
+	return nil, errors.Join(errs...)
+}
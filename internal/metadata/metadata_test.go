@@ -0,0 +1,189 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type fakeProvider struct {
+	name    string
+	records map[string]*Record
+	err     error
+	calls   int
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Lookup(ctx context.Context, isbn string) (*Record, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	rec, ok := p.records[isbn]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *rec
+	return &c, nil
+}
+
+func TestChainLookup(t *testing.T) {
+	neko := &Record{ISBN: "9784003101018", Title: "吾輩は猫である"}
+	kokoro := &Record{ISBN: "9784003101025", Title: "こころ", Source: "override"}
+	errUnavailable := errors.New("503")
+
+	tests := []struct {
+		name       string
+		chain      func() Chain
+		isbn       string
+		wantTitle  string
+		wantSource string
+		wantErr    error
+	}{
+		{
+			name: "先頭の提供元で見つかる",
+			chain: func() Chain {
+				return Chain{&fakeProvider{name: "a", records: map[string]*Record{neko.ISBN: neko}}}
+			},
+			isbn:       neko.ISBN,
+			wantTitle:  neko.Title,
+			wantSource: "a",
+		},
+		{
+			name: "見つからない場合は次の提供元にフォールバック",
+			chain: func() Chain {
+				return Chain{
+					&fakeProvider{name: "a"},
+					&fakeProvider{name: "b", records: map[string]*Record{neko.ISBN: neko}},
+				}
+			},
+			isbn:       neko.ISBN,
+			wantTitle:  neko.Title,
+			wantSource: "b",
+		},
+		{
+			name: "エラーの場合も次の提供元にフォールバック",
+			chain: func() Chain {
+				return Chain{
+					&fakeProvider{name: "a", err: errUnavailable},
+					&fakeProvider{name: "b", records: map[string]*Record{kokoro.ISBN: kokoro}},
+				}
+			},
+			isbn:       kokoro.ISBN,
+			wantTitle:  kokoro.Title,
+			wantSource: "override",
+		},
+		{
+			name: "どこにもない",
+			chain: func() Chain {
+				return Chain{&fakeProvider{name: "a"}, &fakeProvider{name: "b"}}
+			},
+			isbn:    neko.ISBN,
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "見つからずエラーもある",
+			chain: func() Chain {
+				return Chain{&fakeProvider{name: "a", err: errUnavailable}, &fakeProvider{name: "b"}}
+			},
+			isbn:    neko.ISBN,
+			wantErr: errUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := tt.chain().Lookup(context.Background(), tt.isbn)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("エラー不一致: got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if rec.Title != tt.wantTitle || rec.Source != tt.wantSource {
+				t.Errorf("got %q (%s), want %q (%s)", rec.Title, rec.Source, tt.wantTitle, tt.wantSource)
+			}
+			if rec.Provenance[FieldTitle] != tt.wantSource {
+				t.Errorf("採用元不一致: got %q, want %q", rec.Provenance[FieldTitle], tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestChainLookupStopsOnFirstHit(t *testing.T) {
+	a := &fakeProvider{name: "a", records: map[string]*Record{"1": {ISBN: "1"}}}
+	b := &fakeProvider{name: "b"}
+
+	if _, err := (Chain{a, b}).Lookup(context.Background(), "1"); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if b.calls != 0 {
+		t.Errorf("見つかった後の提供元に問い合わせています: %d 回", b.calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (Chain{a, b}).Lookup(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("キャンセル時のエラー不一致: %v", err)
+	}
+}
+
+// fakePrefetcher は Prefetch に渡された ISBN を記録します。
+type fakePrefetcher struct {
+	fakeProvider
+	prefetched []string
+}
+
+func (p *fakePrefetcher) Prefetch(ctx context.Context, isbns []string) error {
+	p.prefetched = append(p.prefetched, isbns...)
+	return p.err
+}
+
+func TestChainPrefetch(t *testing.T) {
+	ctx := context.Background()
+	isbns := []string{"1", "2"}
+
+	tests := []struct {
+		name     string
+		provider func(a, b, c Provider) Provider
+		// wantA・wantC は a・c に ISBN を渡すかどうかです
+		wantA, wantC bool
+		wantErr      string
+	}{
+		// Chain は先頭の提供元だけに取得させる（フォールバックの提供元は問い合わせないことが多い）
+		{"Chain の先頭", func(a, b, c Provider) Provider { return Chain{a, b, c} }, true, false, ""},
+		{"Chain の 2 番目以降", func(a, b, c Provider) Provider { return Chain{b, a, c} }, false, false, ""},
+		{"Chain の先頭のエラー", func(a, b, c Provider) Provider { return Chain{c, a} }, false, true, "c: 接続エラー"},
+		// Merge はすべての提供元に問い合わせるため、すべてに取得させる
+		{"Merge", func(a, b, c Provider) Provider { return &Merge{Providers: Chain{b, a, c}} }, true, true, "c: 接続エラー"},
+		// Prefetcher でない Provider には何もしない
+		{"Prefetcher でない", func(a, b, c Provider) Provider { return b }, false, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &fakePrefetcher{fakeProvider: fakeProvider{name: "a"}}
+			b := &fakeProvider{name: "b"}
+			c := &fakePrefetcher{fakeProvider: fakeProvider{name: "c", err: errors.New("接続エラー")}}
+
+			err := Prefetch(ctx, tt.provider(a, b, c), isbns)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("予期しないエラー: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("失敗した提供元のエラーを返していません: %v", err)
+			}
+			if got := slices.Equal(a.prefetched, isbns); got != tt.wantA {
+				t.Errorf("a への取得不一致: %v", a.prefetched)
+			}
+			if got := slices.Equal(c.prefetched, isbns); got != tt.wantC {
+				t.Errorf("c への取得不一致: %v", c.prefetched)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/googlebooks"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndlsearch"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/openbd"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+const (
+	// EnvName は問い合わせる提供元を優先順にカンマ区切りで指定する環境変数です。
+	EnvName = "METADATA_PROVIDERS"
+	// Default は EnvName が未設定の場合の提供元です。
+	Default = googlebooks.ProviderName
+
+	// ModeEnvName は提供元の組み合わせ方を指定する環境変数です。
+	// fallback（既定）は最初に見つかった提供元の情報を使い、merge はすべての提供元の情報を項目ごとにまとめます。
+	ModeEnvName = "METADATA_MODE"
+	// RulesEnvName は merge 時の項目ごとの規則を "description=longest,title=japanese" 形式で上書きする環境変数です。
+	RulesEnvName = "METADATA_MERGE_RULES"
+
+	ModeFallback = "fallback"
+	ModeMerge    = "merge"
+)
+
+// factories は提供元の名前ごとの生成関数です。提供元を追加する場合はここに登録します。
+// 各生成関数は必要な設定を環境変数から読み込みます。
+var factories = map[string]func() (metadata.Provider, error){
+	googlebooks.ProviderName: func() (metadata.Provider, error) {
+		key := os.Getenv("GOOGLE_BOOKS_KEY")
+		if key == "" {
+			return nil, errors.New("環境変数 GOOGLE_BOOKS_KEY が未設定です")
+		}
+		return googlebooks.NewClient(key), nil
+	},
+	openbd.ProviderName: func() (metadata.Provider, error) {
+		return openbd.NewClient(), nil
+	},
+	ndlsearch.ProviderName: func() (metadata.Provider, error) {
+		return ndlsearch.NewClient(), nil
+	},
+}
+
+// Names は登録済みの提供元の名前を返します。
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New は names の順に問い合わせる metadata.Chain を作成します。
+func New(names []string) (metadata.Chain, error) {
+	if len(names) == 0 {
+		return nil, errors.New("書誌情報の提供元が指定されていません")
+	}
+
+	chain := make(metadata.Chain, 0, len(names))
+	for i, name := range names {
+		newProvider, ok := factories[name]
+		if !ok {
+			return nil, fmt.Errorf("未知の書誌情報の提供元です: %q (指定可能な値: %v)", name, Names())
+		}
+		if slices.Contains(names[:i], name) {
+			return nil, fmt.Errorf("書誌情報の提供元が重複しています: %q", name)
+		}
+		p, err := newProvider()
+		if err != nil {
+			return nil, fmt.Errorf("%s の初期化エラー: %w", name, err)
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// FromEnv は環境変数 METADATA_PROVIDERS・METADATA_MODE・METADATA_MERGE_RULES の指定で提供元を作成します。
+func FromEnv() (metadata.Provider, error) {
+	chain, err := chainFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode := os.Getenv(ModeEnvName); mode {
+	case "", ModeFallback:
+		return chain, nil
+	case ModeMerge:
+		// 画像の HEAD リクエストも提供元への問い合わせと同じレート制限を通す
+		client := &http.Client{Timeout: 10 * time.Second, Transport: ratelimit.Shared().Transport(nil)}
+		rules := metadata.DefaultRules(client)
+		override, err := metadata.ParseRules(os.Getenv(RulesEnvName), client)
+		if err != nil {
+			return nil, fmt.Errorf("%s の設定エラー: %w", RulesEnvName, err)
+		}
+		maps.Copy(rules, override)
+		return &metadata.Merge{Providers: chain, Merger: &metadata.Merger{Rules: rules}}, nil
+	default:
+		return nil, fmt.Errorf("%s に無効な値が設定されています: %q (指定可能な値: %s, %s)", ModeEnvName, mode, ModeFallback, ModeMerge)
+	}
+}
+
+func chainFromEnv() (metadata.Chain, error) {
+	value := os.Getenv(EnvName)
+	if strings.TrimSpace(value) == "" {
+		value = Default
+	}
+
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return New(names)
+}
@@ -0,0 +1,54 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/googlebooks"
+)
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers string
+		mode      string
+		rules     string
+		key       string
+		want      string
+		wantErr   bool
+	}{
+		{name: "未設定なら既定の提供元", key: "key", want: googlebooks.ProviderName},
+		{name: "空白を除いて解釈", providers: " googlebooks , ", key: "key", want: googlebooks.ProviderName},
+		{name: "複数指定は優先順", providers: "openbd,googlebooks", key: "key", want: "openbd,googlebooks"},
+		{name: "未知の提供元", providers: "googlebooks,unknown", key: "key", wantErr: true},
+		{name: "重複", providers: "googlebooks,googlebooks", key: "key", wantErr: true},
+		{name: "必要な環境変数が未設定", providers: "googlebooks", wantErr: true},
+		{name: "マージ", providers: "openbd,googlebooks", mode: "merge", key: "key", want: "merge(openbd,googlebooks)"},
+		{name: "マージ規則の上書き", providers: "openbd", mode: "merge", rules: "title=first, description=longest", want: "merge(openbd)"},
+		{name: "マージ規則の項目が不正", providers: "openbd", mode: "merge", rules: "isbn=first", wantErr: true},
+		{name: "マージ規則名が不正", providers: "openbd", mode: "merge", rules: "title=newest", wantErr: true},
+		{name: "不正なモード", providers: "openbd", mode: "random", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvName, tt.providers)
+			t.Setenv(ModeEnvName, tt.mode)
+			t.Setenv(RulesEnvName, tt.rules)
+			t.Setenv("GOOGLE_BOOKS_KEY", tt.key)
+
+			p, err := FromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("エラーを期待しましたが %q が返りました", p.Name())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if p.Name() != tt.want {
+				t.Errorf("got %q, want %q", p.Name(), tt.want)
+			}
+		})
+	}
+}
@@ -3,28 +3,41 @@ package book
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/lib/pq"
+	isbnpkg "github.com/taiki-umetsu/ndc007-bookpicker/internal/isbn"
 )
 
+const authorsSeparator = ", "
+
 type Book struct {
-	ISBN          string
-	Title         string
-	Subtitle      string
-	Authors       []string
-	Publisher     string
-	PublishedDate string
-	Description   string
-	BookURL       string
-	ImageURL      string
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	ID            int64    `json:"id,omitzero"`
+	ISBN          string   `json:"isbn"`
+	Title         string   `json:"title"`
+	Subtitle      string   `json:"subtitle"`
+	Authors       []string `json:"authors"`
+	Publisher     string   `json:"publisher"`
+	PublishedDate string   `json:"publishedDate"`
+	Description   string   `json:"description"`
+	BookURL       string   `json:"bookUrl"`
+	ImageURL      string   `json:"imageUrl"`
+	// NDC はこの書籍を取得した NDC 分類コード（複数の分類で見つかった場合は複数）
+	NDC []string `json:"ndc"`
+	// Provenance は項目名（"title" など）ごとの取得元の提供元名です
+	Provenance map[string]string `json:"provenance,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt,omitzero"`
+	UpdatedAt  time.Time         `json:"updatedAt,omitzero"`
 }
 
+// NewBook は isbn を ISBN-13 に正規化して書籍を作成します。ISBN として解釈できない値はそのまま保持します。
 func NewBook(isbn, title, subtitle string, authors []string, publisher, publishedDate, description, bookURL, imageURL string) *Book {
+	if normalized, err := isbnpkg.Normalize(isbn); err == nil {
+		isbn = normalized
+	}
 	return &Book{
 		ISBN:          isbn,
 		Title:         title,
@@ -38,16 +51,55 @@ func NewBook(isbn, title, subtitle string, authors []string, publisher, publishe
 	}
 }
 
+// provenanceJSON は provenance 列に保存する JSON を返します。
+func (b *Book) provenanceJSON() (string, error) {
+	if len(b.Provenance) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(b.Provenance)
+	if err != nil {
+		return "", fmt.Errorf("provenance の JSON 変換エラー (ISBN: %s): %w", b.ISBN, err)
+	}
+	return string(data), nil
+}
+
+// JoinAuthors は著者一覧を authors 列の形式（カンマ区切り）に変換します。
+func JoinAuthors(authors []string) string {
+	return strings.Join(authors, authorsSeparator)
+}
+
+// SplitAuthors は authors 列の値を著者一覧に戻します。
+func SplitAuthors(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, authorsSeparator)
+}
+
 func (b *Book) Insert(ctx context.Context, db *sql.DB) error {
-	authors := strings.Join(b.Authors, ", ")
+	authors := JoinAuthors(b.Authors)
+	provenance, err := b.provenanceJSON()
+	if err != nil {
+		return err
+	}
 
 	query := `
 		INSERT INTO books
-			(isbn, title, subtitle, authors, publisher, published_date, description, book_url, image_url, created_at, updated_at)
+			(isbn, title, subtitle, authors, publisher, published_date, description, book_url, image_url, provenance, created_at, updated_at)
 		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		ON CONFLICT (isbn) DO UPDATE
-        	SET updated_at = EXCLUDED.updated_at
+			SET title          = EXCLUDED.title,
+				subtitle       = EXCLUDED.subtitle,
+				authors        = EXCLUDED.authors,
+				publisher      = EXCLUDED.publisher,
+				published_date = EXCLUDED.published_date,
+				description    = EXCLUDED.description,
+				book_url       = EXCLUDED.book_url,
+				image_url      = EXCLUDED.image_url,
+				provenance     = EXCLUDED.provenance,
+				missed_runs    = 0,
+				updated_at     = EXCLUDED.updated_at
 	`
 
 	now := time.Now()
@@ -56,7 +108,7 @@ func (b *Book) Insert(ctx context.Context, db *sql.DB) error {
 	}
 	b.UpdatedAt = now
 
-	_, err := db.ExecContext(ctx, query,
+	_, err = db.ExecContext(ctx, query,
 		b.ISBN,
 		b.Title,
 		b.Subtitle,
@@ -66,6 +118,7 @@ func (b *Book) Insert(ctx context.Context, db *sql.DB) error {
 		b.Description,
 		b.BookURL,
 		b.ImageURL,
+		provenance,
 		b.CreatedAt,
 		b.UpdatedAt,
 	)
@@ -89,6 +142,7 @@ func BulkInsert(ctx context.Context, tx *sql.Tx, books []*Book) (int, error) {
 		"description",
 		"book_url",
 		"image_url",
+		"provenance",
 		"created_at",
 		"updated_at"))
 	if err != nil {
@@ -104,7 +158,11 @@ func BulkInsert(ctx context.Context, tx *sql.Tx, books []*Book) (int, error) {
 		}
 		b.UpdatedAt = now
 
-		authors := strings.Join(b.Authors, ", ")
+		authors := JoinAuthors(b.Authors)
+		provenance, err := b.provenanceJSON()
+		if err != nil {
+			return 0, err
+		}
 
 		_, err = stmt.ExecContext(ctx,
 			b.ISBN,
@@ -116,6 +174,7 @@ func BulkInsert(ctx context.Context, tx *sql.Tx, books []*Book) (int, error) {
 			b.Description,
 			b.BookURL,
 			b.ImageURL,
+			provenance,
 			b.CreatedAt,
 			b.UpdatedAt,
 		)
@@ -136,3 +195,156 @@ func BulkInsert(ctx context.Context, tx *sql.Tx, books []*Book) (int, error) {
 
 	return int(count64), nil
 }
+
+// BulkUpsert は INSERT ... ON CONFLICT (isbn) DO UPDATE で複数件をまとめて登録します。
+// 既存の ISBN は created_at 以外の全列を更新し、missed_runs を 0 に戻します。
+// 同一チャンク内に同じ ISBN を含めないでください。
+func BulkUpsert(ctx context.Context, tx *sql.Tx, books []*Book) (int, error) {
+	if len(books) == 0 {
+		return 0, nil
+	}
+
+	const cols = 12
+	now := time.Now()
+
+	placeholders := make([]string, 0, len(books))
+	args := make([]any, 0, len(books)*cols)
+	for i, b := range books {
+		if b.CreatedAt.IsZero() {
+			b.CreatedAt = now
+		}
+		b.UpdatedAt = now
+
+		provenance, err := b.provenanceJSON()
+		if err != nil {
+			return 0, err
+		}
+
+		ph := make([]string, cols)
+		for j := range ph {
+			ph[j] = fmt.Sprintf("$%d", i*cols+j+1)
+		}
+		placeholders = append(placeholders, "("+strings.Join(ph, ", ")+")")
+
+		args = append(args,
+			b.ISBN,
+			b.Title,
+			b.Subtitle,
+			JoinAuthors(b.Authors),
+			b.Publisher,
+			b.PublishedDate,
+			b.Description,
+			b.BookURL,
+			b.ImageURL,
+			provenance,
+			b.CreatedAt,
+			b.UpdatedAt,
+		)
+	}
+
+	query := `
+		INSERT INTO books
+			(isbn, title, subtitle, authors, publisher, published_date, description, book_url, image_url, provenance, created_at, updated_at)
+		VALUES
+			` + strings.Join(placeholders, ",\n\t\t\t") + `
+		ON CONFLICT (isbn) DO UPDATE
+			SET title          = EXCLUDED.title,
+				subtitle       = EXCLUDED.subtitle,
+				authors        = EXCLUDED.authors,
+				publisher      = EXCLUDED.publisher,
+				published_date = EXCLUDED.published_date,
+				description    = EXCLUDED.description,
+				book_url       = EXCLUDED.book_url,
+				image_url      = EXCLUDED.image_url,
+				provenance     = EXCLUDED.provenance,
+				missed_runs    = 0,
+				updated_at     = EXCLUDED.updated_at
+	`
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("アップサートエラー: %w", err)
+	}
+
+	count64, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("アップサート件数取得エラー: %w", err)
+	}
+
+	return int(count64), nil
+}
+
+// MarkMissed は今回の実行で取得されなかった書籍の missed_runs を 1 増やします。
+// seenISBNs が空の場合は全件を増やします。
+func MarkMissed(ctx context.Context, tx *sql.Tx, seenISBNs []string) (int, error) {
+	// nil のスライスは NULL になり、条件が NULL になって 1 件も更新されないため空の配列を渡す
+	if seenISBNs == nil {
+		seenISBNs = []string{}
+	}
+	res, err := tx.ExecContext(ctx,
+		`UPDATE books SET missed_runs = missed_runs + 1 WHERE isbn <> ALL($1)`,
+		pq.Array(seenISBNs),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("missed_runs 更新エラー: %w", err)
+	}
+
+	count64, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("missed_runs 更新件数取得エラー: %w", err)
+	}
+
+	return int(count64), nil
+}
+
+// PruneMissed は missedRuns 回以上連続で取得されなかった書籍を削除します。
+func PruneMissed(ctx context.Context, tx *sql.Tx, missedRuns int) (int, error) {
+	if missedRuns <= 0 {
+		return 0, fmt.Errorf("missedRuns が正の整数ではありません: %d", missedRuns)
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM books WHERE missed_runs >= $1`, missedRuns)
+	if err != nil {
+		return 0, fmt.Errorf("書籍削除エラー: %w", err)
+	}
+
+	count64, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("削除件数取得エラー: %w", err)
+	}
+
+	return int(count64), nil
+}
+
+// SaveNDC は ISBN ごとの NDC 分類コードを books_ndc に登録します。
+// books に存在しない ISBN は無視し、登録済みの組み合わせはそのまま残します。
+func SaveNDC(ctx context.Context, tx *sql.Tx, ndcByISBN map[string][]string) (int, error) {
+	var isbns, codes []string
+	for isbn, ndcs := range ndcByISBN {
+		for _, ndc := range ndcs {
+			isbns = append(isbns, isbn)
+			codes = append(codes, ndc)
+		}
+	}
+	if len(isbns) == 0 {
+		return 0, nil
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO books_ndc (book_id, ndc)
+		SELECT b.id, v.ndc
+		FROM unnest($1::text[], $2::text[]) AS v (isbn, ndc)
+		JOIN books b ON b.isbn = v.isbn
+		ON CONFLICT DO NOTHING
+	`, pq.Array(isbns), pq.Array(codes))
+	if err != nil {
+		return 0, fmt.Errorf("NDC登録エラー: %w", err)
+	}
+
+	count64, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("NDC登録件数取得エラー: %w", err)
+	}
+
+	return int(count64), nil
+}
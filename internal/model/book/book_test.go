@@ -1,41 +1,252 @@
-package book
+package book_test
 
 import (
 	"context"
-	"log"
-	"os"
-	"strconv"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
 	"testing"
+	"time"
 
-	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
-	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database/dbtest"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndc"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
 )
 
-func BenchmarkInsertBook(b *testing.B) {
-	env.Load()
+// beginTx はテスト用のトランザクションを開始し、テストの終了時にロールバックします。
+// MarkMissed・PruneMissed はテーブル全体を更新するため、他のデータを残すようコミットしません。
+func beginTx(t *testing.T, db *sql.DB) *sql.Tx {
+	t.Helper()
 
-	ctx := context.Background()
-	db, err := database.Setup(os.Getenv("DATABASE_URL"))
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("トランザクション開始エラー: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// storedBook は books テーブルの 1 行です。
+type storedBook struct {
+	book.Book
+	MissedRuns int
+}
+
+// loadBook は isbn の行を読み込みます。ok が false の場合は存在しません。
+func loadBook(t *testing.T, tx *sql.Tx, isbn string) (b storedBook, ok bool) {
+	t.Helper()
+
+	var authors, provenance string
+	err := tx.QueryRow(`
+		SELECT id, isbn, title, subtitle, authors, publisher, published_date, description, book_url, image_url,
+			provenance, missed_runs, created_at, updated_at
+		FROM books WHERE isbn = $1
+	`, isbn).Scan(
+		&b.ID, &b.ISBN, &b.Title, &b.Subtitle, &authors, &b.Publisher, &b.PublishedDate, &b.Description, &b.BookURL, &b.ImageURL,
+		&provenance, &b.MissedRuns, &b.CreatedAt, &b.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return b, false
+	}
 	if err != nil {
-		b.Fatalf("DB接続失敗: %v", err)
+		t.Fatalf("書籍の読み込みエラー: %v", err)
+	}
+	b.Authors = book.SplitAuthors(authors)
+	if err := json.Unmarshal([]byte(provenance), &b.Provenance); err != nil {
+		t.Fatalf("provenance の JSON パースエラー: %v", err)
+	}
+	return b, true
+}
+
+func upsert(t *testing.T, tx *sql.Tx, books ...*book.Book) {
+	t.Helper()
+
+	if _, err := book.BulkUpsert(context.Background(), tx, books); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func markMissed(t *testing.T, tx *sql.Tx, seen ...string) {
+	t.Helper()
+
+	if _, err := book.MarkMissed(context.Background(), tx, seen); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBulkUpsert(t *testing.T) {
+	tx := beginTx(t, dbtest.Open(t))
+	isbn := testISBN(1)
+
+	old := book.NewBook(isbn, "旧タイトル", "旧サブタイトル", []string{"旧著者"}, "旧出版社", "2000-01-01", "旧説明", "http://example.com/old", "http://example.com/old.jpg")
+	old.Provenance = map[string]string{"title": "openbd"}
+	upsert(t, tx, old)
+	inserted, ok := loadBook(t, tx, isbn)
+	if !ok {
+		t.Fatal("登録した書籍がありません")
+	}
+
+	// 2 回続けて取得されなかった後に、内容が変わって再び取得される
+	markMissed(t, tx, testISBN(2))
+	markMissed(t, tx, testISBN(2))
+	if missed, _ := loadBook(t, tx, isbn); missed.MissedRuns != 2 {
+		t.Fatalf("missed_runs 不一致: got %d, want 2", missed.MissedRuns)
+	}
+
+	updated := book.NewBook(isbn, "新タイトル", "新サブタイトル", []string{"著者A", "著者B"}, "新出版社", "2020-12-31", "新説明", "http://example.com/new", "http://example.com/new.jpg")
+	updated.Provenance = map[string]string{"title": "googlebooks", "imageUrl": "openbd"}
+	updated.CreatedAt = time.Now().Add(time.Hour)
+	upsert(t, tx, updated)
+
+	got, _ := loadBook(t, tx, isbn)
+	checks := []struct {
+		field string
+		got   any
+		want  any
+	}{
+		{"ID", got.ID, inserted.ID},
+		{"Title", got.Title, updated.Title},
+		{"Subtitle", got.Subtitle, updated.Subtitle},
+		{"Authors", got.Authors, updated.Authors},
+		{"Publisher", got.Publisher, updated.Publisher},
+		{"PublishedDate", got.PublishedDate, updated.PublishedDate},
+		{"Description", got.Description, updated.Description},
+		{"BookURL", got.BookURL, updated.BookURL},
+		{"ImageURL", got.ImageURL, updated.ImageURL},
+		{"Provenance", got.Provenance, updated.Provenance},
+		{"MissedRuns", got.MissedRuns, 0},
+		// created_at は最初に登録した日時のまま残す
+		{"CreatedAt", got.CreatedAt, inserted.CreatedAt},
+	}
+	for _, c := range checks {
+		var equal bool
+		switch want := c.want.(type) {
+		case []string:
+			equal = slices.Equal(c.got.([]string), want)
+		case map[string]string:
+			equal = maps.Equal(c.got.(map[string]string), want)
+		case time.Time:
+			equal = c.got.(time.Time).Equal(want)
+		default:
+			equal = c.got == c.want
+		}
+		if !equal {
+			t.Errorf("%s 不一致: got %v, want %v", c.field, c.got, c.want)
+		}
+	}
+	if !got.UpdatedAt.After(inserted.UpdatedAt) {
+		t.Errorf("updated_at が更新されていません: got %v, 登録時 %v", got.UpdatedAt, inserted.UpdatedAt)
+	}
+}
+
+func TestMarkMissedNothingSeen(t *testing.T) {
+	tx := beginTx(t, dbtest.Open(t))
+
+	isbns := []string{testISBN(1), testISBN(2)}
+	for _, isbn := range isbns {
+		upsert(t, tx, book.NewBook(isbn, "タイトル", "", []string{"著者"}, "出版社", "2020", "説明", "", ""))
+	}
+
+	// 1 件も登録できなかった実行（res.Stored が nil）でも全件を取得されなかったものとして数える
+	tests := []struct {
+		name string
+		seen []string
+	}{
+		{"nil", nil},
+		{"空", []string{}},
+	}
+	for i, tt := range tests {
+		cnt, err := book.MarkMissed(context.Background(), tx, tt.seen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cnt < len(isbns) {
+			t.Errorf("%s: 更新件数不一致: got %d, want %d 件以上", tt.name, cnt, len(isbns))
+		}
+		for _, isbn := range isbns {
+			if b, _ := loadBook(t, tx, isbn); b.MissedRuns != i+1 {
+				t.Errorf("%s: missed_runs 不一致 (isbn: %s): got %d, want %d", tt.name, isbn, b.MissedRuns, i+1)
+			}
+		}
+	}
+}
+
+func TestPruneMissed(t *testing.T) {
+	tx := beginTx(t, dbtest.Open(t))
+	ctx := context.Background()
+
+	// i 番目の書籍は直近 i 回連続で取得されなかった状態にする
+	isbns := make([]string, 4)
+	for i := range isbns {
+		isbns[i] = testISBN(i)
+		upsert(t, tx, book.NewBook(isbns[i], "タイトル", "", []string{"著者"}, "出版社", "2020", "説明", "", ""))
+	}
+	for run := 1; run < len(isbns); run++ {
+		markMissed(t, tx, isbns[:run]...)
+	}
+	for i, isbn := range isbns {
+		if b, _ := loadBook(t, tx, isbn); b.MissedRuns != i {
+			t.Fatalf("missed_runs 不一致 (isbn: %s): got %d, want %d", isbn, b.MissedRuns, i)
+		}
 	}
-	defer db.Close()
 
-	if err := database.CreateTable(db); err != nil {
-		b.Fatalf("テーブル作成エラー: %v", err)
+	if _, err := book.PruneMissed(ctx, tx, 0); err == nil {
+		t.Error("0 回でエラーになりません")
+	}
+	if _, err := book.PruneMissed(ctx, tx, 2); err != nil {
+		t.Fatal(err)
 	}
 
+	tests := []struct {
+		isbn     string
+		wantKept bool
+	}{
+		{isbns[0], true},
+		{isbns[1], true},
+		{isbns[2], false},
+		{isbns[3], false},
+	}
+	for _, tt := range tests {
+		if _, ok := loadBook(t, tx, tt.isbn); ok != tt.wantKept {
+			t.Errorf("削除の判定不一致 (isbn: %s): kept %v, want %v", tt.isbn, ok, tt.wantKept)
+		}
+	}
+}
+
+// テストとベンチマークの書籍は実在しない 999 始まりの ISBN で登録し、他のデータを消さないよう自分の書籍だけを削除する
+const testPrefix = "999"
+
+func testISBN(i int) string {
+	return fmt.Sprintf("%s%010d", testPrefix, i)
+}
+
+func deleteTestBooks(tb testing.TB, db *sql.DB) {
+	tb.Helper()
+
+	if _, err := db.Exec("DELETE FROM books WHERE isbn LIKE $1", testPrefix+"%"); err != nil {
+		tb.Fatalf("削除失敗: %v", err)
+	}
+}
+
+func BenchmarkInsertBook(b *testing.B) {
+	db := dbtest.Open(b)
+	ctx := context.Background()
+	b.Cleanup(func() { deleteTestBooks(b, db) })
+
 	const batchSize = 100
 
 	b.Run("単一レコードのループ挿入", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
 			b.StopTimer()
-			db.Exec("TRUNCATE TABLE books")
+			deleteTestBooks(b, db)
 			b.StartTimer()
 
 			for j := 0; j < batchSize; j++ {
-				book := NewBook(strconv.Itoa(j), "タイトル", "", []string{"著者"}, "出版社", "2020", "説明", "http://example.com", "")
-				if err := book.Insert(ctx, db); err != nil {
+				bk := book.NewBook(testISBN(j), "タイトル", "", []string{"著者"}, "出版社", "2020", "説明", "http://example.com", "")
+				if err := bk.Insert(ctx, db); err != nil {
 					b.Fatalf("単一挿入失敗: %v", err)
 				}
 			}
@@ -45,21 +256,20 @@ func BenchmarkInsertBook(b *testing.B) {
 	b.Run("バルクインサート", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
 			b.StopTimer()
-			db.Exec("TRUNCATE TABLE books")
+			deleteTestBooks(b, db)
 			b.StartTimer()
 
-			books := make([]*Book, batchSize)
+			books := make([]*book.Book, batchSize)
 			for j := 0; j < batchSize; j++ {
-				books[j] = NewBook(strconv.Itoa(j), "タイトル", "", []string{"著者"}, "出版社", "2020", "説明", "http://example.com", "")
+				books[j] = book.NewBook(testISBN(j), "タイトル", "", []string{"著者"}, "出版社", "2020", "説明", "http://example.com", "")
 			}
 
-			tx, txErr := db.BeginTx(ctx, nil)
-			if txErr != nil {
-				log.Fatalf("トランザクション開始エラー: %v", txErr)
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				b.Fatalf("トランザクション開始エラー: %v", err)
 			}
-			defer tx.Rollback()
-
-			if _, err := BulkInsert(ctx, tx, books); err != nil {
+			if _, err := book.BulkInsert(ctx, tx, books); err != nil {
+				tx.Rollback()
 				b.Fatalf("バルク挿入失敗: %v", err)
 			}
 			if err := tx.Commit(); err != nil {
@@ -68,3 +278,114 @@ func BenchmarkInsertBook(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkRandomBooks(b *testing.B) {
+	db := dbtest.Open(b)
+	ctx := context.Background()
+	deleteTestBooks(b, db)
+	b.Cleanup(func() { deleteTestBooks(b, db) })
+
+	// 数万件規模を想定し、NDC を 10 種類に振り分けたデータを用意する
+	const bookCount = 30000
+	books := make([]*book.Book, bookCount)
+	ndcByISBN := make(map[string][]string, bookCount)
+	for i := range books {
+		isbn := testISBN(i)
+		books[i] = book.NewBook(isbn, "タイトル", "", []string{"著者"}, "出版社", "2020", "説明", "http://example.com", "")
+		ndcByISBN[isbn] = []string{fmt.Sprintf("007.%d", i%10)}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		b.Fatalf("トランザクション開始エラー: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := book.BulkInsert(ctx, tx, books); err != nil {
+		b.Fatalf("バルク挿入失敗: %v", err)
+	}
+	if _, err := book.SaveNDC(ctx, tx, ndcByISBN); err != nil {
+		b.Fatalf("NDC保存失敗: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatalf("コミットエラー: %v", err)
+	}
+	if _, err := db.Exec("ANALYZE books"); err != nil {
+		b.Fatalf("ANALYZE失敗: %v", err)
+	}
+
+	repo := repository.NewPostgresBookRepository(db)
+	pattern, _ := ndc.ParsePattern("007.3")
+
+	checkUnique := func(b *testing.B, ids []int64, want int) {
+		seen := make(map[int64]bool)
+		for _, id := range ids {
+			if seen[id] {
+				b.Fatalf("重複した書籍: %d", id)
+			}
+			seen[id] = true
+		}
+		if len(ids) != want {
+			b.Fatalf("件数不一致: got %d, want %d", len(ids), want)
+		}
+	}
+	bookIDs := func(books []*book.Book) []int64 {
+		ids := make([]int64, len(books))
+		for i, bk := range books {
+			ids[i] = bk.ID
+		}
+		return ids
+	}
+	// randomBySort は比較用に、条件に一致する行を並べ替えて選びます（id 探索を導入する前の方式）。
+	randomBySort := func(b *testing.B, cond string, args ...any) []int64 {
+		rows, err := db.QueryContext(ctx, "SELECT id FROM books WHERE "+cond+" ORDER BY RANDOM() LIMIT "+fmt.Sprint(repository.MaxRandomCount), args...)
+		if err != nil {
+			b.Fatalf("ランダム取得失敗: %v", err)
+		}
+		defer rows.Close()
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				b.Fatalf("スキャン失敗: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			b.Fatalf("ランダム取得失敗: %v", err)
+		}
+		return ids
+	}
+
+	b.Run("ORDER BY RANDOM()", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			checkUnique(b, randomBySort(b, "TRUE"), repository.MaxRandomCount)
+		}
+	})
+
+	b.Run("id探索", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			got, err := repo.Random(ctx, repository.RandomParams{Count: repository.MaxRandomCount})
+			if err != nil {
+				b.Fatalf("ランダム取得失敗: %v", err)
+			}
+			checkUnique(b, bookIDs(got), repository.MaxRandomCount)
+		}
+	})
+
+	b.Run("ORDER BY RANDOM()（NDC絞り込み）", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ids := randomBySort(b, "EXISTS (SELECT 1 FROM books_ndc WHERE book_id = books.id AND ndc = $1)", pattern.Code)
+			checkUnique(b, ids, repository.MaxRandomCount)
+		}
+	})
+
+	b.Run("id探索（NDC絞り込み）", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			got, err := repo.Random(ctx, repository.RandomParams{Count: repository.MaxRandomCount, NDC: pattern})
+			if err != nil {
+				b.Fatalf("ランダム取得失敗: %v", err)
+			}
+			checkUnique(b, bookIDs(got), repository.MaxRandomCount)
+		}
+	})
+}
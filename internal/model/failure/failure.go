@@ -0,0 +1,207 @@
+package failure
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/redact"
+)
+
+// 再処理の設定。n 回失敗した ISBN は BaseDelay * 2^(n-1)（最大 MaxDelay）後に再処理します。
+const (
+	DefaultMaxAttempts = 5
+	BaseDelay          = time.Hour
+	MaxDelay           = 7 * 24 * time.Hour
+)
+
+// Failure は書誌情報を取得できなかった ISBN の記録です（failed_enrichments テーブル）。
+type Failure struct {
+	ISBN string
+	// NDC は CiNii で見つかった NDC 分類コードです
+	NDC []string
+	// ErrorClass は "not_found" などのエラーの種類で、LastError は最後のエラーメッセージです
+	ErrorClass  string
+	LastError   string
+	Attempts    int
+	NextRetryAt time.Time
+	// GaveUp は試行回数が上限に達し、再処理しないことを表します
+	GaveUp    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Attempt は 1 回分の失敗です。
+type Attempt struct {
+	ISBN  string
+	NDC   []string
+	Class string
+	Err   error
+}
+
+// Backoff は attempts 回失敗した後、次に再処理するまでの待ち時間を返します。
+func Backoff(attempts int) time.Duration {
+	d := BaseDelay
+	for i := 1; i < attempts && d < MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, MaxDelay)
+}
+
+// Record は失敗をまとめて記録し、試行回数が maxAttempts に達して諦めた件数を返します。
+// 既に記録がある ISBN は試行回数を増やし、NDC 分類コードを追加します。
+// バッチのトランザクションがロールバックしても残るよう、db に直接書き込みます。
+func Record(ctx context.Context, db *sql.DB, attempts []Attempt, maxAttempts int, now time.Time) (int, error) {
+	if len(attempts) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("トランザクション開始エラー: %w", err)
+	}
+	defer tx.Rollback()
+
+	isbns := make([]string, len(attempts))
+	for i, a := range attempts {
+		isbns[i] = a.ISBN
+	}
+	existing, err := query(ctx, tx, selectFailureColumns+` WHERE isbn = ANY($1) FOR UPDATE`, pq.Array(isbns))
+	if err != nil {
+		return 0, err
+	}
+	byISBN := make(map[string]*Failure, len(existing))
+	for _, f := range existing {
+		byISBN[f.ISBN] = f
+	}
+
+	gaveUp := 0
+	for _, a := range attempts {
+		f, ok := byISBN[a.ISBN]
+		if !ok {
+			f = &Failure{ISBN: a.ISBN, CreatedAt: now}
+			byISBN[a.ISBN] = f
+		}
+		for _, code := range a.NDC {
+			if !slices.Contains(f.NDC, code) {
+				f.NDC = append(f.NDC, code)
+			}
+		}
+		f.ErrorClass = a.Class
+		f.LastError = redact.URLs(a.Err.Error())
+		f.Attempts++
+		f.NextRetryAt = now.Add(Backoff(f.Attempts))
+		if !f.GaveUp && f.Attempts >= maxAttempts {
+			f.GaveUp = true
+			gaveUp++
+		}
+		f.UpdatedAt = now
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO failed_enrichments
+				(isbn, ndc, error_class, last_error, attempts, next_retry_at, gave_up, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (isbn) DO UPDATE
+				SET ndc           = EXCLUDED.ndc,
+					error_class   = EXCLUDED.error_class,
+					last_error    = EXCLUDED.last_error,
+					attempts      = EXCLUDED.attempts,
+					next_retry_at = EXCLUDED.next_retry_at,
+					gave_up       = EXCLUDED.gave_up,
+					updated_at    = EXCLUDED.updated_at
+		`, f.ISBN, pq.Array(f.NDC), f.ErrorClass, f.LastError, f.Attempts, f.NextRetryAt, f.GaveUp, f.CreatedAt, f.UpdatedAt)
+		if err != nil {
+			return 0, fmt.Errorf("失敗の記録エラー (isbn: %s): %w", f.ISBN, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("コミットエラー: %w", err)
+	}
+	return gaveUp, nil
+}
+
+// Due は再処理の時刻を過ぎ、諦めていない記録を再処理の時刻が古い順に最大 limit 件返します。
+func Due(ctx context.Context, db *sql.DB, now time.Time, limit int) ([]*Failure, error) {
+	return query(ctx, db, selectFailureColumns+`
+		WHERE NOT gave_up AND next_retry_at <= $1
+		ORDER BY next_retry_at
+		LIMIT $2
+	`, now, limit)
+}
+
+// Delete は書誌情報を取得できた ISBN の記録を削除します。書籍の登録と同じトランザクションで呼び出します。
+func Delete(ctx context.Context, tx *sql.Tx, isbns []string) (int, error) {
+	if len(isbns) == 0 {
+		return 0, nil
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM failed_enrichments WHERE isbn = ANY($1)`, pq.Array(isbns))
+	if err != nil {
+		return 0, fmt.Errorf("失敗の記録の削除エラー: %w", err)
+	}
+
+	count64, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("失敗の記録の削除件数取得エラー: %w", err)
+	}
+
+	return int(count64), nil
+}
+
+const selectFailureColumns = `
+	SELECT
+		isbn,
+		ndc,
+		error_class,
+		last_error,
+		attempts,
+		next_retry_at,
+		gave_up,
+		created_at,
+		updated_at
+	FROM failed_enrichments
+`
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func query(ctx context.Context, q querier, query string, args ...any) ([]*Failure, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("失敗の記録の取得エラー: %w", err)
+	}
+	defer rows.Close()
+
+	var failures []*Failure
+	for rows.Next() {
+		var f Failure
+		var ndc pq.StringArray
+		err := rows.Scan(
+			&f.ISBN,
+			&ndc,
+			&f.ErrorClass,
+			&f.LastError,
+			&f.Attempts,
+			&f.NextRetryAt,
+			&f.GaveUp,
+			&f.CreatedAt,
+			&f.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("失敗の記録の読み取りエラー: %w", err)
+		}
+		f.NDC = []string(ndc)
+		failures = append(failures, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("失敗の記録の読み取りエラー: %w", err)
+	}
+
+	return failures, nil
+}
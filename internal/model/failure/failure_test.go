@@ -0,0 +1,26 @@
+package failure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{4, 8 * time.Hour},
+		{8, 128 * time.Hour},
+		{9, MaxDelay},
+		{100, MaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
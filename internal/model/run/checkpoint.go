@@ -0,0 +1,203 @@
+package run
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/redact"
+)
+
+// Checkpoint は中断した実行を再開するための途中経過です。
+// 途中経過はバッチのトランザクションとは別に書き込むため、異常終了しても残ります。
+type Checkpoint struct {
+	// Targets は CiNii から取得済みの NDC 分類コードごとの ISBN です
+	Targets map[string][]string
+	// Records は書誌情報を問い合わせ済みの ISBN ごとの結果です
+	Records map[string]*CheckpointRecord
+}
+
+// CheckpointRecord は 1 件の ISBN の問い合わせ結果です。Record が nil の場合は取得できなかったことを表します。
+type CheckpointRecord struct {
+	ISBN       string
+	Record     json.RawMessage
+	ErrorClass string
+	Error      string
+	// Committed は書籍の登録をコミット済みであることを表します
+	Committed bool
+	// FailureRecorded は取得できなかったことを failed_enrichments に記録済みであることを表します
+	FailureRecorded bool
+}
+
+// SaveTarget は NDC 分類コードの取得結果を保存します。
+func (r *Run) SaveTarget(ctx context.Context, db *sql.DB, code string, isbns []string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO ingestion_run_targets (run_id, ndc, isbns)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (run_id, ndc) DO UPDATE SET isbns = EXCLUDED.isbns
+	`, r.ID, code, pq.Array(isbns))
+	if err != nil {
+		return fmt.Errorf("途中経過の保存エラー (ndc: %s): %w", code, err)
+	}
+	return nil
+}
+
+// SaveRecord は取得できた書誌情報を保存します。record は JSON に変換して保存します。
+func (r *Run) SaveRecord(ctx context.Context, db *sql.DB, isbn string, record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("書誌情報の JSON 変換エラー (isbn: %s): %w", isbn, err)
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO ingestion_run_records (run_id, isbn, record)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (run_id, isbn) DO UPDATE SET record = EXCLUDED.record, error_class = '', error = ''
+	`, r.ID, isbn, string(data))
+	if err != nil {
+		return fmt.Errorf("途中経過の保存エラー (isbn: %s): %w", isbn, err)
+	}
+	return nil
+}
+
+// SaveFailure は書誌情報を取得できなかったことを保存します。エラーは URL のクエリ文字列（API キーなど）を除いて保存します。
+func (r *Run) SaveFailure(ctx context.Context, db *sql.DB, isbn, class string, cause error) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO ingestion_run_records (run_id, isbn, error_class, error)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (run_id, isbn) DO UPDATE SET record = NULL, error_class = EXCLUDED.error_class, error = EXCLUDED.error
+	`, r.ID, isbn, class, redact.URLs(cause.Error()))
+	if err != nil {
+		return fmt.Errorf("途中経過の保存エラー (isbn: %s): %w", isbn, err)
+	}
+	return nil
+}
+
+// MarkCommitted は書籍の登録をコミットしたことを記録します。書籍の登録と同じトランザクションで呼び出します。
+func (r *Run) MarkCommitted(ctx context.Context, tx *sql.Tx, isbns []string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE ingestion_run_records SET committed = TRUE WHERE run_id = $1 AND isbn = ANY($2)
+	`, r.ID, pq.Array(isbns))
+	if err != nil {
+		return fmt.Errorf("途中経過の更新エラー: %w", err)
+	}
+	return nil
+}
+
+// MarkFailuresRecorded は取得できなかった ISBN を failed_enrichments に記録したことを記録します。
+func (r *Run) MarkFailuresRecorded(ctx context.Context, db *sql.DB, isbns []string) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE ingestion_run_records SET failure_recorded = TRUE WHERE run_id = $1 AND isbn = ANY($2)
+	`, r.ID, pq.Array(isbns))
+	if err != nil {
+		return fmt.Errorf("途中経過の更新エラー: %w", err)
+	}
+	return nil
+}
+
+// LoadCheckpoint は保存済みの途中経過を読み込みます。
+func (r *Run) LoadCheckpoint(ctx context.Context, db *sql.DB) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		Targets: make(map[string][]string),
+		Records: make(map[string]*CheckpointRecord),
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT ndc, isbns FROM ingestion_run_targets WHERE run_id = $1`, r.ID)
+	if err != nil {
+		return nil, fmt.Errorf("途中経過の取得エラー: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code string
+		var isbns pq.StringArray
+		if err := rows.Scan(&code, &isbns); err != nil {
+			return nil, fmt.Errorf("途中経過の読み取りエラー: %w", err)
+		}
+		cp.Targets[code] = []string(isbns)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("途中経過の読み取りエラー: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT isbn, record, error_class, error, committed, failure_recorded
+		FROM ingestion_run_records
+		WHERE run_id = $1
+		ORDER BY created_at, isbn
+	`, r.ID)
+	if err != nil {
+		return nil, fmt.Errorf("途中経過の取得エラー: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rec CheckpointRecord
+		var data []byte
+		if err := rows.Scan(&rec.ISBN, &data, &rec.ErrorClass, &rec.Error, &rec.Committed, &rec.FailureRecorded); err != nil {
+			return nil, fmt.Errorf("途中経過の読み取りエラー: %w", err)
+		}
+		if data != nil {
+			rec.Record = json.RawMessage(data)
+		}
+		cp.Records[rec.ISBN] = &rec
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("途中経過の読み取りエラー: %w", err)
+	}
+
+	return cp, nil
+}
+
+// ClearCheckpoint は途中経過を削除します。実行をコミットするトランザクションで呼び出します。
+// この実行より前の実行の途中経過も、コミットした結果より古く再開できないため削除します。
+func (r *Run) ClearCheckpoint(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ingestion_run_records WHERE run_id <= $1`, r.ID); err != nil {
+		return fmt.Errorf("途中経過の削除エラー: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ingestion_run_targets WHERE run_id <= $1`, r.ID); err != nil {
+		return fmt.Errorf("途中経過の削除エラー: %w", err)
+	}
+	return nil
+}
+
+// Superseded は r より後に開始した CiNii からの取り込みがコミット済みかを返します。
+// その場合に r を再開すると、新しい取り込みの結果を古い途中経過で上書きしてしまいます。
+func (r *Run) Superseded(ctx context.Context, db *sql.DB) (bool, error) {
+	var superseded bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM ingestion_runs WHERE id > $1 AND status = $2 AND config ? 'targets'
+		)
+	`, r.ID, StatusCommitted).Scan(&superseded)
+	if err != nil {
+		return false, fmt.Errorf("実行記録の取得エラー: %w", err)
+	}
+	return superseded, nil
+}
+
+// Resume はコミットされていない実行を再び実行中にします。
+// 読み込んだ後にコミットされた場合も再開しないよう、状態の確認と更新を 1 つの文で行います。
+func (r *Run) Resume(ctx context.Context, db *sql.DB) error {
+	if r.Status == StatusCommitted {
+		return fmt.Errorf("実行 %d はコミット済みのため再開できません", r.ID)
+	}
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE ingestion_runs SET status = $2, finished_at = NULL, error = ''
+		WHERE id = $1 AND status <> $3
+	`, r.ID, StatusRunning, StatusCommitted)
+	if err != nil {
+		return fmt.Errorf("実行記録の更新エラー (id: %d): %w", r.ID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("実行記録の更新エラー (id: %d): %w", r.ID, err)
+	} else if n == 0 {
+		return fmt.Errorf("実行 %d はコミット済みのため再開できません", r.ID)
+	}
+
+	r.Status = StatusRunning
+	r.FinishedAt = nil
+	r.Error = ""
+	return nil
+}
@@ -0,0 +1,111 @@
+package run
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database/dbtest"
+)
+
+// startRun は CiNii からの取り込みと同じく targets を持つ実行を作成し、テストの終了時に削除します。
+func startRun(t *testing.T, db *sql.DB) *Run {
+	t.Helper()
+
+	r, err := Start(context.Background(), db, map[string]any{"targets": []map[string]string{{"code": "007"}}})
+	if err != nil {
+		t.Fatalf("実行記録の作成エラー: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM ingestion_runs WHERE id = $1`, r.ID) })
+	return r
+}
+
+func commit(t *testing.T, db *sql.DB, r *Run) {
+	t.Helper()
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("トランザクション開始エラー: %v", err)
+	}
+	defer tx.Rollback()
+	if err := r.ClearCheckpoint(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("コミットエラー: %v", err)
+	}
+	if err := r.Finish(ctx, db, StatusCommitted, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+
+	interrupted := startRun(t, db)
+	if err := interrupted.SaveTarget(ctx, db, "007", []string{"9784873115658"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := interrupted.SaveFailure(ctx, db, "9784873115658", "timeout", context.DeadlineExceeded); err != nil {
+		t.Fatal(err)
+	}
+	if err := interrupted.Finish(ctx, db, StatusInterrupted, context.Canceled); err != nil {
+		t.Fatal(err)
+	}
+
+	superseded, err := interrupted.Superseded(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if superseded {
+		t.Fatal("後の実行がないのに再開できません")
+	}
+
+	// 後の実行がコミットされると、前の実行の途中経過は削除され、再開できなくなる
+	later := startRun(t, db)
+	commit(t, db, later)
+
+	cp, err := interrupted.LoadCheckpoint(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Targets) != 0 || len(cp.Records) != 0 {
+		t.Errorf("前の実行の途中経過が残っています: %+v", cp)
+	}
+	if superseded, err = interrupted.Superseded(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if !superseded {
+		t.Error("後の実行がコミット済みなのに再開できます")
+	}
+
+	// コミット済みの実行は、読み込んだ後にコミットされた場合も再開しない
+	stale := *later
+	stale.Status = StatusInterrupted
+	if err := stale.Resume(ctx, db); err == nil {
+		t.Error("コミット済みの実行を再開しました")
+	}
+}
+
+func TestSaveFailureRedactsURLs(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+
+	r := startRun(t, db)
+	cause := errors.New(`Get "https://www.googleapis.com/books/v1/volumes?q=isbn:9784873115658&key=secret": timeout`)
+	if err := r.SaveFailure(ctx, db, "9784873115658", "timeout", cause); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err := r.LoadCheckpoint(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Get "https://www.googleapis.com/books/v1/volumes": timeout`
+	if got := cp.Records["9784873115658"].Error; got != want {
+		t.Errorf("保存したエラー不一致: got %q, want %q", got, want)
+	}
+}
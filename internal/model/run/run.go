@@ -0,0 +1,108 @@
+package run
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/redact"
+)
+
+// Status はバッチの実行結果です。
+type Status string
+
+const (
+	StatusRunning    Status = "running"
+	StatusCommitted  Status = "committed"
+	StatusRolledBack Status = "rolled_back"
+	// StatusInterrupted はシグナルなどで中断した実行です。途中経過から再開できます
+	StatusInterrupted Status = "interrupted"
+	// StatusPartial は差分登録で一部のチャンクをコミットした後、成功の条件を満たさずに終了した実行です。
+	// コミット済みの書籍は残り、NDC 分類や取得されなかった書籍の記録などの仕上げは行っていません
+	StatusPartial Status = "partial"
+)
+
+// Run はバッチ 1 回分の実行記録です（ingestion_runs テーブル）。
+// 記録はバッチのトランザクションとは別に書き込むため、ロールバックした実行も残ります。
+type Run struct {
+	ID     int64
+	Status Status
+	// Config は実行時の設定（JSON）です
+	Config json.RawMessage
+	// Discovered は NDC 分類コードごとに CiNii で見つかった ISBN の件数です
+	Discovered map[string]int
+	// Enriched・Failed は書誌情報の取得に成功・失敗した ISBN の件数です
+	Enriched int
+	Failed   int
+	Inserted int
+	// Error はロールバックした理由です
+	Error      string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// Start は実行中の記録を作成します。config は JSON に変換して保存します。
+func Start(ctx context.Context, db *sql.DB, config any) (*Run, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("設定の JSON 変換エラー: %w", err)
+	}
+
+	r := &Run{
+		Status:     StatusRunning,
+		Config:     data,
+		Discovered: map[string]int{},
+		StartedAt:  time.Now(),
+	}
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO ingestion_runs (status, config, started_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, r.Status, string(r.Config), r.StartedAt).Scan(&r.ID)
+	if err != nil {
+		return nil, fmt.Errorf("実行記録の作成エラー: %w", err)
+	}
+	return r, nil
+}
+
+// Finish は集計と結果を記録して実行を終了します。cause はロールバックした理由で、nil でも構いません。
+func (r *Run) Finish(ctx context.Context, db *sql.DB, status Status, cause error) error {
+	discovered, err := json.Marshal(r.Discovered)
+	if err != nil {
+		return fmt.Errorf("取得件数の JSON 変換エラー: %w", err)
+	}
+
+	now := time.Now()
+	r.Status = status
+	r.FinishedAt = &now
+	if cause != nil {
+		// 外部 API のエラーは URL に API キーなどを含むことがあるため、クエリ文字列を除いて保存する
+		r.Error = redact.URLs(cause.Error())
+	}
+
+	_, err = db.ExecContext(ctx, `
+		UPDATE ingestion_runs
+		SET status      = $2,
+			discovered  = $3,
+			enriched    = $4,
+			failed      = $5,
+			inserted    = $6,
+			error       = $7,
+			finished_at = $8
+		WHERE id = $1
+	`, r.ID, r.Status, string(discovered), r.Enriched, r.Failed, r.Inserted, r.Error, now)
+	if err != nil {
+		return fmt.Errorf("実行記録の更新エラー (id: %d): %w", r.ID, err)
+	}
+	return nil
+}
+
+// Duration は実行にかかった時間です。実行中の場合は 0 を返します。
+func (r *Run) Duration() time.Duration {
+	if r.FinishedAt == nil {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
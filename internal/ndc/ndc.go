@@ -0,0 +1,73 @@
+package ndc
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var patternRe = regexp.MustCompile(`^\d{3}(\.\d+)?\*?$`)
+
+var ErrInvalidPattern = errors.New("NDC分類コードの形式が不正です")
+
+// Pattern は NDC 分類コードの指定です。CiNii の clas パラメータと同じく、
+// "007.64" は完全一致、"007.3*" のように末尾に * を付けると前方一致を表します。
+// ゼロ値は「指定なし」を表し、すべてのコードに一致します。
+type Pattern struct {
+	Code   string
+	Prefix bool
+}
+
+func ParsePattern(s string) (Pattern, error) {
+	if !patternRe.MatchString(s) {
+		return Pattern{}, fmt.Errorf("%w: %q", ErrInvalidPattern, s)
+	}
+	code, prefix := strings.CutSuffix(s, "*")
+	return Pattern{Code: code, Prefix: prefix}, nil
+}
+
+// IsZero は指定なしかどうかを返します。
+func (p Pattern) IsZero() bool {
+	return p.Code == ""
+}
+
+func (p Pattern) Match(code string) bool {
+	if p.IsZero() {
+		return true
+	}
+	if p.Prefix {
+		return strings.HasPrefix(code, p.Code)
+	}
+	return code == p.Code
+}
+
+// MatchAny は codes のいずれかが一致するかを返します。
+func (p Pattern) MatchAny(codes []string) bool {
+	if p.IsZero() {
+		return true
+	}
+	for _, c := range codes {
+		if p.Match(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Pattern) String() string {
+	if p.Prefix {
+		return p.Code + "*"
+	}
+	return p.Code
+}
+
+// Related は a と b が同じ分類か、一方が他方の下位分類かを返します。
+// NDC は桁が増えるほど細かい分類になるため、"007.6" と "007.64" は関連する分類とみなします。
+func Related(a, b string) bool {
+	a, b = strings.ReplaceAll(a, ".", ""), strings.ReplaceAll(b, ".", "")
+	if a == "" || b == "" {
+		return false
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
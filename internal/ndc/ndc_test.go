@@ -0,0 +1,84 @@
+package ndc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Pattern
+		wantErr bool
+	}{
+		{in: "007", want: Pattern{Code: "007"}},
+		{in: "007.64", want: Pattern{Code: "007.64"}},
+		{in: "007.3*", want: Pattern{Code: "007.3", Prefix: true}},
+		{in: "007*", want: Pattern{Code: "007", Prefix: true}},
+		{in: "", wantErr: true},
+		{in: "07", wantErr: true},
+		{in: "007.", wantErr: true},
+		{in: "007.6*4", wantErr: true},
+		{in: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePattern(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidPattern) {
+				t.Errorf("ParsePattern(%q): ErrInvalidPattern を期待しましたが %v", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePattern(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("String() = %q, want %q", got.String(), tt.in)
+		}
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	exact, _ := ParsePattern("007.6")
+	prefix, _ := ParsePattern("007.6*")
+
+	tests := []struct {
+		p    Pattern
+		code string
+		want bool
+	}{
+		{exact, "007.6", true},
+		{exact, "007.64", false},
+		{prefix, "007.6", true},
+		{prefix, "007.609", true},
+		{prefix, "007.3", false},
+		{Pattern{}, "913.6", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.Match(tt.code); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.p, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestRelated(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"007.64", "007.64", true},
+		{"007.6", "007.64", true},
+		{"007.64", "007", true},
+		{"007.3", "007.64", false},
+		{"913.6", "007", false},
+		{"", "007", false},
+	}
+
+	for _, tt := range tests {
+		if got := Related(tt.a, tt.b); got != tt.want {
+			t.Errorf("Related(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
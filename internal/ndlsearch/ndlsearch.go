@@ -0,0 +1,220 @@
+package ndlsearch
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/isbn"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+const (
+	// ProviderName は metadata.Provider としての名前です。
+	ProviderName = "ndlsearch"
+	// DefaultBaseURL は NDL サーチ OpenSearch API の URL です。テストでは httptest のサーバーに差し替えます。
+	DefaultBaseURL = "https://ndlsearch.ndl.go.jp/api/opensearch"
+)
+
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	// RetryDelay は失敗したリクエストを再送するまでの初回の待ち時間です（以降は倍々に延びる）
+	RetryDelay time.Duration
+}
+
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 10 * time.Second, Transport: ratelimit.Shared().Transport(nil)},
+		BaseURL:    DefaultBaseURL,
+		RetryDelay: 2 * time.Second,
+	}
+}
+
+type typedValue struct {
+	Type  string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Item は OpenSearch の RSS の item 1 件です。
+type Item struct {
+	Title        string       `xml:"http://purl.org/dc/elements/1.1/ title"`
+	TitleReading string       `xml:"http://ndl.go.jp/dcndl/terms/ titleTranscription"`
+	Creators     []string     `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Publishers   []string     `xml:"http://purl.org/dc/elements/1.1/ publisher"`
+	Issued       []typedValue `xml:"http://purl.org/dc/terms/ issued"`
+	Subjects     []typedValue `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Descriptions []string     `xml:"http://purl.org/dc/elements/1.1/ description"`
+	Link         string       `xml:"link"`
+}
+
+type rss struct {
+	Channel struct {
+		Items []Item `xml:"item"`
+	} `xml:"channel"`
+}
+
+// Search は ISBN で検索し、一致した item を返します。不正な ISBN はリクエストせずに isbn.ErrInvalid を返します。
+func (c *Client) Search(ctx context.Context, code string) ([]Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	normalized, err := isbn.Normalize(code)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s?isbn=%s", c.BaseURL, url.QueryEscape(normalized))
+
+	var body []byte
+	err = retry.Do(
+		func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+			if err != nil {
+				return retry.Unrecoverable(fmt.Errorf("リクエスト作成失敗: %w", err))
+			}
+			resp, err := c.HTTPClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("HTTPリクエスト失敗: %w", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return &ratelimit.StatusError{StatusCode: resp.StatusCode}
+			}
+			body, err = io.ReadAll(resp.Body)
+			if err != nil {
+				return fmt.Errorf("レスポンス読み込み失敗: %w", err)
+			}
+			return nil
+		},
+		retry.Attempts(3),
+		retry.DelayType(retry.BackOffDelay),
+		retry.Delay(c.RetryDelay),
+		retry.RetryIf(ratelimit.Retryable),
+		retry.Context(ctx),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("NDL サーチ API リクエストエラー: %w", err)
+	}
+
+	var r rss
+	if err := xml.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("XMLパース失敗: %w", err)
+	}
+	return r.Channel.Items, nil
+}
+
+func (c *Client) Name() string {
+	return ProviderName
+}
+
+// Lookup は ISBN で検索した最初の item を metadata.Record に変換します。
+func (c *Client) Lookup(ctx context.Context, code string) (*metadata.Record, error) {
+	normalized, err := isbn.Normalize(code)
+	if err != nil {
+		return nil, err
+	}
+	items, err := c.Search(ctx, normalized)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("ISBN %s: %w", normalized, metadata.ErrNotFound)
+	}
+	return items[0].Record(normalized), nil
+}
+
+// Record は item を metadata.Record に変換します。
+func (it *Item) Record(code string) *metadata.Record {
+	rec := &metadata.Record{
+		ISBN:          code,
+		Title:         it.Title,
+		TitleReading:  it.TitleReading,
+		PublishedDate: it.issued(),
+		BookURL:       it.Link,
+		NDC:           it.NDC(),
+		Source:        ProviderName,
+	}
+	if len(it.Publishers) > 0 {
+		rec.Publisher = it.Publishers[0]
+	}
+	if len(it.Descriptions) > 0 {
+		rec.Description = it.Descriptions[0]
+	}
+	for _, c := range it.Creators {
+		if name := cleanCreator(c); name != "" {
+			rec.Authors = append(rec.Authors, name)
+		}
+	}
+	return rec
+}
+
+// NDC は件名のうち NDC（NDC8/9/10 など版の違いを含む）の分類コードを返します。
+func (it *Item) NDC() []string {
+	var codes []string
+	for _, s := range it.Subjects {
+		_, typ, _ := strings.Cut(s.Type, ":")
+		if !ndcType.MatchString(typ) {
+			continue
+		}
+		if code := strings.TrimSpace(s.Value); code != "" && !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+var ndcType = regexp.MustCompile(`^NDC\d*$`)
+
+// issued は W3CDTF 形式の出版年月を優先し、"2012.6" のような表記は "2012-06" に揃えます。
+func (it *Item) issued() string {
+	if len(it.Issued) == 0 {
+		return ""
+	}
+	v := it.Issued[0].Value
+	for _, is := range it.Issued {
+		if strings.HasSuffix(is.Type, "W3CDTF") {
+			v = is.Value
+			break
+		}
+	}
+	return normalizeDate(v)
+}
+
+var dottedDate = regexp.MustCompile(`^(\d{4})\.(\d{1,2})$`)
+
+func normalizeDate(s string) string {
+	s = strings.TrimSpace(s)
+	if m := dottedDate.FindStringSubmatch(s); m != nil {
+		return fmt.Sprintf("%s-%02s", m[1], m[2])
+	}
+	return s
+}
+
+// 著者名の末尾の役割表示（"著" "訳" など）と生没年を取り除く
+var creatorSuffix = regexp.MustCompile(`[\s,，]*(\d{4}-(\d{4})?|著|訳|編|編著|監修|監訳|作|文|絵)$`)
+
+func cleanCreator(s string) string {
+	s = strings.TrimSpace(s)
+	for {
+		trimmed := creatorSuffix.ReplaceAllString(s, "")
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
@@ -0,0 +1,114 @@
+package ndlsearch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/isbn"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+)
+
+const emptyFeed = `<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel></channel></rss>`
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c := NewClient()
+	c.BaseURL = ts.URL + "/api/opensearch"
+	return c
+}
+
+func TestLookup(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/opensearch.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/opensearch" || r.URL.Query().Get("isbn") != "9784873115658" {
+			w.Write([]byte(emptyFeed))
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(fixture)
+	})
+
+	rec, err := c.Lookup(context.Background(), "9784873115658")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	checks := []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{"Title", rec.Title, "リーダブルコード : より良いコードを書くためのシンプルで実践的なテクニック"},
+		{"Authors", strings.Join(rec.Authors, "/"), "Boswell, Dustin/Foucher, Trevor/角, 征典"},
+		{"Publisher", rec.Publisher, "オライリー・ジャパン"},
+		{"PublishedDate", rec.PublishedDate, "2012"},
+		{"NDC", strings.Join(rec.NDC, ","), "007.64"},
+		{"BookURL", rec.BookURL, "https://ndlsearch.ndl.go.jp/books/R100000002-I023529546"},
+		{"Source", rec.Source, ProviderName},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s 不一致: got %q, want %q", c.field, c.got, c.want)
+		}
+	}
+
+	_, err = c.Lookup(context.Background(), "9784000000000")
+	if !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("ErrNotFound を期待しましたが %v", err)
+	}
+}
+
+func TestSearchCanceled(t *testing.T) {
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Search(ctx, "9784873115658"); !errors.Is(err, context.Canceled) {
+		t.Errorf("キャンセル時のエラー不一致: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("キャンセル後にリクエストしています: %d 回", calls)
+	}
+}
+
+func TestSearchRejectsInvalidISBN(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("不正な ISBN でリクエストしています")
+	})
+
+	// チェックディジットが一致しない ISBN-10
+	if _, err := c.Lookup(context.Background(), "4-87311-565-X"); !errors.Is(err, isbn.ErrInvalid) {
+		t.Errorf("isbn.ErrInvalid を期待しましたが %v", err)
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	tests := map[string]string{
+		"2012.6":  "2012-06",
+		"2012.11": "2012-11",
+		"2012-06": "2012-06",
+		"2012":    "2012",
+	}
+	for in, want := range tests {
+		if got := normalizeDate(in); got != want {
+			t.Errorf("normalizeDate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package openbd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/isbn"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ratelimit"
+)
+
+const (
+	// ProviderName は metadata.Provider としての名前です。
+	ProviderName = "openbd"
+	// DefaultBaseURL は openBD API の URL です。テストでは httptest のサーバーに差し替えます。
+	DefaultBaseURL = "https://api.openbd.jp/v1"
+	// MaxBatchSize は get エンドポイントの 1 回あたりの ISBN 数の上限です。
+	MaxBatchSize = 1000
+
+	bookURLFormat = "https://www.hanmoto.com/bd/isbn/%s"
+)
+
+// ONIX の TextType（03: 内容紹介, 02: 短い説明）
+const (
+	textTypeDescription      = "03"
+	textTypeShortDescription = "02"
+)
+
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	BatchSize  int
+	// RetryDelay は失敗したリクエストを再送するまでの初回の待ち時間です（以降は倍々に延びる）
+	RetryDelay time.Duration
+
+	// prefetched は Prefetch で取得した ISBN-13 ごとの書誌情報です。登録のない ISBN は nil です
+	mu         sync.Mutex
+	prefetched map[string]*metadata.Record
+}
+
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 10 * time.Second, Transport: ratelimit.Shared().Transport(nil)},
+		BaseURL:    DefaultBaseURL,
+		BatchSize:  100,
+		RetryDelay: 2 * time.Second,
+	}
+}
+
+type Summary struct {
+	ISBN      string `json:"isbn"`
+	Title     string `json:"title"`
+	Volume    string `json:"volume"`
+	Series    string `json:"series"`
+	Publisher string `json:"publisher"`
+	PubDate   string `json:"pubdate"`
+	Cover     string `json:"cover"`
+	Author    string `json:"author"`
+}
+
+type textWithKey struct {
+	Content      string `json:"content"`
+	CollationKey string `json:"collationkey"`
+}
+
+type ONIX struct {
+	DescriptiveDetail struct {
+		TitleDetail struct {
+			TitleElement struct {
+				TitleText textWithKey `json:"TitleText"`
+				Subtitle  textWithKey `json:"Subtitle"`
+			} `json:"TitleElement"`
+		} `json:"TitleDetail"`
+		Contributor []struct {
+			PersonName textWithKey `json:"PersonName"`
+		} `json:"Contributor"`
+	} `json:"DescriptiveDetail"`
+	CollateralDetail struct {
+		TextContent []struct {
+			TextType string `json:"TextType"`
+			Text     string `json:"Text"`
+		} `json:"TextContent"`
+	} `json:"CollateralDetail"`
+	ProductSupply struct {
+		SupplyDetail struct {
+			Price []struct {
+				PriceAmount  string `json:"PriceAmount"`
+				CurrencyCode string `json:"CurrencyCode"`
+			} `json:"Price"`
+		} `json:"SupplyDetail"`
+	} `json:"ProductSupply"`
+}
+
+// Item は get エンドポイントが返す 1 件分のデータです。
+type Item struct {
+	ONIX    ONIX    `json:"onix"`
+	Summary Summary `json:"summary"`
+}
+
+// Get は isbns の書誌情報をまとめて取得し、ISBN-13 をキーにした Record を返します。
+// openBD に登録のない ISBN は結果に含まれません。不正な ISBN を含む場合はリクエストせずに isbn.ErrInvalid を返します。
+func (c *Client) Get(ctx context.Context, codes []string) (map[string]*metadata.Record, error) {
+	isbns := make([]string, len(codes))
+	for i, code := range codes {
+		normalized, err := isbn.Normalize(code)
+		if err != nil {
+			return nil, err
+		}
+		isbns[i] = normalized
+	}
+
+	batchSize := c.BatchSize
+	if batchSize <= 0 || batchSize > MaxBatchSize {
+		batchSize = MaxBatchSize
+	}
+
+	records := make(map[string]*metadata.Record, len(isbns))
+	for start := 0; start < len(isbns); start += batchSize {
+		batch := isbns[start:min(start+batchSize, len(isbns))]
+		items, err := c.fetch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		// レスポンスはリクエストと同じ順で、登録のない ISBN は null になる
+		for i, item := range items {
+			if item != nil && i < len(batch) {
+				records[batch[i]] = item.Record(batch[i])
+			}
+		}
+	}
+	return records, nil
+}
+
+func (c *Client) fetch(ctx context.Context, isbns []string) ([]*Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s/get?isbn=%s", strings.TrimSuffix(c.BaseURL, "/"), url.QueryEscape(strings.Join(isbns, ",")))
+
+	var body []byte
+	err := retry.Do(
+		func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+			if err != nil {
+				return retry.Unrecoverable(fmt.Errorf("リクエスト作成失敗: %w", err))
+			}
+			resp, err := c.HTTPClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("HTTPリクエスト失敗: %w", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return &ratelimit.StatusError{StatusCode: resp.StatusCode}
+			}
+
+			body, err = io.ReadAll(resp.Body)
+			if err != nil {
+				return fmt.Errorf("レスポンス読み込み失敗: %w", err)
+			}
+			return nil
+		},
+		retry.Attempts(3),
+		retry.DelayType(retry.BackOffDelay),
+		retry.Delay(c.RetryDelay),
+		retry.RetryIf(ratelimit.Retryable),
+		retry.Context(ctx),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("openBD API リクエストエラー: %w", err)
+	}
+
+	var items []*Item
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("JSONパース失敗: %w", err)
+	}
+	return items, nil
+}
+
+func (c *Client) Name() string {
+	return ProviderName
+}
+
+// Prefetch は isbns の書誌情報を Get でまとめて取得し、続く Lookup で返せるよう保持します。
+// 保持した書誌情報は Lookup で 1 度返すと破棄するため、続けて Lookup する ISBN だけを渡してください。
+// 不正な ISBN は除いて取得します。
+func (c *Client) Prefetch(ctx context.Context, codes []string) error {
+	var isbns []string
+	for _, code := range codes {
+		if normalized, err := isbn.Normalize(code); err == nil {
+			isbns = append(isbns, normalized)
+		}
+	}
+	if len(isbns) == 0 {
+		return nil
+	}
+
+	records, err := c.Get(ctx, isbns)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.prefetched == nil {
+		c.prefetched = make(map[string]*metadata.Record, len(isbns))
+	}
+	for _, code := range isbns {
+		c.prefetched[code] = records[code]
+	}
+	return nil
+}
+
+// takePrefetched は Prefetch で取得した書誌情報を取り出します。ok が false の場合は取得していません。
+func (c *Client) takePrefetched(code string) (rec *metadata.Record, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rec, ok = c.prefetched[code]
+	delete(c.prefetched, code)
+	return rec, ok
+}
+
+// Lookup は 1 件分の Get です。Prefetch で取得済みの ISBN はリクエストせずに返します。
+func (c *Client) Lookup(ctx context.Context, code string) (*metadata.Record, error) {
+	normalized, err := isbn.Normalize(code)
+	if err != nil {
+		return nil, err
+	}
+	if rec, ok := c.takePrefetched(normalized); ok {
+		if rec == nil {
+			return nil, fmt.Errorf("ISBN %s: %w", normalized, metadata.ErrNotFound)
+		}
+		return rec, nil
+	}
+
+	records, err := c.Get(ctx, []string{normalized})
+	if err != nil {
+		return nil, err
+	}
+	rec, ok := records[normalized]
+	if !ok {
+		return nil, fmt.Errorf("ISBN %s: %w", normalized, metadata.ErrNotFound)
+	}
+	return rec, nil
+}
+
+// Record は summary と ONIX の項目を metadata.Record に変換します。
+// summary を基本とし、summary にない読み・サブタイトル・内容紹介・価格は ONIX から補います。
+func (it *Item) Record(code string) *metadata.Record {
+	detail := it.ONIX.DescriptiveDetail
+	title := detail.TitleDetail.TitleElement
+
+	rec := &metadata.Record{
+		ISBN:          code,
+		Title:         it.Summary.Title,
+		TitleReading:  title.TitleText.CollationKey,
+		Subtitle:      title.Subtitle.Content,
+		Publisher:     it.Summary.Publisher,
+		PublishedDate: normalizeDate(it.Summary.PubDate),
+		Description:   it.description(),
+		BookURL:       fmt.Sprintf(bookURLFormat, code),
+		ImageURL:      it.Summary.Cover,
+		Price:         it.price(),
+		Source:        ProviderName,
+	}
+	if rec.Title == "" {
+		rec.Title = title.TitleText.Content
+	}
+
+	for _, c := range detail.Contributor {
+		if name := strings.TrimSpace(c.PersonName.Content); name != "" {
+			rec.Authors = append(rec.Authors, name)
+		}
+	}
+	if len(rec.Authors) == 0 {
+		rec.Authors = splitSummaryAuthors(it.Summary.Author)
+	}
+
+	return rec
+}
+
+func (it *Item) description() string {
+	var short string
+	for _, tc := range it.ONIX.CollateralDetail.TextContent {
+		switch tc.TextType {
+		case textTypeDescription:
+			return tc.Text
+		case textTypeShortDescription:
+			short = tc.Text
+		}
+	}
+	return short
+}
+
+func (it *Item) price() int {
+	for _, p := range it.ONIX.ProductSupply.SupplyDetail.Price {
+		if p.CurrencyCode != "" && p.CurrencyCode != "JPY" {
+			continue
+		}
+		if n, err := strconv.Atoi(p.PriceAmount); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// summary.author は "夏目漱石／著 山田太郎／解説" のように役割付きで空白区切りになっている
+func splitSummaryAuthors(s string) []string {
+	var authors []string
+	for _, f := range strings.Fields(s) {
+		name, _, _ := strings.Cut(f, "／")
+		if name = strings.TrimRight(name, ",，、"); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	return authors
+}
+
+var compactDate = regexp.MustCompile(`^(\d{4})(\d{2})?(\d{2})?$`)
+
+// normalizeDate は "20200115" や "202001" を Google Books と同じ "2020-01-15" / "2020-01" 形式にします。
+func normalizeDate(s string) string {
+	m := compactDate.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	date := m[1]
+	for _, part := range m[2:] {
+		if part == "" {
+			break
+		}
+		date += "-" + part
+	}
+	return date
+}
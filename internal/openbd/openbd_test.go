@@ -0,0 +1,233 @@
+package openbd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/isbn"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/metadata"
+)
+
+const (
+	readableCode = "9784873115658"
+	unknown      = "9784000000000"
+	kokoro       = "9784003101025"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c := NewClient()
+	c.BaseURL = ts.URL
+	return c
+}
+
+func TestGet(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/get.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotQuery string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/get" {
+			http.NotFound(w, r)
+			return
+		}
+		gotQuery = r.URL.Query().Get("isbn")
+		w.Write(fixture)
+	})
+
+	records, err := c.Get(context.Background(), []string{readableCode, unknown, kokoro})
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	if want := readableCode + "," + unknown + "," + kokoro; gotQuery != want {
+		t.Errorf("isbn パラメータ不一致: got %q, want %q", gotQuery, want)
+	}
+	if len(records) != 2 {
+		t.Fatalf("件数不一致: got %d, want 2", len(records))
+	}
+	if _, ok := records[unknown]; ok {
+		t.Errorf("登録のない ISBN が結果に含まれています")
+	}
+
+	rc := records[readableCode]
+	checks := []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{"Title", rc.Title, "リーダブルコード"},
+		{"TitleReading", rc.TitleReading, "リーダブルコード"},
+		{"Subtitle", rc.Subtitle, "より良いコードを書くためのシンプルで実践的なテクニック"},
+		{"Authors", strings.Join(rc.Authors, ","), "Dustin Boswell,Trevor Foucher"},
+		{"Publisher", rc.Publisher, "オライリー・ジャパン"},
+		{"PublishedDate", rc.PublishedDate, "2012-06-23"},
+		{"Description", rc.Description, "コードは理解しやすくなければならない。本書はこの原則を日々のコーディングに適用する方法を紹介します。"},
+		{"BookURL", rc.BookURL, "https://www.hanmoto.com/bd/isbn/" + readableCode},
+		{"ImageURL", rc.ImageURL, "https://cover.openbd.jp/9784873115658.jpg"},
+		{"Source", rc.Source, ProviderName},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s 不一致: got %q, want %q", c.field, c.got, c.want)
+		}
+	}
+	if rc.Price != 2400 {
+		t.Errorf("Price 不一致: got %d, want 2400", rc.Price)
+	}
+
+	// ONIX に著者がない場合は summary.author から役割を除いて補う
+	k := records[kokoro]
+	if strings.Join(k.Authors, ",") != "夏目漱石" || k.PublishedDate != "2019-07" || k.Price != 0 {
+		t.Errorf("summary からの変換が不正です: %+v", k)
+	}
+
+	b := rc.Book()
+	if b.ISBN != readableCode || b.Title != rc.Title || b.ImageURL != rc.ImageURL {
+		t.Errorf("Book への変換が不正です: %+v", b)
+	}
+}
+
+func TestGetSplitsBatches(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		n := len(strings.Split(r.URL.Query().Get("isbn"), ","))
+		w.Write([]byte("[" + strings.TrimSuffix(strings.Repeat("null,", n), ",") + "]"))
+	})
+	c.BatchSize = 2
+
+	records, err := c.Get(context.Background(), []string{
+		"9784003101018", "9784003101025", "9784873115658", "9784274068560", "9784774142043",
+	})
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("件数不一致: got %d, want 0", len(records))
+	}
+	if calls.Load() != 3 {
+		t.Errorf("リクエスト回数不一致: got %d, want 3", calls.Load())
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[null]"))
+	})
+
+	_, err := c.Lookup(context.Background(), unknown)
+	if !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("ErrNotFound を期待しましたが %v", err)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/get.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if got := r.URL.Query().Get("isbn"); got != readableCode+","+unknown+","+kokoro {
+			w.Write([]byte("[null]"))
+			return
+		}
+		w.Write(fixture)
+	})
+
+	ctx := context.Background()
+	// 不正な ISBN は除いてまとめて取得する
+	if err := c.Prefetch(ctx, []string{readableCode, unknown, "9784873115659", kokoro}); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("リクエスト回数不一致: got %d, want 1", calls.Load())
+	}
+
+	rec, err := c.Lookup(ctx, readableCode)
+	if err != nil || rec.Title != "リーダブルコード" {
+		t.Errorf("取得済みの書誌情報を返していません: %+v, %v", rec, err)
+	}
+	if _, err := c.Lookup(ctx, unknown); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("ErrNotFound を期待しましたが %v", err)
+	}
+	if _, err := c.Lookup(ctx, kokoro); err != nil {
+		t.Errorf("予期しないエラー: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("取得済みの ISBN をリクエストしました: %d 回", calls.Load())
+	}
+
+	// 取得済みの書誌情報は 1 度返すと破棄し、次の Lookup はリクエストする
+	if _, err := c.Lookup(ctx, readableCode); !errors.Is(err, metadata.ErrNotFound) {
+		t.Errorf("ErrNotFound を期待しましたが %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("リクエスト回数不一致: got %d, want 2", calls.Load())
+	}
+}
+
+func TestGetRejectsInvalidISBN(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("不正な ISBN でリクエストしています")
+	})
+
+	if _, err := c.Get(context.Background(), []string{readableCode, "9784873115659"}); !errors.Is(err, isbn.ErrInvalid) {
+		t.Errorf("isbn.ErrInvalid を期待しましたが %v", err)
+	}
+}
+
+func TestGetCanceledDuringRetry(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	// 1 回目の失敗後のリトライ待機（2 秒）中にキャンセルする
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Get(ctx, []string{readableCode})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("context.DeadlineExceeded を期待しましたが %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("キャンセル後も待機しています: %s", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("リクエスト回数不一致: got %d, want 1", calls.Load())
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	tests := map[string]string{
+		"20200115":   "2020-01-15",
+		"202001":     "2020-01",
+		"2020":       "2020",
+		"2020-01-15": "2020-01-15",
+		"":           "",
+	}
+	for in, want := range tests {
+		if got := normalizeDate(in); got != want {
+			t.Errorf("normalizeDate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
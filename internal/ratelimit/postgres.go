@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// PostgresCounter は日次の使用回数を api_daily_usage テーブルに保存する DailyCounter です。
+// バッチ・retry-failed・再実行のように別のプロセスで同じ日に問い合わせても、上限を合わせて数えます。
+type PostgresCounter struct {
+	DB *sql.DB
+}
+
+func (c *PostgresCounter) Reserve(ctx context.Context, host, day string, limit int) (bool, error) {
+	// 上限に達している場合は更新せず、行を返さない
+	var used int
+	err := c.DB.QueryRowContext(ctx, `
+		INSERT INTO api_daily_usage (host, day, used)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (host, day) DO UPDATE SET used = api_daily_usage.used + 1
+		WHERE api_daily_usage.used < $3
+		RETURNING used
+	`, host, day, limit).Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("使用回数の更新エラー: %w", err)
+	}
+	return true, nil
+}
+
+func (c *PostgresCounter) Release(ctx context.Context, host, day string) error {
+	_, err := c.DB.ExecContext(ctx, `
+		UPDATE api_daily_usage SET used = used - 1 WHERE host = $1 AND day = $2 AND used > 0
+	`, host, day)
+	if err != nil {
+		return fmt.Errorf("使用回数の更新エラー: %w", err)
+	}
+	return nil
+}
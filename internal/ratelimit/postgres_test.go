@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database/dbtest"
+)
+
+func TestPostgresCounter(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+
+	const host, day = "counter.example.com", "2026-01-01"
+	t.Cleanup(func() { db.Exec(`DELETE FROM api_daily_usage WHERE host = $1`, host) })
+
+	c := &PostgresCounter{DB: db}
+	for i := 0; i < 2; i++ {
+		ok, err := c.Reserve(ctx, host, day, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("%d 回目で上限に達しました", i+1)
+		}
+	}
+	if ok, err := c.Reserve(ctx, host, day, 2); err != nil || ok {
+		t.Fatalf("上限を超えて予約しました: ok %v, err %v", ok, err)
+	}
+
+	// 取り消した分は再び予約できる
+	if err := c.Release(ctx, host, day); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Reserve(ctx, host, day, 2); err != nil || !ok {
+		t.Fatalf("取り消した分を予約できません: ok %v, err %v", ok, err)
+	}
+
+	// 日付ごとに数える
+	if ok, err := c.Reserve(ctx, host, "2026-01-02", 2); err != nil || !ok {
+		t.Fatalf("翌日の分を予約できません: ok %v, err %v", ok, err)
+	}
+}
@@ -0,0 +1,377 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded は日次の上限回数に達した場合のエラーです。リトライしても回復しません。
+var ErrQuotaExceeded = errors.New("日次のリクエスト上限に達しました")
+
+// EnvName はホストごとの制限を指定する環境変数です。書式は ParseLimits を参照してください。
+const EnvName = "RATE_LIMITS"
+
+// DefaultHost は個別の設定がないホストに適用する制限のキーです。
+const DefaultHost = "*"
+
+// Limit は 1 ホストあたりの制限です。
+// Rate は 1 秒あたりの回数（0 は無制限）、Burst は連続して送れる回数、Daily は 1 日の上限回数（0 は無制限）です。
+type Limit struct {
+	Rate  float64
+	Burst int
+	Daily int
+}
+
+// DefaultLimits は外部 API ごとの既定の制限です。
+var DefaultLimits = map[string]Limit{
+	"ci.nii.ac.jp":        {Rate: 1, Burst: 1},
+	"www.googleapis.com":  {Rate: 1, Burst: 10, Daily: 1000}, // 100 回/100 秒, 1,000 回/日
+	"api.openbd.jp":       {Rate: 1, Burst: 1},
+	"ndlsearch.ndl.go.jp": {Rate: 1, Burst: 1},
+}
+
+// Limiter はホストごとのトークンバケットと日次の回数を管理します。複数のクライアントで共有できます。
+type Limiter struct {
+	mu      sync.Mutex
+	limits  map[string]Limit
+	buckets map[string]*bucket
+	counter DailyCounter
+	now     func() time.Time
+}
+
+// DailyCounter はホストごと・日ごとの使用回数を保存し、プロセスをまたいで日次の上限を共有します。
+// day は time.DateOnly 形式の日付です。
+type DailyCounter interface {
+	// Reserve は使用回数を 1 回増やします。上限 limit に達している場合は増やさずに false を返します
+	Reserve(ctx context.Context, host, day string, limit int) (bool, error)
+	// Release は Reserve した 1 回を取り消します
+	Release(ctx context.Context, host, day string) error
+}
+
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+	day    string
+	used   int
+	total  int
+}
+
+// New は limits で制限する Limiter を返します。limits にないホストは DefaultHost の制限（なければ無制限）です。
+func New(limits map[string]Limit) *Limiter {
+	l := &Limiter{
+		limits:  make(map[string]Limit, len(limits)),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+	for host, limit := range limits {
+		l.limits[host] = limit
+	}
+	return l
+}
+
+var shared = New(DefaultLimits)
+
+// Shared はすべての外部 API クライアントで共有する Limiter を返します。
+func Shared() *Limiter {
+	return shared
+}
+
+// LoadEnv は環境変数 RATE_LIMITS の指定で Shared の制限を上書きします。
+func LoadEnv() error {
+	limits, err := ParseLimits(os.Getenv(EnvName))
+	if err != nil {
+		return fmt.Errorf("%s の設定エラー: %w", EnvName, err)
+	}
+	for host, limit := range limits {
+		shared.SetLimit(host, limit)
+	}
+	return nil
+}
+
+// SetCounter は日次の使用回数の保存先を設定します。設定しない場合はプロセス内の回数だけで制限します。
+func (l *Limiter) SetCounter(c DailyCounter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counter = c
+}
+
+// SetLimit は host の制限を設定します。使用回数は引き継ぎます。
+func (l *Limiter) SetLimit(host string, limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits[host] = limit
+	if host == DefaultHost {
+		// 個別の設定がないホストのバケットにも反映する
+		for h, b := range l.buckets {
+			if _, ok := l.limits[h]; !ok {
+				b.limit = limit
+				b.tokens = math.Min(b.tokens, float64(burst(limit)))
+			}
+		}
+		return
+	}
+	if b, ok := l.buckets[host]; ok {
+		b.limit = limit
+		b.tokens = math.Min(b.tokens, float64(burst(limit)))
+	}
+}
+
+func burst(limit Limit) int {
+	return max(limit.Burst, 1)
+}
+
+func (l *Limiter) bucket(host string, now time.Time) *bucket {
+	b, ok := l.buckets[host]
+	if !ok {
+		limit, ok := l.limits[host]
+		if !ok {
+			limit = l.limits[DefaultHost]
+		}
+		b = &bucket{limit: limit, tokens: float64(burst(limit)), last: now}
+		l.buckets[host] = b
+	}
+
+	if day := now.Format(time.DateOnly); b.day != day {
+		b.day = day
+		b.used = 0
+	}
+	if b.limit.Rate > 0 {
+		b.tokens = math.Min(b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate, float64(burst(b.limit)))
+	}
+	b.last = now
+	return b
+}
+
+// Wait は host へのリクエストを 1 回分予約し、送信できるまで待ちます。
+// 日次の上限に達している場合は待たずに ErrQuotaExceeded を返し、ctx がキャンセルされた場合は予約を取り消します。
+// DailyCounter を設定した場合は、他のプロセスの使用回数も合わせて日次の上限を判定します。
+func (l *Limiter) Wait(ctx context.Context, host string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	b := l.bucket(host, l.now())
+	if b.limit.Daily > 0 && b.used >= b.limit.Daily {
+		l.mu.Unlock()
+		return fmt.Errorf("%s: %w (%d 回)", host, ErrQuotaExceeded, b.limit.Daily)
+	}
+	b.used++
+	b.total++
+	if b.used == b.limit.Daily {
+		log.Printf("[ratelimit] %s の日次上限 %d 回に達しました", host, b.limit.Daily)
+	}
+
+	var wait time.Duration
+	if b.limit.Rate > 0 {
+		// トークンが足りなければ前借りし、補充されるまで待つ
+		b.tokens--
+		if b.tokens < 0 {
+			wait = time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+		}
+	}
+	day, daily, counter := b.day, b.limit.Daily, l.counter
+	l.mu.Unlock()
+
+	reserved := false
+	if daily > 0 && counter != nil {
+		ok, err := counter.Reserve(ctx, host, day, daily)
+		switch {
+		case err != nil:
+			// 保存先の障害でリクエストを止めないよう、このプロセスの回数だけで制限を続ける
+			log.Printf("[ratelimit] %s の日次の使用回数の記録エラー: %v", host, err)
+		case !ok:
+			// 他のプロセスと合わせて上限に達している。以降は保存先に問い合わせずに断る
+			l.mu.Lock()
+			b.tokens++
+			b.total--
+			if b.day == day {
+				b.used = daily
+			}
+			l.mu.Unlock()
+			return fmt.Errorf("%s: %w (%d 回)", host, ErrQuotaExceeded, daily)
+		default:
+			reserved = true
+		}
+	}
+
+	if wait == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		b.tokens++
+		b.used--
+		b.total--
+		l.mu.Unlock()
+		if reserved {
+			if err := counter.Release(context.WithoutCancel(ctx), host, day); err != nil {
+				log.Printf("[ratelimit] %s の日次の使用回数の記録エラー: %v", host, err)
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// Usage はホストごとの使用状況です。
+type Usage struct {
+	Host   string
+	Limit  Limit
+	Today  int     // 今日のリクエスト回数
+	Total  int     // 起動してからのリクエスト回数
+	Tokens float64 // 現在のトークン数（負の値は待機中のリクエストがあることを示す）
+}
+
+func (u Usage) String() string {
+	daily := "無制限"
+	if u.Limit.Daily > 0 {
+		daily = strconv.Itoa(u.Limit.Daily)
+	}
+	return fmt.Sprintf("%s: 本日 %d/%s 回, 累計 %d 回, トークン %.1f/%d", u.Host, u.Today, daily, u.Total, u.Tokens, burst(u.Limit))
+}
+
+// Usage はリクエストしたことのあるホストの使用状況をホスト名順に返します。
+func (l *Limiter) Usage() []Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	usage := make([]Usage, 0, len(l.buckets))
+	for host := range l.buckets {
+		b := l.bucket(host, now)
+		usage = append(usage, Usage{Host: host, Limit: b.limit, Today: b.used, Total: b.total, Tokens: b.tokens})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Host < usage[j].Host })
+	return usage
+}
+
+// LogUsage は使用状況をログに出力します。
+func (l *Limiter) LogUsage() {
+	for _, u := range l.Usage() {
+		log.Printf("[ratelimit] %s", u)
+	}
+}
+
+// Transport は送信前に Wait する http.RoundTripper を返します。base が nil の場合は http.DefaultTransport を使います。
+func (l *Limiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{limiter: l, base: base}
+}
+
+type transport struct {
+	limiter *Limiter
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// StatusError は外部 API が 200 以外のステータスコードを返した場合のエラーです。
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("不正なステータスコード: %d", e.StatusCode)
+}
+
+// Temporary は 429（リクエスト過多）や 5xx（サーバーエラー）のように、時間をおけば回復する可能性があるかを返します。
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Retryable はリトライで回復する可能性のあるエラーかを返します。retry.RetryIf に渡して使います。
+// 404 などの一時的でないステータスコードはリトライしません。
+func Retryable(err error) bool {
+	if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	return true
+}
+
+// ParseLimits は "ci.nii.ac.jp=1/1s,www.googleapis.com=100/100s:burst=10:daily=1000" 形式の指定を解釈します。
+// 回数/期間 の後に :burst=N（既定 1）と :daily=N（既定 0 = 無制限）を指定できます。
+// 回数/期間 に 0 を指定すると無制限です。ホストに * を指定すると既定の制限になります。
+func ParseLimits(spec string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, value, ok := strings.Cut(entry, "=")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("制限の形式が不正です: %q (ホスト=回数/期間 で指定してください)", entry)
+		}
+
+		parts := strings.Split(value, ":")
+		limit, err := parseRate(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+		for _, opt := range parts[1:] {
+			name, v, _ := strings.Cut(opt, "=")
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s: %s には 0 以上の整数を指定してください: %q", host, name, v)
+			}
+			switch name {
+			case "burst":
+				limit.Burst = n
+			case "daily":
+				limit.Daily = n
+			default:
+				return nil, fmt.Errorf("%s: 未知の設定です: %q", host, name)
+			}
+		}
+		limits[host] = limit
+	}
+	return limits, nil
+}
+
+func parseRate(s string) (Limit, error) {
+	if s == "0" {
+		return Limit{}, nil
+	}
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("回数/期間 の形式で指定してください: %q", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("回数には正の整数を指定してください: %q", count)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("期間の形式が不正です: %q", period)
+	}
+	return Limit{Rate: float64(n) / d.Seconds(), Burst: 1}, nil
+}
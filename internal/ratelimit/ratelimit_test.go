@@ -0,0 +1,247 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitBurstAndRate(t *testing.T) {
+	l := New(map[string]Limit{"example.com": {Rate: 20, Burst: 2}})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx, "example.com"); err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("バースト内で待機しています: %s", elapsed)
+	}
+
+	// バーストを使い切った後は 1/20 秒ごと
+	if err := l.Wait(ctx, "example.com"); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("レート制限で待機していません: %s", elapsed)
+	}
+
+	// 設定のないホストは無制限
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(ctx, "other.example.com"); err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+	}
+}
+
+func TestWaitDailyQuota(t *testing.T) {
+	l := New(map[string]Limit{DefaultHost: {Daily: 2}})
+	now := time.Date(2026, 1, 1, 23, 0, 0, 0, time.Local)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx, "example.com"); err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+	}
+	err := l.Wait(ctx, "example.com")
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("ErrQuotaExceeded を期待しましたが %v", err)
+	}
+	if Retryable(err) {
+		t.Error("上限超過をリトライ可能と判定しています")
+	}
+
+	// 日付が変わると回数を戻す
+	now = now.Add(2 * time.Hour)
+	if err := l.Wait(ctx, "example.com"); err != nil {
+		t.Fatalf("日付が変わった後のエラー: %v", err)
+	}
+
+	usage := l.Usage()
+	if len(usage) != 1 || usage[0].Today != 1 || usage[0].Total != 3 {
+		t.Errorf("使用状況が不正です: %+v", usage)
+	}
+}
+
+func TestWaitCanceledReleasesReservation(t *testing.T) {
+	l := New(map[string]Limit{"example.com": {Rate: 1, Burst: 1, Daily: 10}})
+
+	if err := l.Wait(context.Background(), "example.com"); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("context.DeadlineExceeded を期待しましたが %v", err)
+	}
+
+	usage := l.Usage()
+	if usage[0].Today != 1 || usage[0].Tokens < -0.5 {
+		t.Errorf("キャンセルした予約が残っています: %+v", usage[0])
+	}
+}
+
+func TestTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	l := New(map[string]Limit{"127.0.0.1": {Daily: 1}})
+	client := &http.Client{Transport: l.Transport(nil)}
+
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := client.Get(ts.URL); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("ErrQuotaExceeded を期待しましたが %v", err)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"日次上限", fmt.Errorf("googlebooks: %w", ErrQuotaExceeded), false},
+		{"キャンセル", context.Canceled, false},
+		{"429", fmt.Errorf("リクエストエラー: %w", &StatusError{StatusCode: http.StatusTooManyRequests}), true},
+		{"503", &StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"404", &StatusError{StatusCode: http.StatusNotFound}, false},
+		{"通信エラー", errors.New("connection refused"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]Limit
+		wantErr bool
+	}{
+		{spec: "", want: map[string]Limit{}},
+		{spec: "ci.nii.ac.jp=1/1s", want: map[string]Limit{"ci.nii.ac.jp": {Rate: 1, Burst: 1}}},
+		{
+			spec: "www.googleapis.com=100/100s:burst=10:daily=1000, *=2/1s",
+			want: map[string]Limit{
+				"www.googleapis.com": {Rate: 1, Burst: 10, Daily: 1000},
+				"*":                  {Rate: 2, Burst: 1},
+			},
+		},
+		{spec: "api.openbd.jp=0:daily=5", want: map[string]Limit{"api.openbd.jp": {Daily: 5}}},
+		{spec: "ci.nii.ac.jp", wantErr: true},
+		{spec: "ci.nii.ac.jp=1", wantErr: true},
+		{spec: "ci.nii.ac.jp=1/0s", wantErr: true},
+		{spec: "ci.nii.ac.jp=1/1s:burst=-1", wantErr: true},
+		{spec: "ci.nii.ac.jp=1/1s:weekly=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimits(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLimits(%q): エラーを期待しましたが %v", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLimits(%q): 予期しないエラー: %v", tt.spec, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseLimits(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+		for host, want := range tt.want {
+			if got[host] != want {
+				t.Errorf("ParseLimits(%q)[%q] = %+v, want %+v", tt.spec, host, got[host], want)
+			}
+		}
+	}
+}
+
+// memCounter はプロセスをまたいだ使用回数の保存先の代わりです。
+type memCounter struct {
+	mu   sync.Mutex
+	used map[string]int
+	err  error
+}
+
+func (c *memCounter) Reserve(ctx context.Context, host, day string, limit int) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return false, c.err
+	}
+	if c.used[host+" "+day] >= limit {
+		return false, nil
+	}
+	c.used[host+" "+day]++
+	return true, nil
+}
+
+func (c *memCounter) Release(ctx context.Context, host, day string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.used[host+" "+day]--
+	return nil
+}
+
+func TestWaitDailyQuotaSharedCounter(t *testing.T) {
+	counter := &memCounter{used: make(map[string]int)}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	ctx := context.Background()
+
+	// 2 つのプロセスの Limiter が同じ保存先で日次の上限を共有する
+	first := New(map[string]Limit{DefaultHost: {Daily: 3}})
+	first.now = func() time.Time { return now }
+	first.SetCounter(counter)
+	for i := 0; i < 2; i++ {
+		if err := first.Wait(ctx, "example.com"); err != nil {
+			t.Fatalf("予期しないエラー: %v", err)
+		}
+	}
+
+	second := New(map[string]Limit{DefaultHost: {Daily: 3}})
+	second.now = func() time.Time { return now }
+	second.SetCounter(counter)
+	if err := second.Wait(ctx, "example.com"); err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if err := second.Wait(ctx, "example.com"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("ErrQuotaExceeded を期待しましたが %v", err)
+	}
+	if usage := second.Usage(); usage[0].Total != 1 {
+		t.Errorf("断ったリクエストを数えています: %+v", usage[0])
+	}
+
+	// 日付が変わると保存先の回数も別になる
+	now = now.Add(24 * time.Hour)
+	if err := first.Wait(ctx, "example.com"); err != nil {
+		t.Fatalf("日付が変わった後のエラー: %v", err)
+	}
+
+	// 保存先の障害ではプロセス内の回数で制限を続ける
+	counter.err = errors.New("接続エラー")
+	if err := second.Wait(ctx, "example.com"); err != nil {
+		t.Fatalf("保存先の障害でリクエストを止めました: %v", err)
+	}
+}
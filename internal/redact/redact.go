@@ -0,0 +1,12 @@
+package redact
+
+import "regexp"
+
+// queryPattern は URL のクエリ文字列とフラグメントです。API キーや appid を含むことがあります。
+var queryPattern = regexp.MustCompile(`(https?://[^\s"'?#]+)[?#][^\s"']*`)
+
+// URLs は s に含まれる URL からクエリ文字列とフラグメントを取り除きます。
+// 外部 API のエラーを DB や API の応答に残す前に使います。
+func URLs(s string) string {
+	return queryPattern.ReplaceAllString(s, "$1")
+}
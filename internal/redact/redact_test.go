@@ -0,0 +1,32 @@
+package redact
+
+import "testing"
+
+func TestURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			"url.Error",
+			`HTTPリクエスト失敗: Get "https://ci.nii.ac.jp/books/opensearch/search?format=json&appid=secret&clas=007": i/o timeout`,
+			`HTTPリクエスト失敗: Get "https://ci.nii.ac.jp/books/opensearch/search": i/o timeout`,
+		},
+		{
+			"複数の URL",
+			"googlebooks: Get https://www.googleapis.com/books/v1/volumes?q=isbn:1&key=secret\nopenbd: Get https://api.openbd.jp/v1/get#frag",
+			"googlebooks: Get https://www.googleapis.com/books/v1/volumes\nopenbd: Get https://api.openbd.jp/v1/get",
+		},
+		{"クエリなし", "不正なステータスコード: 503 (https://api.openbd.jp/v1/get)", "不正なステータスコード: 503 (https://api.openbd.jp/v1/get)"},
+		{"URL なし", "ISBN 9784003101018: 書誌情報が見つかりません", "ISBN 9784003101018: 書誌情報が見つかりません"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := URLs(tt.in); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+)
+
+// MemoryBookRepository はテストやローカル動作確認用のインメモリ実装です。
+type MemoryBookRepository struct {
+	mu     sync.RWMutex
+	books  []*book.Book
+	nextID int64
+}
+
+// NewMemoryBookRepository は books を保持するリポジトリを返します。
+// ID が 0 の書籍には連番を振ります。
+func NewMemoryBookRepository(books ...*book.Book) *MemoryBookRepository {
+	r := &MemoryBookRepository{nextID: 1}
+	for _, b := range books {
+		r.Add(b)
+	}
+	return r
+}
+
+// Add は書籍を追加します。
+func (r *MemoryBookRepository) Add(b *book.Book) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := *b
+	if c.ID == 0 {
+		c.ID = r.nextID
+	}
+	if c.ID >= r.nextID {
+		r.nextID = c.ID + 1
+	}
+	r.books = append(r.books, &c)
+	sort.Slice(r.books, func(i, j int) bool { return r.books[i].ID < r.books[j].ID })
+}
+
+func (r *MemoryBookRepository) Random(ctx context.Context, params RandomParams) ([]*book.Book, error) {
+	if err := validateCount(params.Count, MaxRandomCount); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var candidates []*book.Book
+	for _, b := range r.books {
+		if params.NDC.MatchAny(b.NDC) {
+			candidates = append(candidates, b)
+		}
+	}
+
+	books := make([]*book.Book, 0, params.Count)
+	for _, i := range rand.Perm(len(candidates)) {
+		if len(books) == params.Count {
+			break
+		}
+		books = append(books, copyBook(candidates[i]))
+	}
+	return books, nil
+}
+
+func (r *MemoryBookRepository) GetByISBN(ctx context.Context, isbn string) (*book.Book, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, b := range r.books {
+		if b.ISBN == isbn {
+			return copyBook(b), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryBookRepository) List(ctx context.Context, params ListParams) ([]*book.Book, bool, error) {
+	if err := validateCount(params.Limit, MaxListLimit); err != nil {
+		return nil, false, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	author := strings.ToLower(params.Author)
+	var books []*book.Book
+	for _, b := range r.books {
+		if b.ID <= params.AfterID {
+			continue
+		}
+		if params.Publisher != "" && b.Publisher != params.Publisher {
+			continue
+		}
+		if author != "" && !strings.Contains(strings.ToLower(book.JoinAuthors(b.Authors)), author) {
+			continue
+		}
+		if !params.NDC.MatchAny(b.NDC) {
+			continue
+		}
+		if !matchesYear(b.PublishedDate, params.YearFrom, params.YearTo) {
+			continue
+		}
+		if len(books) == params.Limit {
+			return books, true, nil
+		}
+		books = append(books, copyBook(b))
+	}
+	return books, false, nil
+}
+
+func (r *MemoryBookRepository) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	if err := validateCount(limit, MaxListLimit); err != nil {
+		return nil, err
+	}
+	terms, err := validateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var results []*SearchResult
+	for _, b := range r.books {
+		rank := rankBook(b, terms)
+		if rank == 0 {
+			continue
+		}
+		results = append(results, &SearchResult{Book: copyBook(b), Rank: rank, Snippet: snippet(b, terms)})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank > results[j].Rank })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func copyBook(b *book.Book) *book.Book {
+	c := *b
+	c.Authors = append([]string(nil), b.Authors...)
+	c.NDC = append([]string(nil), b.NDC...)
+	c.Provenance = maps.Clone(b.Provenance)
+	return &c
+}
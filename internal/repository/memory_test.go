@@ -0,0 +1,110 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndc"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
+)
+
+func newTestRepository() *repository.MemoryBookRepository {
+	rashomon := book.NewBook("9784003101049", "羅生門", "", []string{"芥川龍之介"}, "岩波書店", "1915-01-01", "人間のエゴイズムを描いた短編小説", "", "")
+	rashomon.NDC = []string{"913.6"}
+
+	return repository.NewMemoryBookRepository(
+		book.NewBook("9784003101018", "吾輩は猫である", "", []string{"夏目漱石"}, "岩波書店", "1905-01-01", "猫の視点から人間社会を描いた名作", "", ""),
+		book.NewBook("9784003101025", "坊っちゃん", "", []string{"夏目漱石"}, "岩波書店", "1906-01-01", "正義感の強い青年教師の物語", "", ""),
+		rashomon,
+	)
+}
+
+func TestMemoryBookRepository_Random(t *testing.T) {
+	repo := newTestRepository()
+	ctx := context.Background()
+
+	books, err := repo.Random(ctx, repository.RandomParams{Count: 3})
+	assert.NoError(t, err)
+	assert.Len(t, books, 3)
+
+	seen := map[string]bool{}
+	for _, b := range books {
+		assert.False(t, seen[b.ISBN], "重複した書籍: %s", b.ISBN)
+		seen[b.ISBN] = true
+	}
+
+	_, err = repo.Random(ctx, repository.RandomParams{Count: repository.MaxRandomCount + 1})
+	assert.ErrorIs(t, err, repository.ErrInvalidCount)
+
+	books, err = repo.Random(ctx, repository.RandomParams{Count: 3, NDC: ndc.Pattern{Code: "913", Prefix: true}})
+	assert.NoError(t, err)
+	if assert.Len(t, books, 1) {
+		assert.Equal(t, "羅生門", books[0].Title)
+	}
+
+	books, err = repo.Random(ctx, repository.RandomParams{Count: 3, NDC: ndc.Pattern{Code: "913"}})
+	assert.NoError(t, err)
+	assert.Empty(t, books)
+}
+
+func TestMemoryBookRepository_GetByISBN(t *testing.T) {
+	repo := newTestRepository()
+	ctx := context.Background()
+
+	b, err := repo.GetByISBN(ctx, "9784003101025")
+	assert.NoError(t, err)
+	assert.Equal(t, "坊っちゃん", b.Title)
+	assert.Equal(t, int64(2), b.ID)
+
+	_, err = repo.GetByISBN(ctx, "9784000000000")
+	assert.True(t, errors.Is(err, repository.ErrNotFound))
+}
+
+func TestMemoryBookRepository_List(t *testing.T) {
+	repo := newTestRepository()
+	ctx := context.Background()
+
+	books, hasMore, err := repo.List(ctx, repository.ListParams{Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, books, 2)
+	assert.True(t, hasMore)
+
+	books, hasMore, err = repo.List(ctx, repository.ListParams{AfterID: books[1].ID, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, books, 1)
+	assert.False(t, hasMore)
+	assert.Equal(t, "羅生門", books[0].Title)
+
+	books, _, err = repo.List(ctx, repository.ListParams{Limit: 10, Author: "夏目", YearFrom: 1906, YearTo: 1906})
+	assert.NoError(t, err)
+	assert.Len(t, books, 1)
+	assert.Equal(t, "坊っちゃん", books[0].Title)
+
+	books, _, err = repo.List(ctx, repository.ListParams{Limit: 10, NDC: ndc.Pattern{Code: "913.6"}})
+	assert.NoError(t, err)
+	assert.Len(t, books, 1)
+	assert.Equal(t, "羅生門", books[0].Title)
+}
+
+func TestMemoryBookRepository_Search(t *testing.T) {
+	repo := newTestRepository()
+	ctx := context.Background()
+
+	results, err := repo.Search(ctx, "夏目", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	results, err = repo.Search(ctx, "猫 人間", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "吾輩は猫である", results[0].Book.Title)
+		assert.Equal(t, "<mark>猫</mark>の視点から<mark>人間</mark>社会を描いた名作", results[0].Snippet)
+		assert.Equal(t, 1.5, results[0].Rank) // 猫: タイトル(1) + 説明(0.25), 人間: 説明(0.25)
+	}
+
+	_, err = repo.Search(ctx, "   ", 10)
+	assert.ErrorIs(t, err, repository.ErrInvalidQuery)
+}
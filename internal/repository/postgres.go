@@ -0,0 +1,362 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndc"
+)
+
+const bookColumns = `
+		id,
+		isbn,
+		title,
+		subtitle,
+		authors,
+		publisher,
+		published_date,
+		description,
+		book_url,
+		image_url,
+		ARRAY(SELECT ndc FROM books_ndc WHERE book_id = books.id ORDER BY ndc) AS ndc,
+		provenance,
+		created_at,
+		updated_at`
+
+const selectBookColumns = `
+	SELECT` + bookColumns + `
+	FROM books
+`
+
+// ランダム取得で id を探索する際の設定。
+const (
+	randomProbeMinRows    = 1000 // これ未満の件数なら並べ替えで十分に速い
+	randomProbeRounds     = 4
+	randomProbeOversample = 2.0
+	randomProbeMaxIDs     = 1000
+)
+
+type PostgresBookRepository struct {
+	DB *sql.DB
+}
+
+func NewPostgresBookRepository(db *sql.DB) *PostgresBookRepository {
+	return &PostgresBookRepository{DB: db}
+}
+
+func (r *PostgresBookRepository) Random(ctx context.Context, params RandomParams) ([]*book.Book, error) {
+	if err := validateCount(params.Count, MaxRandomCount); err != nil {
+		return nil, err
+	}
+
+	// id の範囲と統計情報の推定件数はインデックスとカタログから取得でき、全件走査しない
+	var minID, maxID sql.NullInt64
+	var estimated float64
+	err := r.DB.QueryRowContext(ctx, `
+		SELECT min(id), max(id),
+			(SELECT reltuples FROM pg_class WHERE oid = 'books'::regclass)
+		FROM books
+	`).Scan(&minID, &maxID, &estimated)
+	if err != nil {
+		return nil, fmt.Errorf("書籍件数取得エラー: %w", err)
+	}
+	if !minID.Valid {
+		return []*book.Book{}, nil
+	}
+	if estimated < randomProbeMinRows {
+		return r.randomBySort(ctx, params.NDC, params.Count, nil)
+	}
+
+	picked, err := r.randomByProbe(ctx, params, minID.Int64, maxID.Int64, estimated)
+	if err != nil {
+		return nil, err
+	}
+
+	// 探索で足りない場合（絞り込みの一致が少ない、id の欠番が多いなど）は残りを並べ替えで補う
+	if len(picked) < params.Count {
+		exclude := make([]int64, len(picked))
+		for i, b := range picked {
+			exclude[i] = b.ID
+		}
+		rest, err := r.randomBySort(ctx, params.NDC, params.Count-len(picked), exclude)
+		if err != nil {
+			return nil, err
+		}
+		picked = append(picked, rest...)
+	}
+
+	rand.Shuffle(len(picked), func(i, j int) { picked[i], picked[j] = picked[j], picked[i] })
+	return picked, nil
+}
+
+// randomByProbe は [minID, maxID] から一様に id を引き、存在する行（絞り込み条件に一致する行）だけを採用します。
+// 欠番や条件に一致しない id は棄却するため、どの行も等しい確率で選ばれ、重複もしません。
+func (r *PostgresBookRepository) randomByProbe(ctx context.Context, params RandomParams, minID, maxID int64, estimated float64) ([]*book.Book, error) {
+	query := selectBookColumns + `
+		WHERE id = ANY($1)
+	`
+	var args []any
+	if !params.NDC.IsZero() {
+		cond, arg := ndcCond(params.NDC, 2)
+		query += " AND " + cond
+		args = append(args, arg)
+	}
+
+	span := maxID - minID + 1
+	density := min(estimated/float64(span), 1)
+	seen := make(map[int64]bool)
+	var picked []*book.Book
+
+	for round := 0; round < randomProbeRounds && len(picked) < params.Count; round++ {
+		need := params.Count - len(picked)
+		n := int(math.Ceil(float64(need) / density * randomProbeOversample))
+		n = max(min(n, randomProbeMaxIDs, int(span)-len(seen)), 0)
+		if n == 0 {
+			break
+		}
+
+		ids := make([]int64, 0, n)
+		for len(ids) < n {
+			id := minID + rand.Int63n(span)
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+
+		hits, err := r.query(ctx, query, append([]any{pq.Array(ids)}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		// 結果は id 順で返るため、必要数だけ取る前に混ぜて偏りをなくす
+		rand.Shuffle(len(hits), func(i, j int) { hits[i], hits[j] = hits[j], hits[i] })
+		picked = append(picked, hits[:min(len(hits), need)]...)
+
+		// 実際の一致率で次の回の抽選数を補正する
+		if len(hits) > 0 {
+			density = float64(len(hits)) / float64(len(ids))
+		} else {
+			density /= randomProbeOversample * 2
+		}
+	}
+
+	return picked, nil
+}
+
+// randomBySort は条件に一致する行を並べ替えて count 件選びます。件数が少ない場合や探索の補完に使います。
+func (r *PostgresBookRepository) randomBySort(ctx context.Context, p ndc.Pattern, count int, exclude []int64) ([]*book.Book, error) {
+	conds := []string{"TRUE"}
+	args := []any{count}
+	if len(exclude) > 0 {
+		args = append(args, pq.Array(exclude))
+		conds = append(conds, fmt.Sprintf("id <> ALL($%d)", len(args)))
+	}
+	if !p.IsZero() {
+		cond, arg := ndcCond(p, len(args)+1)
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+
+	return r.query(ctx, selectBookColumns+`
+		WHERE `+strings.Join(conds, " AND ")+`
+		ORDER BY RANDOM()
+		LIMIT $1
+	`, args...)
+}
+
+func (r *PostgresBookRepository) GetByISBN(ctx context.Context, isbn string) (*book.Book, error) {
+	books, err := r.query(ctx, selectBookColumns+`
+		WHERE isbn = $1
+	`, isbn)
+	if err != nil {
+		return nil, err
+	}
+	if len(books) == 0 {
+		return nil, ErrNotFound
+	}
+	return books[0], nil
+}
+
+func (r *PostgresBookRepository) List(ctx context.Context, params ListParams) ([]*book.Book, bool, error) {
+	if err := validateCount(params.Limit, MaxListLimit); err != nil {
+		return nil, false, err
+	}
+
+	conds := []string{"id > $1"}
+	args := []any{params.AfterID}
+	addCond := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if params.Publisher != "" {
+		addCond("publisher = $%d", params.Publisher)
+	}
+	if params.Author != "" {
+		addCond("authors ILIKE $%d", "%"+escapeLike(params.Author)+"%")
+	}
+	if !params.NDC.IsZero() {
+		cond, arg := ndcCond(params.NDC, len(args)+1)
+		args = append(args, arg)
+		conds = append(conds, cond)
+	}
+	// published_date は YYYY から始まる文字列のため、文字列比較で年の範囲を絞り込む
+	if params.YearFrom > 0 {
+		addCond("published_date >= $%d", fmt.Sprintf("%04d", params.YearFrom))
+	}
+	if params.YearTo > 0 {
+		addCond("published_date < $%d", fmt.Sprintf("%04d", params.YearTo+1))
+	}
+
+	args = append(args, params.Limit+1)
+	books, err := r.query(ctx, selectBookColumns+`
+		WHERE `+strings.Join(conds, " AND ")+`
+		ORDER BY id
+		LIMIT `+fmt.Sprintf("$%d", len(args)), args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(books) > params.Limit {
+		return books[:params.Limit], true, nil
+	}
+	return books, false, nil
+}
+
+func (r *PostgresBookRepository) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	if err := validateCount(limit, MaxListLimit); err != nil {
+		return nil, err
+	}
+	terms, err := validateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// 各語について 2-gram 索引（1 文字の語は 1 文字単位の索引）で候補を絞り込み、LIKE で確定する。
+	// 1 文字の語の 2-gram は空配列になり、@> '{}' がすべての行に一致して全件を LIKE で走査してしまう。
+	// 順位は列ごとの重みを付けた 2-gram の tsvector（search_vector）に対する ts_rank で決める
+	var conds, queries []string
+	var args []any
+	for _, t := range terms {
+		args = append(args, t, "%"+escapeLike(t)+"%")
+		term, pattern := len(args)-1, len(args)
+		ngrams := "text_bigrams"
+		if utf8.RuneCountInString(t) < 2 {
+			ngrams = "text_unigrams"
+		}
+		conds = append(conds, fmt.Sprintf(
+			"%[1]s(search_text) @> %[1]s($%[2]d) AND search_text LIKE $%[3]d", ngrams, term, pattern))
+		queries = append(queries, fmt.Sprintf("text_bigram_tsquery($%d)", term))
+	}
+	args = append(args, limit)
+
+	// ts_rank の重みは D・C・B・A（説明・著者・サブタイトル・タイトル）の順。
+	// 正規化 1 は文書の長さの対数で割り、長い説明を持つ書籍が上位に偏らないようにする
+	weights := fmt.Sprintf("'{%g,%g,%g,%g}'", descriptionWeight, authorsWeight, subtitleWeight, titleWeight)
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT * FROM (
+			SELECT`+bookColumns+`,
+				ts_rank(`+weights+`, search_vector, `+strings.Join(queries, " && ")+`, 1) AS rank
+			FROM books
+			WHERE `+strings.Join(conds, " AND ")+`
+		) AS hits
+		ORDER BY rank DESC, id
+		LIMIT `+fmt.Sprintf("$%d", len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("書籍検索エラー: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		var rank float64
+		b, err := scanBook(rows, &rank)
+		if err != nil {
+			return nil, fmt.Errorf("検索結果読み取りエラー: %w", err)
+		}
+		results = append(results, &SearchResult{Book: b, Rank: rank, Snippet: snippet(b, terms)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("検索結果読み取りエラー: %w", err)
+	}
+
+	return results, nil
+}
+
+func (r *PostgresBookRepository) query(ctx context.Context, query string, args ...any) ([]*book.Book, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("書籍取得エラー: %w", err)
+	}
+	defer rows.Close()
+
+	var books []*book.Book
+	for rows.Next() {
+		b, err := scanBook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("書籍読み取りエラー: %w", err)
+		}
+		books = append(books, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("書籍読み取りエラー: %w", err)
+	}
+
+	return books, nil
+}
+
+// scanBook は bookColumns の順で 1 行読み取ります。extra は後続の列の格納先です。
+func scanBook(rows *sql.Rows, extra ...any) (*book.Book, error) {
+	var b book.Book
+	var authors string
+	var ndc pq.StringArray
+	var provenance []byte
+	dest := []any{
+		&b.ID,
+		&b.ISBN,
+		&b.Title,
+		&b.Subtitle,
+		&authors,
+		&b.Publisher,
+		&b.PublishedDate,
+		&b.Description,
+		&b.BookURL,
+		&b.ImageURL,
+		&ndc,
+		&provenance,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	b.Authors = book.SplitAuthors(authors)
+	b.NDC = []string(ndc)
+	if err := json.Unmarshal(provenance, &b.Provenance); err != nil {
+		return nil, fmt.Errorf("provenance の JSON パースエラー: %w", err)
+	}
+	return &b, nil
+}
+
+// ndcCond は NDC 分類で絞り込む条件式と引数を返します。n はプレースホルダの番号です。
+func ndcCond(p ndc.Pattern, n int) (string, any) {
+	if p.Prefix {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM books_ndc WHERE book_id = books.id AND ndc LIKE $%d)", n),
+			escapeLike(p.Code) + "%"
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM books_ndc WHERE book_id = books.id AND ndc = $%d)", n), p.Code
+}
+
+// escapeLike は LIKE のワイルドカード文字をエスケープします。
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
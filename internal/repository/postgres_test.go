@@ -0,0 +1,74 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database/dbtest"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
+)
+
+func TestPostgresBookRepository_SearchRank(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+
+	// 実在しない 999 始まりの ISBN で登録し、テストの終了時に削除する
+	cleanup := func() { db.Exec("DELETE FROM books WHERE isbn LIKE '999%'") }
+	cleanup()
+	t.Cleanup(cleanup)
+
+	books := []*book.Book{
+		book.NewBook("9990000000001", "吾輩はテスト猫である", "", []string{"著者"}, "出版社", "2020", "ある家の話", "", ""),
+		book.NewBook("9990000000002", "ある家の話", "", []string{"著者"}, "出版社", "2020", "テスト猫が出てくる", "", ""),
+		book.NewBook("9990000000003", "ある町の話", "", []string{"著者"}, "出版社", "2020", "テスト猫とテスト猫が出てくる", "", ""),
+		book.NewBook("9990000000004", "犬の話", "", []string{"著者"}, "出版社", "2020", "猫は出てこない", "", ""),
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := book.BulkInsert(ctx, tx, books); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := repository.NewPostgresBookRepository(db)
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		// タイトルの一致が最も高く、説明では出現回数の多い書籍が高い
+		{"重みと出現回数", "テスト猫", []string{"9990000000001", "9990000000003", "9990000000002"}},
+		// 1 文字の語も順位付けする
+		{"1 文字の語", "猫 犬", []string{"9990000000004"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := repo.Search(ctx, tt.query, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range results {
+				if r.Rank <= 0 {
+					t.Errorf("関連度が 0 です: %s", r.Book.ISBN)
+				}
+				got = append(got, r.Book.ISBN)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("件数不一致: got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("順位不一致: got %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndc"
+)
+
+const (
+	DefaultRandomCount = 3
+	MaxRandomCount     = 10
+
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+var (
+	ErrNotFound     = errors.New("書籍が見つかりません")
+	ErrInvalidCount = errors.New("件数が範囲外です")
+	ErrInvalidQuery = errors.New("検索語が不正です")
+)
+
+// RandomParams は Random の検索条件
+type RandomParams struct {
+	Count int
+	// NDC を指定した場合はその分類（前方一致指定ならその配下）の書籍のみを返します。
+	NDC ndc.Pattern
+}
+
+// ListParams は List の検索条件。ゼロ値の項目は条件に含めません。
+type ListParams struct {
+	// AfterID より大きい id の書籍を id 昇順で返します（カーソル）。
+	AfterID int64
+	Limit   int
+
+	// Publisher は出版社の完全一致
+	Publisher string
+	// Author は著者の部分一致（大文字小文字を区別しない）
+	Author string
+	// NDC は NDC 分類コードの完全一致、または前方一致（"007.3*"）
+	NDC ndc.Pattern
+	// YearFrom, YearTo は出版年の範囲（両端を含む）
+	YearFrom int
+	YearTo   int
+}
+
+// BookRepository は HTTP / gRPC の両方から利用する書籍の読み取り口です。
+type BookRepository interface {
+	// Random は params.Count 件の書籍を重複なしでランダムに返します。
+	Random(ctx context.Context, params RandomParams) ([]*book.Book, error)
+	// GetByISBN は ISBN が一致する書籍を返します。存在しない場合は ErrNotFound を返します。
+	GetByISBN(ctx context.Context, isbn string) (*book.Book, error)
+	// List は条件に一致する書籍を id 昇順で最大 params.Limit 件返します。
+	// 続きがある場合 hasMore は true になります。
+	List(ctx context.Context, params ListParams) (books []*book.Book, hasMore bool, err error)
+	// Search はタイトル・サブタイトル・著者・説明に query の全語を含む書籍を
+	// 関連度の高い順に最大 limit 件返します。PostgreSQL 実装の関連度は、列ごとに重みを付けた
+	// 2-gram の tsvector に対する ts_rank（出現回数と文書の長さを考慮）です。
+	Search(ctx context.Context, query string, limit int) ([]*SearchResult, error)
+}
+
+func validateQuery(query string) ([]string, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 || utf8.RuneCountInString(query) > MaxSearchQueryLength {
+		return nil, ErrInvalidQuery
+	}
+	return terms, nil
+}
+
+func validateCount(count, max int) error {
+	if count < 1 || count > max {
+		return ErrInvalidCount
+	}
+	return nil
+}
+
+// matchesYear は published_date (YYYY, YYYY-MM, YYYY-MM-DD) が年の範囲に含まれるかを返します。
+func matchesYear(publishedDate string, from, to int) bool {
+	if from == 0 && to == 0 {
+		return true
+	}
+	if len(publishedDate) < 4 {
+		return false
+	}
+	year, err := strconv.Atoi(publishedDate[:4])
+	if err != nil {
+		return false
+	}
+	return (from == 0 || year >= from) && (to == 0 || year <= to)
+}
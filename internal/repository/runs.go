@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+)
+
+const (
+	DefaultRunLimit = 20
+	MaxRunLimit     = 100
+)
+
+var ErrRunNotFound = errors.New("実行記録が見つかりません")
+
+// RunListParams は ListRuns の検索条件
+type RunListParams struct {
+	Limit int
+	// Status を指定した場合はその結果の実行のみを返します。
+	Status run.Status
+}
+
+// RunRepository はバッチの実行記録の読み取り口です。
+type RunRepository interface {
+	// List は実行記録を開始日時の新しい順に最大 params.Limit 件返します。
+	List(ctx context.Context, params RunListParams) ([]*run.Run, error)
+	// Get は id の実行記録を返します。存在しない場合は ErrRunNotFound を返します。
+	Get(ctx context.Context, id int64) (*run.Run, error)
+}
+
+const selectRunColumns = `
+	SELECT
+		id,
+		status,
+		config,
+		discovered,
+		enriched,
+		failed,
+		inserted,
+		error,
+		started_at,
+		finished_at
+	FROM ingestion_runs
+`
+
+type PostgresRunRepository struct {
+	DB *sql.DB
+}
+
+func NewPostgresRunRepository(db *sql.DB) *PostgresRunRepository {
+	return &PostgresRunRepository{DB: db}
+}
+
+func (r *PostgresRunRepository) List(ctx context.Context, params RunListParams) ([]*run.Run, error) {
+	if err := validateCount(params.Limit, MaxRunLimit); err != nil {
+		return nil, err
+	}
+
+	query := selectRunColumns
+	args := []any{params.Limit}
+	if params.Status != "" {
+		query += " WHERE status = $2"
+		args = append(args, params.Status)
+	}
+	return r.query(ctx, query+" ORDER BY started_at DESC, id DESC LIMIT $1", args...)
+}
+
+func (r *PostgresRunRepository) Get(ctx context.Context, id int64) (*run.Run, error) {
+	runs, err := r.query(ctx, selectRunColumns+" WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, ErrRunNotFound
+	}
+	return runs[0], nil
+}
+
+func (r *PostgresRunRepository) query(ctx context.Context, query string, args ...any) ([]*run.Run, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("実行記録取得エラー: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*run.Run
+	for rows.Next() {
+		var rn run.Run
+		var config, discovered []byte
+		var finishedAt sql.NullTime
+		err := rows.Scan(
+			&rn.ID,
+			&rn.Status,
+			&config,
+			&discovered,
+			&rn.Enriched,
+			&rn.Failed,
+			&rn.Inserted,
+			&rn.Error,
+			&rn.StartedAt,
+			&finishedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("実行記録読み取りエラー: %w", err)
+		}
+		rn.Config = json.RawMessage(config)
+		if err := json.Unmarshal(discovered, &rn.Discovered); err != nil {
+			return nil, fmt.Errorf("discovered の JSON パースエラー: %w", err)
+		}
+		if finishedAt.Valid {
+			rn.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, &rn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("実行記録読み取りエラー: %w", err)
+	}
+
+	return runs, nil
+}
+
+// MemoryRunRepository はテスト用のインメモリ実装です。
+type MemoryRunRepository struct {
+	mu   sync.RWMutex
+	runs []*run.Run
+}
+
+// NewMemoryRunRepository は runs を保持するリポジトリを返します。ID が 0 の記録には連番を振ります。
+func NewMemoryRunRepository(runs ...*run.Run) *MemoryRunRepository {
+	r := &MemoryRunRepository{}
+	for i, rn := range runs {
+		c := copyRun(rn)
+		if c.ID == 0 {
+			c.ID = int64(i + 1)
+		}
+		r.runs = append(r.runs, c)
+	}
+	// 開始日時の新しい順に並べておく
+	slices.SortStableFunc(r.runs, func(a, b *run.Run) int {
+		if c := b.StartedAt.Compare(a.StartedAt); c != 0 {
+			return c
+		}
+		return int(b.ID - a.ID)
+	})
+	return r
+}
+
+func (r *MemoryRunRepository) List(ctx context.Context, params RunListParams) ([]*run.Run, error) {
+	if err := validateCount(params.Limit, MaxRunLimit); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	runs := []*run.Run{}
+	for _, rn := range r.runs {
+		if params.Status != "" && rn.Status != params.Status {
+			continue
+		}
+		runs = append(runs, copyRun(rn))
+		if len(runs) == params.Limit {
+			break
+		}
+	}
+	return runs, nil
+}
+
+func (r *MemoryRunRepository) Get(ctx context.Context, id int64) (*run.Run, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rn := range r.runs {
+		if rn.ID == id {
+			return copyRun(rn), nil
+		}
+	}
+	return nil, ErrRunNotFound
+}
+
+func copyRun(rn *run.Run) *run.Run {
+	c := *rn
+	c.Config = slices.Clone(rn.Config)
+	c.Discovered = maps.Clone(rn.Discovered)
+	return &c
+}
@@ -0,0 +1,43 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
+)
+
+func TestMemoryRunRepository(t *testing.T) {
+	start := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	repo := repository.NewMemoryRunRepository(
+		&run.Run{Status: run.StatusCommitted, StartedAt: start, Inserted: 60},
+		&run.Run{Status: run.StatusRolledBack, StartedAt: start.Add(24 * time.Hour), Error: "context canceled"},
+		&run.Run{Status: run.StatusCommitted, StartedAt: start.Add(48 * time.Hour), Inserted: 58},
+	)
+	ctx := context.Background()
+
+	runs, err := repo.List(ctx, repository.RunListParams{Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 3) {
+		assert.Equal(t, []int64{3, 2, 1}, []int64{runs[0].ID, runs[1].ID, runs[2].ID}, "開始日時の新しい順")
+	}
+
+	runs, err = repo.List(ctx, repository.RunListParams{Limit: 1, Status: run.StatusCommitted})
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, 58, runs[0].Inserted, "最後にコミットされた実行")
+	}
+
+	_, err = repo.List(ctx, repository.RunListParams{Limit: repository.MaxRunLimit + 1})
+	assert.ErrorIs(t, err, repository.ErrInvalidCount)
+
+	rn, err := repo.Get(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, run.StatusRolledBack, rn.Status)
+
+	_, err = repo.Get(ctx, 99)
+	assert.ErrorIs(t, err, repository.ErrRunNotFound)
+}
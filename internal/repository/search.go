@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+)
+
+const (
+	MaxSearchQueryLength = 100
+
+	snippetRadius = 40
+	highlightOpen = "<mark>"
+	highlightEnd  = "</mark>"
+)
+
+// 検索語が含まれる列ごとの重み。PostgreSQL 実装では ts_rank の重み（0〜1）に、
+// インメモリ実装では一致した列の重みの合計に使います。
+const (
+	titleWeight       = 1.0
+	subtitleWeight    = 0.5
+	authorsWeight     = 0.5
+	descriptionWeight = 0.25
+)
+
+// SearchResult は検索結果 1 件。Snippet は HTML エスケープ済みで、一致箇所を <mark> で囲みます。
+type SearchResult struct {
+	Book    *book.Book
+	Rank    float64
+	Snippet string
+}
+
+// searchTerms は検索文字列を小文字化し、空白区切りの語に分割します。
+func searchTerms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+func searchFields(b *book.Book) []struct {
+	text   string
+	weight float64
+} {
+	return []struct {
+		text   string
+		weight float64
+	}{
+		{b.Title, titleWeight},
+		{b.Subtitle, subtitleWeight},
+		{book.JoinAuthors(b.Authors), authorsWeight},
+		{b.Description, descriptionWeight},
+	}
+}
+
+// rankBook はすべての語を含む場合に重み付きのスコアを返します。含まない語がある場合は 0 です。
+// インメモリ実装はテスト用のため、出現回数や文書の長さは考慮しません。
+func rankBook(b *book.Book, terms []string) float64 {
+	rank := 0.0
+	for _, t := range terms {
+		matched := false
+		for _, f := range searchFields(b) {
+			if strings.Contains(strings.ToLower(f.text), t) {
+				rank += f.weight
+				matched = true
+			}
+		}
+		if !matched {
+			return 0
+		}
+	}
+	return rank
+}
+
+// snippet は一致箇所の前後を切り出し、検索語をハイライトした抜粋を返します。
+// 説明・サブタイトル・タイトル・著者の順で最初に一致した列を使います。
+func snippet(b *book.Book, terms []string) string {
+	fields := []string{b.Description, b.Subtitle, b.Title, book.JoinAuthors(b.Authors)}
+	for _, f := range fields {
+		if s, ok := highlight(f, terms); ok {
+			return s
+		}
+	}
+	return html.EscapeString(truncateRunes(b.Title, snippetRadius*2))
+}
+
+func highlight(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// 小文字化で文字数が変わる場合は位置がずれるため小文字のまま扱う
+		runes = lower
+	}
+
+	// 一致した位置に印を付ける
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, t := range terms {
+		tr := []rune(t)
+		for i := 0; i+len(tr) <= len(lower); i++ {
+			if string(lower[i:i+len(tr)]) != t {
+				continue
+			}
+			for j := i; j < i+len(tr); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	start := max(first-snippetRadius, 0)
+	end := min(first+snippetRadius, len(runes))
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	open := false
+	for i := start; i < end; i++ {
+		if marked[i] && !open {
+			sb.WriteString(highlightOpen)
+			open = true
+		} else if !marked[i] && open {
+			sb.WriteString(highlightEnd)
+			open = false
+		}
+		sb.WriteString(html.EscapeString(string(runes[i])))
+	}
+	if open {
+		sb.WriteString(highlightEnd)
+	}
+	if end < len(runes) {
+		sb.WriteString("…")
+	}
+	return sb.String(), true
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
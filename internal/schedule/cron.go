@@ -0,0 +1,206 @@
+package schedule
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// macros は 5 項目の式の代わりに使える省略形です。
+var macros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// field は cron 式の 1 項目の範囲です。
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"分", 0, 59},
+	{"時", 0, 23},
+	{"日", 1, 31},
+	{"月", 1, 12},
+	// 曜日は 0 と 7 のどちらも日曜日
+	{"曜日", 0, 7},
+}
+
+// maxSearchYears は Next が次の時刻を探す範囲です。2 月 30 日のように存在しない日付の式で無限に探さないようにします。
+const maxSearchYears = 5
+
+// Cron は「分 時 日 月 曜日」の 5 項目からなる cron 式です。
+// 各項目には *・数値・範囲（1-5）・間隔（*/15, 1-10/2）とそのカンマ区切りを指定できます。
+// 日と曜日の両方を指定した場合は、どちらかに一致する日に実行します（一般的な cron と同じです）。
+type Cron struct {
+	expr                         string
+	minute, hour, dom, month     uint64
+	dow                          uint64
+	domRestricted, dowRestricted bool
+}
+
+// Parse は cron 式を解析します。@daily などの省略形も指定できます。
+func Parse(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron 式は「分 時 日 月 曜日」の 5 項目で指定してください: %q", expr)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron 式 %q の%s: %w", expr, fields[i].name, err)
+		}
+		bits[i] = b
+	}
+
+	c := &Cron{
+		expr:   expr,
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		// 一般的な cron と同じく、* で始まる項目は制限なしとみなす
+		domRestricted: !strings.HasPrefix(parts[2], "*"),
+		dowRestricted: !strings.HasPrefix(parts[4], "*"),
+	}
+	// 7 は日曜日として扱う
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("間隔が不正です: %q", item)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseNumber(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseNumber(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("範囲の開始が終了より後です: %q", item)
+			}
+		default:
+			n, err := parseNumber(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = n
+			// 5/10 のような指定は 5 から最大値まで 10 おき
+			if !hasStep {
+				hi = n
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseNumber(s string, f field) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("数値ではありません: %q", s)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%d から %d の範囲で指定してください: %d", f.min, f.max, n)
+	}
+	return n, nil
+}
+
+// Next は t より後で式に一致する最初の時刻を t のタイムゾーンで返します。
+// 一致する時刻が見つからない場合はゼロ値を返します。
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(c.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(c.minute, t.Minute()) {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := has(c.dom, t.Day())
+	dow := has(c.dow, int(t.Weekday()))
+	switch {
+	case c.domRestricted && c.dowRestricted:
+		return dom || dow
+	case c.domRestricted:
+		return dom
+	case c.dowRestricted:
+		return dow
+	default:
+		return true
+	}
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<v) != 0
+}
+
+// String は解析した元の式を返します。
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Jitter は 0 以上 max 未満のランダムな時間を返します。max が 0 以下の場合は 0 です。
+func Jitter(rng *rand.Rand, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rng.Int63n(int64(max)))
+}
@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	base := time.Date(2025, 1, 15, 10, 30, 20, 0, jst) // 水曜日
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"0 3 * * *", base, time.Date(2025, 1, 16, 3, 0, 0, 0, jst)},
+		{"@daily", base, time.Date(2025, 1, 16, 0, 0, 0, 0, jst)},
+		{"*/15 * * * *", base, time.Date(2025, 1, 15, 10, 45, 0, 0, jst)},
+		{"30 10 * * *", time.Date(2025, 1, 15, 10, 30, 0, 0, jst), time.Date(2025, 1, 16, 10, 30, 0, 0, jst)},
+		{"0 9-17/4 * * *", base, time.Date(2025, 1, 15, 13, 0, 0, 0, jst)},
+		{"0 0 1,15 * *", base, time.Date(2025, 2, 1, 0, 0, 0, 0, jst)},
+		{"0 0 * * 0", base, time.Date(2025, 1, 19, 0, 0, 0, 0, jst)},
+		{"0 0 * * 7", base, time.Date(2025, 1, 19, 0, 0, 0, 0, jst)},
+		{"0 0 * * 1-5", base, time.Date(2025, 1, 16, 0, 0, 0, 0, jst)},
+		// 日と曜日の両方を指定した場合はどちらかに一致する日
+		{"0 0 20 * 5", base, time.Date(2025, 1, 17, 0, 0, 0, 0, jst)},
+		{"0 0 29 2 *", base, time.Date(2028, 2, 29, 0, 0, 0, 0, jst)},
+		{"0 0 31 12 *", time.Date(2025, 12, 31, 0, 0, 0, 0, jst), time.Date(2026, 12, 31, 0, 0, 0, 0, jst)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("予期しないエラー: %v", err)
+			}
+			if got := c.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s): got %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextNoMatch(t *testing.T) {
+	c, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("予期しないエラー: %v", err)
+	}
+	if got := c.Next(time.Now()); !got.IsZero() {
+		t.Errorf("存在しない日付の式: got %s, want ゼロ値", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"0 3 * *", "5 項目"},
+		{"60 * * * *", "0 から 59"},
+		{"0 24 * * *", "0 から 23"},
+		{"0 0 0 * *", "1 から 31"},
+		{"0 0 * 13 *", "1 から 12"},
+		{"0 0 * * 8", "0 から 7"},
+		{"*/0 * * * *", "間隔"},
+		{"0 5-3 * * *", "範囲の開始"},
+		{"a * * * *", "数値ではありません"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q を含むエラー", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	if got := Jitter(rng, 0); got != 0 {
+		t.Errorf("Jitter(0): got %s, want 0", got)
+	}
+	for range 100 {
+		if got := Jitter(rng, time.Minute); got < 0 || got >= time.Minute {
+			t.Fatalf("Jitter(1m): got %s, want [0, 1m)", got)
+		}
+	}
+}
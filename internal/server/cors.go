@@ -11,7 +11,7 @@ func CORS() func(next http.Handler) http.Handler {
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET"},
 		AllowedHeaders:   []string{"Accept"},
-		ExposedHeaders:   []string{},
+		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}).Handler
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const cursorPrefix = "id:"
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor は最後に返した書籍の id を不透明なカーソル文字列に変換します。
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	s, ok := strings.CutPrefix(string(raw), cursorPrefix)
+	if !ok {
+		return 0, errInvalidCursor
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errInvalidCursor
+	}
+	return id, nil
+}
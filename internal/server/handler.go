@@ -1,96 +1,252 @@
 package server
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-)
 
-const (
-	defaultRandomCount = 3
-	maxRandomCount     = 10
+	"github.com/go-chi/chi/v5"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/isbn"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/ndc"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
 )
 
 type Handler struct {
-	DB *sql.DB
+	Books repository.BookRepository
+	Runs  repository.RunRepository
 }
 
 type Book struct {
-	ID            int64  `json:"id"`
-	ISBN          string `json:"isbn"`
-	Title         string `json:"title"`
-	Subtitle      string `json:"subtitle"`
-	Authors       string `json:"authors"`
-	Publisher     string `json:"publisher"`
-	PublishedDate string `json:"publishedDate"`
-	Description   string `json:"description"`
-	BookURL       string `json:"bookUrl"`
-	ImageURL      string `json:"imageUrl"`
+	ID            int64    `json:"id"`
+	ISBN          string   `json:"isbn"`
+	Title         string   `json:"title"`
+	Subtitle      string   `json:"subtitle"`
+	Authors       string   `json:"authors"`
+	Publisher     string   `json:"publisher"`
+	PublishedDate string   `json:"publishedDate"`
+	Description   string   `json:"description"`
+	BookURL       string   `json:"bookUrl"`
+	ImageURL      string   `json:"imageUrl"`
+	NDC           []string `json:"ndc"`
+}
+
+type BookList struct {
+	Books      []Book  `json:"books"`
+	NextCursor *string `json:"nextCursor"`
 }
 
-func NewHandler(db *sql.DB) *Handler {
-	return &Handler{DB: db}
+type SearchHit struct {
+	Book    Book    `json:"book"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+func NewHandler(books repository.BookRepository, runs repository.RunRepository) *Handler {
+	return &Handler{Books: books, Runs: runs}
+}
+
+func newBook(b *book.Book) Book {
+	return Book{
+		ID:            b.ID,
+		ISBN:          b.ISBN,
+		Title:         b.Title,
+		Subtitle:      b.Subtitle,
+		Authors:       book.JoinAuthors(b.Authors),
+		Publisher:     b.Publisher,
+		PublishedDate: b.PublishedDate,
+		Description:   b.Description,
+		BookURL:       b.BookURL,
+		ImageURL:      b.ImageURL,
+		NDC:           append([]string{}, b.NDC...),
+	}
+}
+
+func newBooks(bs []*book.Book) []Book {
+	books := make([]Book, 0, len(bs))
+	for _, b := range bs {
+		books = append(books, newBook(b))
+	}
+	return books
+}
+
+// parseNDCParam は ndc クエリパラメータを読み取ります。不正な場合は 400 を書き込み false を返します。
+func parseNDCParam(w http.ResponseWriter, r *http.Request) (ndc.Pattern, bool) {
+	v := r.URL.Query().Get("ndc")
+	if v == "" {
+		return ndc.Pattern{}, true
+	}
+	p, err := ndc.ParsePattern(v)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest,
+			"invalid ndc parameter: must be an NDC code such as 007.64, optionally ending with * for prefix match")
+		return ndc.Pattern{}, false
+	}
+	return p, true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
 }
 
 func (h *Handler) RandomBooks(w http.ResponseWriter, r *http.Request) {
-	count := defaultRandomCount
+	count := repository.DefaultRandomCount
 	if q := r.URL.Query().Get("count"); q != "" {
 		n, err := strconv.Atoi(q)
-		if err != nil || n < 1 || n > maxRandomCount {
+		if err != nil || n < 1 || n > repository.MaxRandomCount {
 			writeJSONError(w, http.StatusBadRequest,
-				fmt.Sprintf("invalid count parameter: must be integer between 1 and %d", maxRandomCount))
+				fmt.Sprintf("invalid count parameter: must be integer between 1 and %d", repository.MaxRandomCount))
 			return
 		}
 		count = n
 	}
 
-	const query = `
-		SELECT
-			id,
-			isbn,
-			title,
-			subtitle,
-			authors,
-			publisher,
-			published_date,
-			description,
-			book_url,
-			image_url
-		FROM books
-		ORDER BY RANDOM()
-		LIMIT $1
-	`
-	rows, err := h.DB.Query(query, count)
+	pattern, ok := parseNDCParam(w, r)
+	if !ok {
+		return
+	}
+
+	books, err := h.Books.Random(r.Context(), repository.RandomParams{Count: count, NDC: pattern})
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	defer rows.Close()
-
-	books := make([]Book, 0, count)
-	for rows.Next() {
-		var b Book
-		err := rows.Scan(
-			&b.ID,
-			&b.ISBN,
-			&b.Title,
-			&b.Subtitle,
-			&b.Authors,
-			&b.Publisher,
-			&b.PublishedDate,
-			&b.Description,
-			&b.BookURL,
-			&b.ImageURL,
-		)
+
+	writeJSON(w, newBooks(books))
+}
+
+func (h *Handler) BookByISBN(w http.ResponseWriter, r *http.Request) {
+	parsed, err := isbn.Parse(chi.URLParam(r, "isbn"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid isbn parameter: must be ISBN-10 or ISBN-13")
+		return
+	}
+
+	// 保存形式がどちらでも引けるよう ISBN-13、ISBN-10 の順に探す
+	for _, code := range parsed.Forms() {
+		b, err := h.Books.GetByISBN(r.Context(), code)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
 		if err != nil {
 			writeJSONError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-		books = append(books, b)
+		writeJSON(w, newBook(b))
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(books)
+	writeJSONError(w, http.StatusNotFound, "book not found")
+}
+
+func (h *Handler) ListBooks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params := repository.ListParams{
+		Limit:     repository.DefaultListLimit,
+		Publisher: q.Get("publisher"),
+		Author:    q.Get("author"),
+	}
+
+	pattern, ok := parseNDCParam(w, r)
+	if !ok {
+		return
+	}
+	params.NDC = pattern
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > repository.MaxListLimit {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("invalid limit parameter: must be integer between 1 and %d", repository.MaxListLimit))
+			return
+		}
+		params.Limit = n
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		id, err := decodeCursor(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid cursor parameter")
+			return
+		}
+		params.AfterID = id
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"yearFrom", &params.YearFrom},
+		{"yearTo", &params.YearTo},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 9999 {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("invalid %s parameter: must be a year between 1 and 9999", p.name))
+			return
+		}
+		*p.dst = n
+	}
+	if params.YearFrom > 0 && params.YearTo > 0 && params.YearFrom > params.YearTo {
+		writeJSONError(w, http.StatusBadRequest, "invalid year range: yearFrom must be less than or equal to yearTo")
+		return
+	}
+
+	books, hasMore, err := h.Books.List(r.Context(), params)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := BookList{Books: newBooks(books)}
+	if hasMore && len(books) > 0 {
+		next := encodeCursor(books[len(books)-1].ID)
+		res.NextCursor = &next
+
+		nextQuery := r.URL.Query()
+		nextQuery.Set("cursor", next)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, nextQuery.Encode()))
+	}
+
+	writeJSON(w, res)
+}
+
+func (h *Handler) SearchBooks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := repository.DefaultListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > repository.MaxListLimit {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("invalid limit parameter: must be integer between 1 and %d", repository.MaxListLimit))
+			return
+		}
+		limit = n
+	}
+
+	results, err := h.Books.Search(r.Context(), q.Get("q"), limit)
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid q parameter: must be between 1 and %d characters", repository.MaxSearchQueryLength))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hits := make([]SearchHit, 0, len(results))
+	for _, res := range results {
+		hits = append(hits, SearchHit{Book: newBook(res.Book), Rank: res.Rank, Snippet: res.Snippet})
+	}
+
+	writeJSON(w, hits)
 }
@@ -2,21 +2,23 @@ package openapi_test
 
 import (
 	"embed"
+	"encoding/json"
 	"io"
-	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
 	"github.com/getkin/kin-openapi/routers/gorillamux"
 
-	"github.com/taiki-umetsu/ndc007-bookpicker/internal/database"
-	"github.com/taiki-umetsu/ndc007-bookpicker/internal/env"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/book"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
 	"github.com/taiki-umetsu/ndc007-bookpicker/internal/server"
 )
 
@@ -26,47 +28,73 @@ var openapiSpec []byte
 //go:embed schemas/*
 var schemaFS embed.FS
 
-func TestBooksRandomEndpoint(t *testing.T) {
-	env.Load()
+const testAdminToken = "admin-token"
 
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("環境変数 DATABASE_URL が未設定です")
-	}
+type testCase struct {
+	name        string
+	url         string
+	token       string
+	expectCode  int
+	description string
+}
 
-	db, err := database.Setup(dsn)
-	if err != nil {
-		t.Fatalf("DB接続エラー: %v", err)
-	}
-	t.Cleanup(func() {
-		db.Exec(`TRUNCATE books`)
-		db.Close()
-	})
+func newTestRepository() repository.BookRepository {
+	neko := book.NewBook("9784003101018", "吾輩は猫である", "夏目漱石作品集", []string{"夏目漱石"}, "岩波書店",
+		"1905-01-01", "名前のない猫の視点で描かれる風刺的な小説",
+		"https://example.com/neko", "https://example.com/neko.jpg")
+	neko.NDC = []string{"913.6"}
 
-	if _, err = db.Exec(`TRUNCATE books`); err != nil {
-		t.Fatalf("TRUNCATE失敗: %v", err)
-	}
+	kokoro := book.NewBook("9784003101025", "こころ", "", []string{"夏目漱石"}, "岩波書店",
+		"1914-01-01", "先生と私の関係を描く心理小説",
+		"https://example.com/kokoro", "https://example.com/kokoro.jpg")
 
-	_, err = db.Exec(`
-		INSERT INTO books (
-			isbn, title, subtitle, authors, publisher,
-			published_date, description, book_url, image_url
-		) VALUES 
-		('9784003101018', '吾輩は猫である', '夏目漱石作品集', '夏目漱石', '岩波書店',
-		 '1905-01-01', '名前のない猫の視点で描かれる風刺的な小説',
-		 'https://example.com/neko', 'https://example.com/neko.jpg'),
-		('9784003101025', 'こころ', '', '夏目漱石', '岩波書店',
-		 '1914-01-01', '先生と私の関係を描く心理小説',
-		 'https://example.com/kokoro', 'https://example.com/kokoro.jpg')
-	`)
-	if err != nil {
-		t.Fatalf("データ挿入失敗: %v", err)
-	}
+	return repository.NewMemoryBookRepository(neko, kokoro)
+}
+
+func newTestRunRepository() repository.RunRepository {
+	start := time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	finish := start.Add(5 * time.Minute)
+	partialFinish := start.Add(48*time.Hour + 5*time.Minute)
+	return repository.NewMemoryRunRepository(
+		&run.Run{
+			Status:     run.StatusCommitted,
+			Config:     json.RawMessage(`{"count":10,"targets":[{"code":"007.64","count":10}]}`),
+			Discovered: map[string]int{"007.64": 10},
+			Enriched:   9,
+			Failed:     1,
+			Inserted:   9,
+			StartedAt:  start,
+			FinishedAt: &finish,
+		},
+		&run.Run{
+			Status:    run.StatusRunning,
+			StartedAt: start.Add(24 * time.Hour),
+		},
+		&run.Run{
+			Status:     run.StatusPartial,
+			Config:     json.RawMessage(`{"count":10,"incremental":true,"targets":[{"code":"007.64","count":10}]}`),
+			Discovered: map[string]int{"007.64": 10},
+			Enriched:   4,
+			Failed:     6,
+			Inserted:   4,
+			Error:      "成功の条件を満たしていません",
+			StartedAt:  start.Add(48 * time.Hour),
+			FinishedAt: &partialFinish,
+		},
+	)
+}
 
-	handler := server.NewHandler(db)
-	router := server.NewRouter(handler)
+// noRateLimit はレート制限をかけません。ケースの数によって 429 が返り、契約テストが失敗しないようにします。
+func noRateLimit(next http.Handler) http.Handler { return next }
+
+// setupContractTest はテストサーバーと OpenAPI ルーターを作成します。
+func setupContractTest(t *testing.T, repo repository.BookRepository) (*httptest.Server, *openapi3.Loader, routers.Router) {
+	t.Helper()
+
+	handler := server.NewHandler(repo, newTestRunRepository())
+	router := server.NewRouter(handler, testAdminToken, noRateLimit)
 	ts := httptest.NewServer(router)
-	defer ts.Close()
+	t.Cleanup(ts.Close)
 
 	loader := openapi3.NewLoader()
 	loader.IsExternalRefsAllowed = true
@@ -90,49 +118,13 @@ func TestBooksRandomEndpoint(t *testing.T) {
 		t.Fatalf("OpenAPIルーター作成失敗: %v", err)
 	}
 
-	testCases := []struct {
-		name        string
-		url         string
-		expectCode  int
-		description string
-	}{
-		{
-			name:        "デフォルトパラメータ",
-			url:         "/api/v1/books/random",
-			expectCode:  http.StatusOK,
-			description: "countパラメータなし（デフォルト値3）",
-		},
-		{
-			name:        "count=1",
-			url:         "/api/v1/books/random?count=1",
-			expectCode:  http.StatusOK,
-			description: "count=1を指定",
-		},
-		{
-			name:        "count=2",
-			url:         "/api/v1/books/random?count=2",
-			expectCode:  http.StatusOK,
-			description: "count=2を指定",
-		},
-		{
-			name:        "count=0（無効な値）",
-			url:         "/api/v1/books/random?count=0",
-			expectCode:  http.StatusBadRequest,
-			description: "最小値以下のcount",
-		},
-		{
-			name:        "count=11（無効な値）",
-			url:         "/api/v1/books/random?count=11",
-			expectCode:  http.StatusBadRequest,
-			description: "最大値以上のcount",
-		},
-		{
-			name:        "count=invalid（文字列）",
-			url:         "/api/v1/books/random?count=invalid",
-			expectCode:  http.StatusBadRequest,
-			description: "数値以外のcount",
-		},
-	}
+	return ts, loader, routerSpec
+}
+
+func runContractTests(t *testing.T, repo repository.BookRepository, testCases []testCase) {
+	t.Helper()
+
+	ts, loader, routerSpec := setupContractTest(t, repo)
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -141,6 +133,9 @@ func TestBooksRandomEndpoint(t *testing.T) {
 				t.Fatalf("リクエスト作成失敗: %v", err)
 			}
 			req.Header.Set("Accept", "application/json")
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
 
 			res, err := http.DefaultClient.Do(req)
 			if err != nil {
@@ -184,3 +179,348 @@ func TestBooksRandomEndpoint(t *testing.T) {
 		})
 	}
 }
+
+func TestBooksRandomEndpoint(t *testing.T) {
+	runContractTests(t, newTestRepository(), []testCase{
+		{
+			name:        "デフォルトパラメータ",
+			url:         "/api/v1/books/random",
+			expectCode:  http.StatusOK,
+			description: "countパラメータなし（デフォルト値3）",
+		},
+		{
+			name:        "count=1",
+			url:         "/api/v1/books/random?count=1",
+			expectCode:  http.StatusOK,
+			description: "count=1を指定",
+		},
+		{
+			name:        "count=2",
+			url:         "/api/v1/books/random?count=2",
+			expectCode:  http.StatusOK,
+			description: "count=2を指定",
+		},
+		{
+			name:        "ndc指定",
+			url:         "/api/v1/books/random?ndc=913.6",
+			expectCode:  http.StatusOK,
+			description: "NDC分類コードで絞り込み",
+		},
+		{
+			name:        "ndc前方一致",
+			url:         "/api/v1/books/random?ndc=007.3*",
+			expectCode:  http.StatusOK,
+			description: "一致なしでも空配列を返す",
+		},
+		{
+			name:        "ndc不正",
+			url:         "/api/v1/books/random?ndc=007.x",
+			expectCode:  http.StatusBadRequest,
+			description: "NDC分類コードの形式エラー",
+		},
+		{
+			name:        "count=0（無効な値）",
+			url:         "/api/v1/books/random?count=0",
+			expectCode:  http.StatusBadRequest,
+			description: "最小値以下のcount",
+		},
+		{
+			name:        "count=11（無効な値）",
+			url:         "/api/v1/books/random?count=11",
+			expectCode:  http.StatusBadRequest,
+			description: "最大値以上のcount",
+		},
+		{
+			name:        "count=invalid（文字列）",
+			url:         "/api/v1/books/random?count=invalid",
+			expectCode:  http.StatusBadRequest,
+			description: "数値以外のcount",
+		},
+	})
+}
+
+func TestBookByISBNEndpoint(t *testing.T) {
+	runContractTests(t, newTestRepository(), []testCase{
+		{
+			name:        "ISBN-13",
+			url:         "/api/v1/books/9784003101018",
+			expectCode:  http.StatusOK,
+			description: "ハイフンなしの ISBN-13",
+		},
+		{
+			name:        "ISBN-13（ハイフン付き）",
+			url:         "/api/v1/books/978-4-00-310101-8",
+			expectCode:  http.StatusOK,
+			description: "ハイフン付きの ISBN-13",
+		},
+		{
+			name:        "ISBN-10",
+			url:         "/api/v1/books/4003101014",
+			expectCode:  http.StatusOK,
+			description: "ISBN-10 から ISBN-13 で保存された書籍を取得",
+		},
+		{
+			name:        "ISBN-10（ハイフン付き）",
+			url:         "/api/v1/books/4-00-310102-2",
+			expectCode:  http.StatusOK,
+			description: "ハイフン付きの ISBN-10",
+		},
+		{
+			name:        "存在しない ISBN",
+			url:         "/api/v1/books/9784000000000",
+			expectCode:  http.StatusNotFound,
+			description: "未登録の ISBN",
+		},
+		{
+			name:        "チェックディジット不正",
+			url:         "/api/v1/books/9784003101019",
+			expectCode:  http.StatusBadRequest,
+			description: "チェックディジットが一致しない ISBN",
+		},
+		{
+			name:        "桁数不正",
+			url:         "/api/v1/books/12345678901",
+			expectCode:  http.StatusBadRequest,
+			description: "ISBN-10/13 以外の桁数",
+		},
+	})
+}
+
+func TestBooksListEndpoint(t *testing.T) {
+	runContractTests(t, newTestRepository(), []testCase{
+		{
+			name:        "デフォルトパラメータ",
+			url:         "/api/v1/books",
+			expectCode:  http.StatusOK,
+			description: "パラメータなし（デフォルト20件）",
+		},
+		{
+			name:        "limit=1（次ページあり）",
+			url:         "/api/v1/books?limit=1",
+			expectCode:  http.StatusOK,
+			description: "nextCursor と Link ヘッダーを返す",
+		},
+		{
+			name:        "フィルタ指定",
+			url:         "/api/v1/books?publisher=%E5%B2%A9%E6%B3%A2%E6%9B%B8%E5%BA%97&author=%E6%BC%B1%E7%9F%B3&yearFrom=1900&yearTo=1910",
+			expectCode:  http.StatusOK,
+			description: "出版社・著者・出版年で絞り込み",
+		},
+		{
+			name:        "NDC指定",
+			url:         "/api/v1/books?ndc=913.6",
+			expectCode:  http.StatusOK,
+			description: "NDC分類コードで絞り込み",
+		},
+		{
+			name:        "limit=101（無効な値）",
+			url:         "/api/v1/books?limit=101",
+			expectCode:  http.StatusBadRequest,
+			description: "最大値以上のlimit",
+		},
+		{
+			name:        "cursor=invalid",
+			url:         "/api/v1/books?cursor=%21%21",
+			expectCode:  http.StatusBadRequest,
+			description: "デコードできないcursor",
+		},
+		{
+			name:        "yearFrom > yearTo",
+			url:         "/api/v1/books?yearFrom=2020&yearTo=2010",
+			expectCode:  http.StatusBadRequest,
+			description: "逆転した出版年の範囲",
+		},
+	})
+}
+
+func TestBooksListPagination(t *testing.T) {
+	ts, _, _ := setupContractTest(t, newTestRepository())
+
+	var titles []string
+	next := "/api/v1/books?limit=1"
+	for next != "" {
+		res, err := http.Get(ts.URL + next)
+		if err != nil {
+			t.Fatalf("リクエスト失敗: %v", err)
+		}
+
+		var page server.BookList
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("レスポンスのデコード失敗: %v", err)
+		}
+
+		for _, b := range page.Books {
+			titles = append(titles, b.Title)
+		}
+
+		link := res.Header.Get("Link")
+		if (page.NextCursor == nil) != (link == "") {
+			t.Fatalf("nextCursor と Link ヘッダーが一致しません: %v, %q", page.NextCursor, link)
+		}
+		next = ""
+		if link != "" {
+			next = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+
+	want := []string{"吾輩は猫である", "こころ"}
+	if strings.Join(titles, ",") != strings.Join(want, ",") {
+		t.Errorf("ページングの結果が一致しません: got %v, want %v", titles, want)
+	}
+}
+
+func TestBooksSearchEndpoint(t *testing.T) {
+	runContractTests(t, newTestRepository(), []testCase{
+		{
+			name:        "日本語の検索語",
+			url:         "/api/v1/books/search?q=" + url.QueryEscape("猫"),
+			expectCode:  http.StatusOK,
+			description: "タイトル・説明に一致",
+		},
+		{
+			name:        "複数語・limit指定",
+			url:         "/api/v1/books/search?limit=1&q=" + url.QueryEscape("漱石 心理"),
+			expectCode:  http.StatusOK,
+			description: "すべての語を含む書籍のみ",
+		},
+		{
+			name:        "一致なし",
+			url:         "/api/v1/books/search?q=Go",
+			expectCode:  http.StatusOK,
+			description: "空配列を返す",
+		},
+		{
+			name:        "q なし",
+			url:         "/api/v1/books/search",
+			expectCode:  http.StatusBadRequest,
+			description: "必須パラメータの欠落",
+		},
+		{
+			name:        "limit=0（無効な値）",
+			url:         "/api/v1/books/search?q=abc&limit=0",
+			expectCode:  http.StatusBadRequest,
+			description: "最小値以下のlimit",
+		},
+	})
+}
+
+func TestRunsEndpoint(t *testing.T) {
+	runContractTests(t, newTestRepository(), []testCase{
+		{
+			name:        "デフォルトパラメータ",
+			url:         "/api/v1/admin/runs",
+			token:       testAdminToken,
+			expectCode:  http.StatusOK,
+			description: "開始日時の新しい順（実行中の記録を含む）",
+		},
+		{
+			name:        "最後にコミットされた実行",
+			url:         "/api/v1/admin/runs?status=committed&limit=1",
+			token:       testAdminToken,
+			expectCode:  http.StatusOK,
+			description: "status と limit で絞り込み",
+		},
+		{
+			name:        "一部のみ登録した実行",
+			url:         "/api/v1/admin/runs?status=partial",
+			token:       testAdminToken,
+			expectCode:  http.StatusOK,
+			description: "差分登録で成功の条件を満たさなかった実行",
+		},
+		{
+			name:        "status不正",
+			url:         "/api/v1/admin/runs?status=failed",
+			token:       testAdminToken,
+			expectCode:  http.StatusBadRequest,
+			description: "定義にない status",
+		},
+		{
+			name:        "limit=0（無効な値）",
+			url:         "/api/v1/admin/runs?limit=0",
+			token:       testAdminToken,
+			expectCode:  http.StatusBadRequest,
+			description: "最小値以下のlimit",
+		},
+		{
+			name:        "id指定",
+			url:         "/api/v1/admin/runs/1",
+			token:       testAdminToken,
+			expectCode:  http.StatusOK,
+			description: "実行記録を 1 件取得",
+		},
+		{
+			name:        "存在しないid",
+			url:         "/api/v1/admin/runs/99",
+			token:       testAdminToken,
+			expectCode:  http.StatusNotFound,
+			description: "未登録の実行記録",
+		},
+		{
+			name:        "id不正",
+			url:         "/api/v1/admin/runs/abc",
+			token:       testAdminToken,
+			expectCode:  http.StatusBadRequest,
+			description: "数値以外のid",
+		},
+		{
+			name:        "トークンなし",
+			url:         "/api/v1/admin/runs",
+			expectCode:  http.StatusUnauthorized,
+			description: "管理用のトークンが必要",
+		},
+		{
+			name:        "トークン不一致",
+			url:         "/api/v1/admin/runs/1",
+			token:       "wrong",
+			expectCode:  http.StatusUnauthorized,
+			description: "管理用のトークンが必要",
+		},
+	})
+}
+
+func TestAdminEndpointsDisabledWithoutToken(t *testing.T) {
+	handler := server.NewHandler(newTestRepository(), newTestRunRepository())
+	ts := httptest.NewServer(server.NewRouter(handler, "", noRateLimit))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL+"/api/v1/admin/runs", nil)
+	if err != nil {
+		t.Fatalf("リクエスト作成失敗: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer ")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("リクエスト失敗: %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("ステータスコード不一致: got %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestDefaultRateLimit(t *testing.T) {
+	handler := server.NewHandler(newTestRepository(), newTestRunRepository())
+	ts := httptest.NewServer(server.NewRouter(handler, "", server.DefaultRateLimit()))
+	defer ts.Close()
+
+	// 同じ IP アドレスからの 11 回目のリクエストは制限される
+	for i := 1; i <= 11; i++ {
+		res, err := http.Get(ts.URL + "/api/v1/books/random")
+		if err != nil {
+			t.Fatalf("リクエスト失敗: %v", err)
+		}
+		res.Body.Close()
+
+		want := http.StatusOK
+		if i == 11 {
+			want = http.StatusTooManyRequests
+		}
+		if res.StatusCode != want {
+			t.Fatalf("%d 回目のステータスコード不一致: got %d, want %d", i, res.StatusCode, want)
+		}
+	}
+}
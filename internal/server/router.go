@@ -15,16 +15,34 @@ var bundledSpec []byte
 
 const openapiSpecPath = "/openapi.yaml"
 
-func NewRouter(handler *Handler) http.Handler {
+// DefaultRateLimit は本番の IP アドレスごとのレート制限（1 分あたり 10 リクエスト）です。
+func DefaultRateLimit() func(http.Handler) http.Handler {
+	return httprate.LimitByIP(10, 1*time.Minute)
+}
+
+// NewRouter は API のルーターを返します。adminToken が空の場合、管理用のエンドポイントは公開しません。
+// rateLimit はすべてのリクエストに適用するレート制限で、通常は DefaultRateLimit() を渡します。
+func NewRouter(handler *Handler, adminToken string, rateLimit func(http.Handler) http.Handler) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(RequestLogger)
 	r.Use(Recovery)
 	r.Use(CORS())
-	r.Use(httprate.LimitByIP(10, 1*time.Minute))
+	r.Use(rateLimit)
 
 	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/books", handler.ListBooks)
 		r.Get("/books/random", handler.RandomBooks)
+		r.Get("/books/search", handler.SearchBooks)
+		r.Get("/books/{isbn}", handler.BookByISBN)
+
+		// バッチの実行履歴。設定や外部 API のエラーを含むため、管理用のトークンを持つリクエストにのみ返す
+		if adminToken != "" {
+			r.With(AdminAuth(adminToken)).Route("/admin", func(r chi.Router) {
+				r.Get("/runs", handler.ListRuns)
+				r.Get("/runs/{id}", handler.RunByID)
+			})
+		}
 	})
 
 	r.Get(openapiSpecPath, func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/model/run"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/redact"
+	"github.com/taiki-umetsu/ndc007-bookpicker/internal/repository"
+)
+
+// Run はバッチの実行記録です。
+type Run struct {
+	ID         int64           `json:"id"`
+	Status     run.Status      `json:"status"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt"`
+	Config     json.RawMessage `json:"config"`
+	Discovered map[string]int  `json:"discovered"`
+	Enriched   int             `json:"enriched"`
+	Failed     int             `json:"failed"`
+	Inserted   int             `json:"inserted"`
+	Error      string          `json:"error"`
+}
+
+var runStatuses = []run.Status{run.StatusRunning, run.StatusCommitted, run.StatusRolledBack, run.StatusInterrupted, run.StatusPartial}
+
+// newRun は実行記録を API の応答に変換します。エラーは以前に保存した記録も含め、URL のクエリ文字列を除いて返します。
+func newRun(rn *run.Run) Run {
+	res := Run{
+		ID:         rn.ID,
+		Status:     rn.Status,
+		StartedAt:  rn.StartedAt,
+		FinishedAt: rn.FinishedAt,
+		Config:     rn.Config,
+		Discovered: maps.Clone(rn.Discovered),
+		Enriched:   rn.Enriched,
+		Failed:     rn.Failed,
+		Inserted:   rn.Inserted,
+		Error:      redact.URLs(rn.Error),
+	}
+	if len(res.Config) == 0 {
+		res.Config = json.RawMessage("{}")
+	}
+	if res.Discovered == nil {
+		res.Discovered = map[string]int{}
+	}
+	return res
+}
+
+func (h *Handler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params := repository.RunListParams{Limit: repository.DefaultRunLimit}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > repository.MaxRunLimit {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("invalid limit parameter: must be integer between 1 and %d", repository.MaxRunLimit))
+			return
+		}
+		params.Limit = n
+	}
+
+	if v := q.Get("status"); v != "" {
+		params.Status = run.Status(v)
+		if !slices.Contains(runStatuses, params.Status) {
+			writeJSONError(w, http.StatusBadRequest,
+				"invalid status parameter: must be one of running, committed, rolled_back, interrupted, partial")
+			return
+		}
+	}
+
+	runs, err := h.Runs.List(r.Context(), params)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := make([]Run, 0, len(runs))
+	for _, rn := range runs {
+		res = append(res, newRun(rn))
+	}
+	writeJSON(w, res)
+}
+
+func (h *Handler) RunByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		writeJSONError(w, http.StatusBadRequest, "invalid id parameter: must be a positive integer")
+		return
+	}
+
+	rn, err := h.Runs.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, newRun(rn))
+}